@@ -0,0 +1,138 @@
+package itchio
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+)
+
+// An Authenticator decides which credentials a Client's requests are
+// made with. The built-in ones are KeyAuth, Anonymous, OAuthAuthenticator
+// and SubkeyAuthenticator. Custom schemes can be used by implementing it.
+//
+// Authenticators may be shared by several clients (see Client.With),
+// so they must be safe for concurrent use.
+type Authenticator interface {
+	// Authenticate adds credentials to a request c is about to send,
+	// renewing them first if needed. It's called before every attempt.
+	Authenticate(ctx context.Context, c *Client, req *http.Request) error
+
+	// Unauthorized is called when the API rejects a request with a 401.
+	// It returns true if the credentials were renewed, in which case the
+	// request is authenticated and sent again, once.
+	Unauthorized(ctx context.Context, c *Client, res *http.Response) (bool, error)
+
+	// QueryCredentials returns the query parameters that authenticate URLs
+	// the client hands out, like MakeUploadDownloadURL's, renewing
+	// credentials first if needed, like Authenticate.
+	QueryCredentials(ctx context.Context, c *Client) (url.Values, error)
+
+	// Identity identifies whom requests are made on behalf of, so that
+	// cached and coalesced responses are never shared between identities.
+	// It must not reveal credentials.
+	Identity() string
+}
+
+// authenticatorKey overrides the client's authenticator for a request,
+// see withAuthenticator
+const authenticatorKey contextKey = "authenticator"
+
+// withAuthenticator returns a context which makes requests authenticate
+// with auth rather than with the client's authenticator. Token refreshes
+// use it, so they don't go through the very authenticator refreshing.
+func withAuthenticator(ctx context.Context, auth Authenticator) context.Context {
+	return context.WithValue(ctx, authenticatorKey, auth)
+}
+
+// authenticator returns the authenticator requests made with
+// ctx use: c.Auth, or c.Key if there's none.
+func (c *Client) authenticator(ctx context.Context) Authenticator {
+	if auth, ok := ctx.Value(authenticatorKey).(Authenticator); ok {
+		return auth
+	}
+	if c.Auth != nil {
+		return c.Auth
+	}
+	if c.Key == "" {
+		return Anonymous
+	}
+	return KeyAuth(c.Key)
+}
+
+// authIdentity identifies the credentials requests made
+// with ctx use, without revealing them.
+func (c *Client) authIdentity(ctx context.Context) string {
+	return c.authenticator(ctx).Identity()
+}
+
+// hashIdentity turns a secret into an identity that doesn't reveal it
+func hashIdentity(kind string, secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return kind + ":" + hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes, hex-encoded
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+//-------------------------------------------------------
+
+// KeyAuth is an Authenticator for a static API key. It can't recover
+// from 401s: the key is either valid or it isn't.
+type KeyAuth string
+
+var _ Authenticator = KeyAuth("")
+
+// Authenticate sets the key as the request's Authorization header
+func (k KeyAuth) Authenticate(ctx context.Context, c *Client, req *http.Request) error {
+	req.Header.Set("Authorization", string(k))
+	return nil
+}
+
+// Unauthorized returns false: there's no other key to try
+func (k KeyAuth) Unauthorized(ctx context.Context, c *Client, res *http.Response) (bool, error) {
+	return false, nil
+}
+
+// QueryCredentials returns the key as the api_key parameter
+func (k KeyAuth) QueryCredentials(ctx context.Context, c *Client) (url.Values, error) {
+	return url.Values{"api_key": []string{string(k)}}, nil
+}
+
+// Identity returns a hash of the key
+func (k KeyAuth) Identity() string {
+	return hashIdentity("key", string(k))
+}
+
+//-------------------------------------------------------
+
+// Anonymous is an Authenticator that makes requests without credentials,
+// for endpoints that don't need any (logging in, searching, etc.)
+var Anonymous Authenticator = anonymousAuth{}
+
+type anonymousAuth struct{}
+
+func (anonymousAuth) Authenticate(ctx context.Context, c *Client, req *http.Request) error {
+	req.Header.Del("Authorization")
+	return nil
+}
+
+func (anonymousAuth) Unauthorized(ctx context.Context, c *Client, res *http.Response) (bool, error) {
+	return false, nil
+}
+
+func (anonymousAuth) QueryCredentials(ctx context.Context, c *Client) (url.Values, error) {
+	return nil, nil
+}
+
+func (anonymousAuth) Identity() string {
+	return "anonymous"
+}
@@ -0,0 +1,158 @@
+package itchio
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultSubkeyRenewBuffer is how early before it expires a
+// SubkeyAuthenticator renews its subkey, unless told otherwise
+const DefaultSubkeyRenewBuffer = 5 * time.Minute
+
+// A SubkeyAuthenticator is an Authenticator for a subkey: a scoped-down,
+// temporary API key, obtained from a parent client with Subkey. It gets a
+// new subkey when the current one is about to expire, or gets rejected.
+//
+// It's typically handed to the games a launcher starts, so they can make
+// API calls without getting hold of the user's credentials.
+type SubkeyAuthenticator struct {
+	parent      *Client
+	params      SubkeyParams
+	renewBuffer time.Duration
+
+	mu        sync.RWMutex
+	key       string
+	expiresAt time.Time
+	// renewMu makes sure only one subkey is requested at a time
+	renewMu sync.Mutex
+}
+
+var _ Authenticator = (*SubkeyAuthenticator)(nil)
+
+// NewSubkeyAuthenticator returns an authenticator that requests subkeys
+// for params.GameID and params.Scope with parent. Subkeys are renewed
+// renewBuffer before they expire, or DefaultSubkeyRenewBuffer if zero.
+func NewSubkeyAuthenticator(parent *Client, params SubkeyParams, renewBuffer time.Duration) *SubkeyAuthenticator {
+	if renewBuffer == 0 {
+		renewBuffer = DefaultSubkeyRenewBuffer
+	}
+	return &SubkeyAuthenticator{
+		parent:      parent,
+		params:      params,
+		renewBuffer: renewBuffer,
+	}
+}
+
+// Authenticate requests a subkey if there's no valid one,
+// then sets it as the request's Authorization header.
+func (a *SubkeyAuthenticator) Authenticate(ctx context.Context, c *Client, req *http.Request) error {
+	key, err := a.Key(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", key)
+	return nil
+}
+
+// Unauthorized requests a new subkey, since the current one may
+// have been revoked.
+func (a *SubkeyAuthenticator) Unauthorized(ctx context.Context, c *Client, res *http.Response) (bool, error) {
+	a.mu.RLock()
+	rejected := a.key
+	a.mu.RUnlock()
+
+	if err := a.renew(ctx, rejected); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// QueryCredentials returns a valid subkey as the api_key parameter,
+// requesting one if needed
+func (a *SubkeyAuthenticator) QueryCredentials(ctx context.Context, c *Client) (url.Values, error) {
+	key, err := a.Key(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{"api_key": []string{key}}, nil
+}
+
+// Identity identifies the parent's credentials, and the game and scope
+// subkeys are requested for. It doesn't change when the subkey is renewed.
+func (a *SubkeyAuthenticator) Identity() string {
+	parent := a.parent.authIdentity(context.Background())
+	return hashIdentity("subkey", fmt.Sprintf("%s %d %s", parent, a.params.GameID, a.params.Scope))
+}
+
+// Key returns a valid subkey, requesting one if needed
+func (a *SubkeyAuthenticator) Key(ctx context.Context) (string, error) {
+	if key, ok := a.validKey(); ok {
+		return key, nil
+	}
+	if err := a.renew(ctx, ""); err != nil {
+		return "", err
+	}
+	key, _ := a.validKey()
+	return key, nil
+}
+
+func (a *SubkeyAuthenticator) validKey() (string, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.key == "" {
+		return "", false
+	}
+	if !a.expiresAt.IsZero() && time.Now().Add(a.renewBuffer).After(a.expiresAt) {
+		return a.key, false
+	}
+	return a.key, true
+}
+
+// renew requests a new subkey, unless another goroutine already replaced
+// the current one while we waited. rejected is the subkey the API rejected,
+// if any.
+func (a *SubkeyAuthenticator) renew(ctx context.Context, rejected string) error {
+	a.renewMu.Lock()
+	defer a.renewMu.Unlock()
+
+	a.mu.RLock()
+	current := a.key
+	a.mu.RUnlock()
+	if rejected != "" && current != rejected {
+		return nil
+	}
+	if _, ok := a.validKey(); ok && rejected == "" {
+		return nil
+	}
+
+	// the subkey request doesn't count towards the response
+	// metadata of the request that triggered it
+	res, err := a.parent.Subkey(withoutResponseMeta(ctx), a.params)
+	if err != nil {
+		return errors.Wrap(err, "failed to renew subkey")
+	}
+
+	var expiresAt time.Time
+	if res.ExpiresAt != "" {
+		expiresAt, err = time.Parse(time.RFC3339, res.ExpiresAt)
+		if err != nil {
+			// only renew once it's rejected
+			expiresAt = time.Time{}
+		}
+	}
+
+	a.mu.Lock()
+	a.key = res.Key
+	a.expiresAt = expiresAt
+	a.mu.Unlock()
+
+	a.parent.logger().Log(ctx, LogLevelInfo, "subkey renewed", "gameID", a.params.GameID, "expiresAt", expiresAt)
+	return nil
+}
@@ -0,0 +1,202 @@
+package itchio
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// signatureAuth is a custom authentication scheme, whose
+// signature gets rotated after a 401
+type signatureAuth struct {
+	mu           sync.Mutex
+	signature    string
+	unauthorized int
+}
+
+func (a *signatureAuth) Authenticate(ctx context.Context, c *Client, req *http.Request) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	req.Header.Set("X-Signature", a.signature)
+	return nil
+}
+
+func (a *signatureAuth) Unauthorized(ctx context.Context, c *Client, res *http.Response) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.unauthorized++
+	a.signature = "good"
+	return true, nil
+}
+
+func (a *signatureAuth) QueryCredentials(ctx context.Context, c *Client) (url.Values, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return url.Values{"signature": []string{a.signature}}, nil
+}
+
+func (a *signatureAuth) Identity() string {
+	return "signature"
+}
+
+func TestCustomAuthenticator(t *testing.T) {
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+		if r.Header.Get("X-Signature") != "good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"user":{"id":1}}`))
+	}))
+	defer server.Close()
+
+	auth := &signatureAuth{signature: "stale"}
+	client := newTestKeyClient(server).With(WithAuthenticator(auth))
+
+	_, err := client.GetProfile(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, auth.unauthorized)
+	assert.Len(t, headers, 2)
+	assert.Equal(t, "good", headers[1].Get("X-Signature"))
+	assert.Empty(t, headers[1].Get("Authorization"))
+
+	u, err := url.Parse(client.MakeUploadDownloadURL(MakeUploadDownloadURLParams{UploadID: 3}))
+	assert.NoError(t, err)
+	assert.Equal(t, "good", u.Query().Get("signature"), "URL builders use the authenticator")
+}
+
+func TestBuiltinAuthenticators(t *testing.T) {
+	var lastHeader atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastHeader.Store(r.Header.Clone())
+		_, _ = w.Write([]byte(`{"user":{"id":1}}`))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	client := newTestKeyClient(server)
+	_, err := client.GetProfile(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "APIKEY", lastHeader.Load().(http.Header).Get("Authorization"))
+	assert.Contains(t, client.MakeBuildFileDownloadURL(MakeBuildFileDownloadURLParams{BuildID: 1, FileID: 2}), "api_key=APIKEY")
+
+	anonymous := client.With(WithAuthenticator(Anonymous))
+	_, err = anonymous.GetProfile(ctx)
+	assert.NoError(t, err)
+	_, hasAuth := lastHeader.Load().(http.Header)["Authorization"]
+	assert.False(t, hasAuth)
+	assert.NotContains(t, anonymous.MakeBuildFileDownloadURL(MakeBuildFileDownloadURLParams{BuildID: 1, FileID: 2}), "api_key")
+
+	assert.NotEqual(t, KeyAuth("a").Identity(), KeyAuth("b").Identity())
+	assert.NotContains(t, KeyAuth("secret").Identity(), "secret")
+}
+
+func TestOAuthIdentitySurvivesRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"accessToken":"refreshed","expiresIn":300}`))
+	}))
+	defer server.Close()
+
+	client := newTestOAuthClient(t, server, &OAuthCredentials{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	}, OAuthConfig{ClientID: "client"})
+
+	ctx := context.Background()
+	before := client.authIdentity(ctx)
+	assert.NoError(t, client.refreshTokenIfNeeded(ctx))
+	assert.Equal(t, "refreshed", client.oauthAuthenticator().Credentials().AccessToken)
+	assert.Equal(t, before, client.authIdentity(ctx), "cached responses stay valid across refreshes")
+}
+
+func TestIdentitiesAreStable(t *testing.T) {
+	creds := &OAuthCredentials{AccessToken: "access", RefreshToken: "refresh"}
+	config := OAuthConfig{ClientID: "client"}
+	a := NewOAuthAuthenticator(creds, config)
+	assert.Equal(t, a.Identity(), NewOAuthAuthenticator(creds, config).Identity(), "identities survive restarts")
+	assert.NotContains(t, a.Identity(), "refresh")
+	assert.NotEqual(t, a.Identity(), NewOAuthAuthenticator(creds, OAuthConfig{ClientID: "other"}).Identity())
+
+	before := a.Identity()
+	assert.NoError(t, a.SetCredentials(&OAuthCredentials{AccessToken: "access2", RefreshToken: "refresh2"}))
+	assert.NotEqual(t, before, a.Identity(), "new sessions may be for another user")
+
+	config.Identity = "user-1"
+	assert.Equal(t, "oauth:user-1", NewOAuthAuthenticator(creds, config).Identity())
+
+	parent := ClientWithKey("PARENT")
+	params := SubkeyParams{GameID: 42, Scope: "profile:me"}
+	subkey := NewSubkeyAuthenticator(parent, params, 0)
+	assert.Equal(t, subkey.Identity(), NewSubkeyAuthenticator(parent, params, 0).Identity())
+	assert.NotEqual(t, subkey.Identity(), NewSubkeyAuthenticator(parent, SubkeyParams{GameID: 43, Scope: "profile:me"}, 0).Identity())
+	assert.NotEqual(t, subkey.Identity(), NewSubkeyAuthenticator(ClientWithKey("OTHER"), params, 0).Identity())
+	assert.NotEqual(t, subkey.Identity(), parent.authIdentity(context.Background()))
+}
+
+func TestSubkeyAuthenticator(t *testing.T) {
+	var subkeys int32
+	var mu sync.Mutex
+	revoked := map[string]bool{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/credentials/subkey":
+			assert.Equal(t, "PARENT", auth)
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, "42", r.PostForm.Get("game_id"))
+			n := atomic.AddInt32(&subkeys, 1)
+			expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+			_, _ = fmt.Fprintf(w, `{"key":"subkey-%d","expires_at":%q}`, n, expiresAt)
+		default:
+			mu.Lock()
+			defer mu.Unlock()
+			if revoked[auth] {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"user":{"id":1,"username":%q}}`, auth)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	parent := newTestKeyClient(server)
+	parent.Key = "PARENT"
+	auth := NewSubkeyAuthenticator(parent, SubkeyParams{GameID: 42, Scope: "profile:me"}, 0)
+	client := parent.With(WithAuthenticator(auth))
+
+	concurrently(4, func(i int) {
+		res, err := client.GetProfile(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "subkey-1", res.User.Username)
+	})
+	assert.EqualValues(t, 1, atomic.LoadInt32(&subkeys), "subkeys are requested once")
+	assert.Contains(t, client.MakeUploadDownloadURL(MakeUploadDownloadURLParams{UploadID: 1}), "api_key=subkey-1")
+
+	mu.Lock()
+	revoked["subkey-1"] = true
+	mu.Unlock()
+	res, err := client.GetProfile(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "subkey-2", res.User.Username, "rejected subkeys are renewed")
+
+	auth.mu.Lock()
+	auth.expiresAt = time.Now().Add(time.Minute)
+	auth.mu.Unlock()
+
+	res, err = client.GetProfile(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "subkey-3", res.User.Username, "subkeys about to expire are renewed")
+	assert.EqualValues(t, 3, atomic.LoadInt32(&subkeys))
+}
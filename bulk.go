@@ -0,0 +1,216 @@
+package itchio
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultBulkConcurrency is how many requests bulk fetches
+// have in flight at once, unless specified otherwise.
+const DefaultBulkConcurrency = 4
+
+// ErrBulkSkipped is the error of items a fail-fast bulk fetch
+// didn't fetch, because another item failed first.
+var ErrBulkSkipped = errors.New("skipped after another item failed")
+
+// BulkFailurePolicy decides what bulk fetches do when fetching an item fails
+type BulkFailurePolicy int
+
+const (
+	// BulkCollectAll fetches every item, and reports errors per item
+	BulkCollectAll BulkFailurePolicy = iota
+	// BulkFailFast stops at the first error: requests in flight are canceled,
+	// and the remaining items are skipped.
+	BulkFailFast
+)
+
+// BulkOptions configures bulk fetches like GetGames
+type BulkOptions struct {
+	// Concurrency is how many requests are in flight at once.
+	// Defaults to DefaultBulkConcurrency.
+	Concurrency int
+	// FailurePolicy defaults to BulkCollectAll
+	FailurePolicy BulkFailurePolicy
+}
+
+// bulkFetch calls fetch for every distinct ID, from a bounded pool of workers.
+// Results are in the order IDs first appear in ids. Requests go through the
+// client as usual, so they're rate-limited and retried like any other.
+//
+// The returned error is the first one encountered, in fail-fast mode.
+func bulkFetch(ctx context.Context, ids []int64, opts BulkOptions, fetch func(ctx context.Context, id int64) (interface{}, error)) ([]int64, []interface{}, []error, error) {
+	ids = dedupeIDs(ids)
+	values := make([]interface{}, len(ids))
+	errs := make([]error, len(ids))
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBulkConcurrency
+	}
+	if concurrency > len(ids) {
+		concurrency = len(ids)
+	}
+
+	bulkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		firstErrOnce sync.Once
+		firstErr     error
+		failed       = make(chan struct{})
+	)
+	fail := func(err error) {
+		firstErrOnce.Do(func() {
+			firstErr = err
+			close(failed)
+			cancel()
+		})
+	}
+	hasFailed := func() bool {
+		select {
+		case <-failed:
+			return true
+		default:
+			return false
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if hasFailed() {
+					errs[i] = ErrBulkSkipped
+					continue
+				}
+
+				values[i], errs[i] = fetch(bulkCtx, ids[i])
+				if errs[i] == nil {
+					continue
+				}
+				if hasFailed() && ctx.Err() == nil && errors.Is(errs[i], context.Canceled) {
+					// canceled because another item failed first
+					values[i], errs[i] = nil, ErrBulkSkipped
+					continue
+				}
+				if opts.FailurePolicy == BulkFailFast {
+					fail(errs[i])
+				}
+			}
+		}()
+	}
+
+	for i := range ids {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return ids, values, errs, firstErr
+}
+
+func dedupeIDs(ids []int64) []int64 {
+	seen := make(map[int64]struct{}, len(ids))
+	res := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		res = append(res, id)
+	}
+	return res
+}
+
+//-------------------------------------------------------
+
+// GameResult is the outcome of fetching one game with GetGames
+type GameResult struct {
+	GameID int64
+	Game   *Game
+	Err    error
+}
+
+// GetGames fetches several games concurrently, with GetGame. Duplicate IDs
+// are only fetched once, and results are in the order IDs first appear.
+//
+// Errors are reported per item. With BulkFailFast, the first error
+// is also returned, and items that weren't fetched have ErrBulkSkipped.
+func (c *Client) GetGames(ctx context.Context, gameIDs []int64, bulkOpts BulkOptions, opts ...CallOption) ([]GameResult, error) {
+	ids, values, errs, err := bulkFetch(ctx, gameIDs, bulkOpts, func(ctx context.Context, id int64) (interface{}, error) {
+		res, err := c.GetGame(ctx, GetGameParams{GameID: id}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return res.Game, nil
+	})
+
+	results := make([]GameResult, len(ids))
+	for i, id := range ids {
+		results[i] = GameResult{GameID: id, Err: errs[i]}
+		results[i].Game, _ = values[i].(*Game)
+	}
+	return results, err
+}
+
+//-------------------------------------------------------
+
+// GameUploadsResult is the outcome of listing the uploads
+// of one game with ListUploadsForGames
+type GameUploadsResult struct {
+	GameID  int64
+	Uploads []*Upload
+	Err     error
+}
+
+// ListUploadsForGames lists the uploads of several games concurrently, with
+// ListGameUploads. It works like GetGames.
+func (c *Client) ListUploadsForGames(ctx context.Context, gameIDs []int64, bulkOpts BulkOptions, opts ...CallOption) ([]GameUploadsResult, error) {
+	ids, values, errs, err := bulkFetch(ctx, gameIDs, bulkOpts, func(ctx context.Context, id int64) (interface{}, error) {
+		res, err := c.ListGameUploads(ctx, ListGameUploadsParams{GameID: id}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return res.Uploads, nil
+	})
+
+	results := make([]GameUploadsResult, len(ids))
+	for i, id := range ids {
+		results[i] = GameUploadsResult{GameID: id, Err: errs[i]}
+		results[i].Uploads, _ = values[i].([]*Upload)
+	}
+	return results, err
+}
+
+//-------------------------------------------------------
+
+// BuildResult is the outcome of fetching one build with GetBuilds
+type BuildResult struct {
+	BuildID int64
+	Build   *Build
+	Err     error
+}
+
+// GetBuilds fetches several builds concurrently, with GetBuild.
+// It works like GetGames.
+func (c *Client) GetBuilds(ctx context.Context, buildIDs []int64, bulkOpts BulkOptions, opts ...CallOption) ([]BuildResult, error) {
+	ids, values, errs, err := bulkFetch(ctx, buildIDs, bulkOpts, func(ctx context.Context, id int64) (interface{}, error) {
+		res, err := c.GetBuild(ctx, GetBuildParams{BuildID: id}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return res.Build, nil
+	})
+
+	results := make([]BuildResult, len(ids))
+	for i, id := range ids {
+		results[i] = BuildResult{BuildID: id, Err: errs[i]}
+		results[i].Build, _ = values[i].(*Build)
+	}
+	return results, err
+}
@@ -0,0 +1,129 @@
+package itchio
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// newBulkServer serves games and their uploads, keeping track of how many
+// requests are in flight. Games with an ID over 100 don't exist.
+func newBulkServer(delay time.Duration, inFlight *int32, maxInFlight *int32, requests *sync.Map) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(inFlight, 1)
+		defer atomic.AddInt32(inFlight, -1)
+		for {
+			max := atomic.LoadInt32(maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(maxInFlight, max, n) {
+				break
+			}
+		}
+
+		count, _ := requests.LoadOrStore(r.URL.Path, new(int32))
+		atomic.AddInt32(count.(*int32), 1)
+
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+
+		var id int64
+		_, _ = fmt.Sscanf(r.URL.Path, "/games/%d", &id)
+		if id > 100 {
+			w.WriteHeader(404)
+			_, _ = w.Write([]byte(`{"errors":["not found"]}`))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/uploads") {
+			_, _ = fmt.Fprintf(w, `{"uploads":[{"id":%d}]}`, id*10)
+		} else {
+			_, _ = fmt.Fprintf(w, `{"game":{"id":%d}}`, id)
+		}
+	}))
+}
+
+func TestGetGames(t *testing.T) {
+	var inFlight, maxInFlight int32
+	var requests sync.Map
+	server := newBulkServer(10*time.Millisecond, &inFlight, &maxInFlight, &requests)
+	defer server.Close()
+	client := newTestKeyClient(server)
+
+	ids := []int64{1, 2, 3, 2, 4, 5, 101, 6, 1, 7, 8}
+	results, err := client.GetGames(context.Background(), ids, BulkOptions{Concurrency: 3})
+	assert.NoError(t, err, "errors are reported per item by default")
+	assert.EqualValues(t, 3, atomic.LoadInt32(&maxInFlight))
+
+	var gotIDs []int64
+	for _, res := range results {
+		gotIDs = append(gotIDs, res.GameID)
+		if res.GameID == 101 {
+			assert.True(t, errors.Is(res.Err, ErrNotFound))
+			assert.Nil(t, res.Game)
+		} else {
+			assert.NoError(t, res.Err)
+			assert.EqualValues(t, res.GameID, res.Game.ID)
+		}
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4, 5, 101, 6, 7, 8}, gotIDs)
+
+	count, _ := requests.Load("/games/1")
+	assert.EqualValues(t, 1, atomic.LoadInt32(count.(*int32)), "duplicate IDs are fetched once")
+}
+
+func TestGetGamesFailFast(t *testing.T) {
+	var inFlight, maxInFlight int32
+	var requests sync.Map
+	server := newBulkServer(20*time.Millisecond, &inFlight, &maxInFlight, &requests)
+	defer server.Close()
+	client := newTestKeyClient(server)
+
+	ids := []int64{101, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	results, err := client.GetGames(context.Background(), ids, BulkOptions{
+		Concurrency:   2,
+		FailurePolicy: BulkFailFast,
+	})
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(results[0].Err, ErrNotFound))
+
+	skipped := 0
+	for _, res := range results[1:] {
+		if res.Err != nil {
+			assert.Equal(t, ErrBulkSkipped, res.Err)
+			skipped++
+		}
+	}
+	assert.True(t, skipped >= 7, "most items are skipped, got %d", skipped)
+}
+
+func TestListUploadsForGames(t *testing.T) {
+	var inFlight, maxInFlight int32
+	var requests sync.Map
+	server := newBulkServer(0, &inFlight, &maxInFlight, &requests)
+	defer server.Close()
+	client := newTestKeyClient(server)
+
+	results, err := client.ListUploadsForGames(context.Background(), []int64{3, 4}, BulkOptions{})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 2) {
+		assert.EqualValues(t, 3, results[0].GameID)
+		assert.EqualValues(t, 30, results[0].Uploads[0].ID)
+		assert.EqualValues(t, 40, results[1].Uploads[0].ID)
+	}
+
+	results, err = client.ListUploadsForGames(context.Background(), nil, BulkOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
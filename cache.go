@@ -0,0 +1,387 @@
+package itchio
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A Cache stores API responses, so clients can avoid refetching resources
+// that haven't changed. See NewMemoryCache and NewDiskCache.
+//
+// Implementations must be safe for concurrent use. Entries handed
+// to Set or returned by Get must not be modified afterwards.
+type Cache interface {
+	// Get returns the entry stored under key, if any
+	Get(key string) (*CacheEntry, bool)
+	// Set stores an entry under key, replacing any previous one
+	Set(key string, entry *CacheEntry)
+	// Invalidate deletes all entries for which match returns true
+	Invalidate(match func(entry *CacheEntry) bool)
+}
+
+// A CacheEntry is a successful API response, stored by a Cache
+type CacheEntry struct {
+	// Identity identifies the credentials the response was obtained with.
+	// Responses are never shared between identities.
+	Identity string `json:"identity"`
+	// URL the response was obtained from, with secrets masked (see RedactURL),
+	// since caches may persist entries
+	URL string `json:"url"`
+	// Path is URL's path, relative to the client's BaseURL, for invalidation
+	Path   string      `json:"path"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	// StoredAt is when the response was received, or last revalidated
+	StoredAt time.Time `json:"storedAt"`
+}
+
+// cacheKey is what responses are stored under: the same URL may return
+// different data for different users, or with different headers.
+func cacheKey(identity string, variant string, url string) string {
+	return identity + " " + variant + " " + url
+}
+
+func (e *CacheEntry) clone() *CacheEntry {
+	clone := *e
+	clone.Header = e.Header.Clone()
+	return &clone
+}
+
+// isFresh returns true if the entry can be used without revalidating it,
+// according to its Cache-Control or Expires headers.
+func (e *CacheEntry) isFresh(now time.Time) bool {
+	directives := parseCacheControl(e.Header)
+	if _, ok := directives["no-cache"]; ok {
+		return false
+	}
+	if maxAge, ok := directives["max-age"]; ok {
+		seconds, err := strconv.ParseInt(maxAge, 10, 64)
+		return err == nil && now.Before(e.StoredAt.Add(time.Duration(seconds)*time.Second))
+	}
+	if expires := e.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		return err == nil && now.Before(t)
+	}
+	return false
+}
+
+// setValidators adds conditional headers to req, so the server
+// can respond with 304 Not Modified if the entry is still valid.
+func (e *CacheEntry) setValidators(req *http.Request) bool {
+	ok := false
+	if etag := e.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+		ok = true
+	}
+	if lastModified := e.Header.Get("Last-Modified"); lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+		ok = true
+	}
+	return ok
+}
+
+// isCacheable returns true if a response may be stored, and
+// is worth storing: it's fresh for a while, or can be revalidated.
+func isCacheable(res *http.Response) bool {
+	if res.StatusCode != http.StatusOK {
+		return false
+	}
+	directives := parseCacheControl(res.Header)
+	if _, ok := directives["no-store"]; ok {
+		return false
+	}
+	if maxAge, ok := directives["max-age"]; ok && maxAge != "0" {
+		return true
+	}
+	return res.Header.Get("Expires") != "" || res.Header.Get("ETag") != "" || res.Header.Get("Last-Modified") != ""
+}
+
+func parseCacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header["Cache-Control"] {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, arg := part, ""
+			if i := strings.IndexByte(part, '='); i >= 0 {
+				name, arg = part[:i], strings.Trim(part[i+1:], `"`)
+			}
+			directives[strings.ToLower(name)] = arg
+		}
+	}
+	return directives
+}
+
+// isUnreachableError returns true for errors that mean the API couldn't be
+// reached, as opposed to authentication failures, or requests that can't
+// be sent at all
+func isUnreachableError(err error) bool {
+	return requestNotSent(err) || isTransientError(err)
+}
+
+// isUnavailableStatus returns true for statuses that mean the API
+// couldn't be reached, rather than that the request was wrong
+func isUnavailableStatus(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// staleFallbackRetryPolicy is how requests are retried when there's a
+// stale response to fall back to: briefly, so it's served promptly when
+// the API is unreachable, while still riding out short rate limits
+var staleFallbackRetryPolicy = &BackoffRetryPolicy{
+	Delays:        []time.Duration{250 * time.Millisecond},
+	MaxRetryAfter: time.Second,
+}
+
+// cachedGet performs a GET request like getResponse, but serves fresh
+// responses from the client's Cache, revalidates stale ones, and falls back
+// to stale ones when the API can't be reached.
+func (c *Client) cachedGet(ctx context.Context, url string, dst interface{}) error {
+	logger := c.logger()
+	key := cacheKey(c.authIdentity(ctx), callOptionsFromContext(ctx).variant(), url)
+	entry, cached := c.Cache.Get(key)
+	if cached && entry.isFresh(time.Now()) {
+		logger.Log(ctx, LogLevelInfo, "cache hit", "url", entry.URL)
+		if meta := responseMetaFromContext(ctx); meta != nil {
+			*meta = ResponseMeta{StatusCode: http.StatusOK, Header: entry.Header, FromCache: true}
+		}
+		return c.parseCachedResponse(ctx, url, entry, dst)
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	if cached && !entry.setValidators(req) && !entry.isStaleUsable() {
+		cached = false
+	}
+	if opts := callOptionsFromContext(ctx); cached && (opts == nil || opts.retryPolicy == nil) {
+		// serve the stale response promptly rather than after the
+		// client's RetryPolicy gives up, unless the call asks for
+		// a specific policy
+		fetchCtx, cancel := withCallOptions(ctx, []CallOption{CallRetryPolicy(staleFallbackRetryPolicy)})
+		defer cancel()
+		req = req.WithContext(fetchCtx)
+	}
+
+	res, err := c.Do(req)
+	if err != nil && !isUnreachableError(err) {
+		// the API may be fine: don't hide authentication failures
+		// and the like behind stale responses
+		return errors.WithStack(err)
+	}
+	if err != nil || isUnavailableStatus(res.StatusCode) {
+		if !cached || ctx.Err() != nil {
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			return errors.WithStack(parseAPIResponse(dst, res, logger, c.schemaDriftCallbacks()))
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+		logger.Log(ctx, LogLevelWarn, "API unreachable, serving stale response", "url", RedactURL(req.URL), "error", err)
+		if meta := responseMetaFromContext(ctx); meta != nil {
+			meta.FromCache = true
+			meta.Stale = true
+		}
+		return c.parseCachedResponse(ctx, url, entry, dst)
+	}
+
+	if res.StatusCode == http.StatusNotModified && cached {
+		res.Body.Close()
+		entry = entry.clone()
+		for k, vv := range res.Header {
+			entry.Header[k] = vv
+		}
+		entry.StoredAt = time.Now()
+		c.Cache.Set(key, entry)
+		if meta := responseMetaFromContext(ctx); meta != nil {
+			meta.FromCache = true
+		}
+		return c.parseCachedResponse(ctx, url, entry, dst)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := parseAPIResponse(dst, res, logger, c.schemaDriftCallbacks()); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if isCacheable(res) {
+		c.Cache.Set(key, &CacheEntry{
+			Identity: c.authIdentity(ctx),
+			URL:      RedactURL(req.URL),
+			Path:     c.apiPath(url),
+			Header:   res.Header.Clone(),
+			Body:     body,
+			StoredAt: time.Now(),
+		})
+	}
+	return nil
+}
+
+// isStaleUsable returns true if an entry without validators
+// can still serve as a fallback when the API is unreachable
+func (e *CacheEntry) isStaleUsable() bool {
+	_, ok := parseCacheControl(e.Header)["no-cache"]
+	return !ok
+}
+
+// parseCachedResponse decodes entry into dst, as if it was the
+// response to a GET request to url
+func (c *Client) parseCachedResponse(ctx context.Context, url string, entry *CacheEntry, dst interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     entry.Header,
+		Body:       ioutil.NopCloser(bytes.NewReader(entry.Body)),
+		Request:    req.WithContext(ctx),
+	}
+	return errors.WithStack(parseAPIResponse(dst, res, c.logger(), c.schemaDriftCallbacks()))
+}
+
+//-------------------------------------------------------
+
+// cacheInvalidations lists which cached responses successful writes
+// make stale, by path prefix, for DefaultCacheInvalidator. Writes that
+// aren't listed invalidate all cached responses for the identity they're
+// made with.
+var cacheInvalidations = []struct {
+	write string
+	stale []string
+}{
+	// builds, build files, events and failures change channels,
+	// uploads and builds.
+	{write: "/wharf/", stale: []string{"/wharf/", "/uploads/", "/builds/", "/games/"}},
+	{write: "/profile/game-sessions", stale: []string{"/profile/game-sessions/"}},
+	{write: "/games/", stale: nil},
+	{write: "/login", stale: nil},
+	{write: "/totp/", stale: nil},
+	{write: "/oauth/", stale: nil},
+	{write: "/credentials/", stale: nil},
+}
+
+// apiPath returns the path of an API url, relative to the client's BaseURL,
+// like "/games/123"
+func (c *Client) apiPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	path := u.Path
+	if base, err := url.Parse(c.BaseURL); err == nil {
+		path = strings.TrimPrefix(path, strings.TrimRight(base.Path, "/"))
+	}
+	return path
+}
+
+// OnWrite is the callback type for successful writes made through a
+// client, like CreateBuild. path is relative to the client's BaseURL, like
+// "/wharf/builds". invalidate deletes the cached responses obtained with
+// the write's credentials for which match returns true, if the client has
+// a Cache.
+type OnWrite func(ctx context.Context, path string, invalidate func(match func(entry *CacheEntry) bool))
+
+// DefaultCacheInvalidator is the CacheInvalidator clients use unless told
+// otherwise. It invalidates the cached responses writes to the itch.io API
+// are known to make stale, and all of them for writes it doesn't know.
+func DefaultCacheInvalidator(ctx context.Context, path string, invalidate func(match func(entry *CacheEntry) bool)) {
+	var stale []string
+	known := false
+	for _, inv := range cacheInvalidations {
+		if strings.HasPrefix(path, inv.write) {
+			stale, known = inv.stale, true
+			break
+		}
+	}
+	if known && len(stale) == 0 {
+		return
+	}
+
+	invalidate(func(entry *CacheEntry) bool {
+		if !known {
+			return true
+		}
+		for _, prefix := range stale {
+			if strings.HasPrefix(entry.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// OnWrite allows registering a function that gets called after every
+// successful write, after the client's CacheInvalidator, for example to
+// invalidate more cached responses. Each call registers an additional
+// callback.
+func (c *Client) OnWrite(cb OnWrite) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// copy-on-write, like Use
+	callbacks := make([]OnWrite, 0, len(c.onWrite)+1)
+	callbacks = append(callbacks, c.onWrite...)
+	callbacks = append(callbacks, cb)
+	c.onWrite = callbacks
+}
+
+// afterWrite runs the client's CacheInvalidator and OnWrite callbacks
+// after a successful write to url, made with identity's credentials
+func (c *Client) afterWrite(ctx context.Context, identity string, url string) {
+	c.mu.RLock()
+	callbacks := c.onWrite
+	c.mu.RUnlock()
+
+	path := c.apiPath(url)
+	invalidate := func(match func(entry *CacheEntry) bool) {
+		if c.Cache == nil {
+			return
+		}
+		c.logger().Log(ctx, LogLevelDebug, "invalidating cache", "path", path)
+		c.Cache.Invalidate(func(entry *CacheEntry) bool {
+			return entry.Identity == identity && match(entry)
+		})
+	}
+
+	invalidator := c.CacheInvalidator
+	if invalidator == nil {
+		invalidator = DefaultCacheInvalidator
+	}
+	invalidator(ctx, path, invalidate)
+	for _, cb := range callbacks {
+		cb(ctx, path, invalidate)
+	}
+}
+
+// InvalidateCache deletes the cached responses for which match returns
+// true, for when they're known to be stale. It does nothing if the client
+// has no Cache.
+func (c *Client) InvalidateCache(match func(entry *CacheEntry) bool) {
+	if c.Cache != nil {
+		c.Cache.Invalidate(match)
+	}
+}
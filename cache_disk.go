@@ -0,0 +1,213 @@
+package itchio
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultDiskCacheSize is how many bytes of responses a DiskCache
+// holds, unless told otherwise
+const DefaultDiskCacheSize = 64 << 20
+
+// A DiskCache is a Cache that stores responses as files in a directory,
+// so they survive restarts. When it grows over its size limit, the least
+// recently used responses are evicted.
+//
+// Cached responses may contain personal information, so the directory
+// is only readable by its owner.
+type DiskCache struct {
+	// size is the total size of the entries, in bytes. It's accessed
+	// atomically, so it comes first, to be 64-bit aligned.
+	size int64
+
+	dir      string
+	maxBytes int64
+	// mu serializes Invalidate and eviction with writes, so they can't
+	// miss an entry being written, or delete one written after the scan.
+	mu sync.RWMutex
+}
+
+var _ Cache = (*DiskCache)(nil)
+
+const diskCacheExt = ".json"
+
+// NewDiskCache returns a cache storing up to maxBytes of responses in
+// dir, which is created if needed, or DefaultDiskCacheSize if maxBytes
+// isn't positive.
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultDiskCacheSize
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	dc := &DiskCache{dir: dir, maxBytes: maxBytes}
+	infos, err := dc.entryInfos()
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		dc.size += info.Size()
+	}
+	if dc.size > dc.maxBytes {
+		dc.evict()
+	}
+	return dc, nil
+}
+
+// entryPath returns the file an entry is stored in. Keys contain URLs,
+// which may contain credentials, so they're hashed.
+func (dc *DiskCache) entryPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dc.dir, hex.EncodeToString(sum[:])+diskCacheExt)
+}
+
+// Get returns the entry stored under key, if any. Unreadable
+// entries are treated as missing.
+func (dc *DiskCache) Get(key string) (*CacheEntry, bool) {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+
+	path := dc.entryPath(key)
+	entry, err := readDiskCacheEntry(path)
+	if err != nil {
+		return nil, false
+	}
+	// the modification time tells eviction which entries were used last
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return entry, true
+}
+
+// Set stores an entry under key, evicting the least recently used
+// entries if the cache is full. Errors are ignored: the response will
+// simply be fetched again next time.
+func (dc *DiskCache) Set(key string, entry *CacheEntry) {
+	if dc.write(key, entry) && atomic.LoadInt64(&dc.size) > dc.maxBytes {
+		dc.evict()
+	}
+}
+
+// write stores an entry under key, and returns true if it succeeded
+func (dc *DiskCache) write(key string, entry *CacheEntry) bool {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return false
+	}
+
+	// write to a temporary file first, so readers never see a partial entry
+	path := dc.entryPath(key)
+	tmp, err := ioutil.TempFile(dc.dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return false
+	}
+	_, err = tmp.Write(payload)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	var replaced int64
+	if info, statErr := os.Stat(path); statErr == nil {
+		replaced = info.Size()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return false
+	}
+	atomic.AddInt64(&dc.size, int64(len(payload))-replaced)
+	return true
+}
+
+// evict deletes the least recently used entries until the cache is 10%
+// under its size limit, so it doesn't have to scan it on every Set
+func (dc *DiskCache) evict() {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	infos, err := dc.entryInfos()
+	if err != nil {
+		return
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+
+	var size int64
+	for _, info := range infos {
+		size += info.Size()
+	}
+	target := dc.maxBytes - dc.maxBytes/10
+	for _, info := range infos {
+		if size <= target {
+			break
+		}
+		if err := os.Remove(filepath.Join(dc.dir, info.Name())); err == nil {
+			size -= info.Size()
+		}
+	}
+	atomic.StoreInt64(&dc.size, size)
+}
+
+// Invalidate deletes all entries for which match returns true
+func (dc *DiskCache) Invalidate(match func(entry *CacheEntry) bool) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	infos, err := dc.entryInfos()
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		path := filepath.Join(dc.dir, info.Name())
+		entry, err := readDiskCacheEntry(path)
+		if err != nil || match(entry) {
+			if os.Remove(path) == nil {
+				atomic.AddInt64(&dc.size, -info.Size())
+			}
+		}
+	}
+}
+
+// entryInfos lists the files entries are stored in
+func (dc *DiskCache) entryInfos() ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(dc.dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	entries := infos[:0]
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), diskCacheExt) {
+			entries = append(entries, info)
+		}
+	}
+	return entries, nil
+}
+
+func readDiskCacheEntry(path string) (*CacheEntry, error) {
+	payload, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entry := &CacheEntry{}
+	if err := json.Unmarshal(payload, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
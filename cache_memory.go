@@ -0,0 +1,95 @@
+package itchio
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultMemoryCacheSize is how many responses a MemoryCache holds,
+// unless told otherwise
+const DefaultMemoryCacheSize = 256
+
+// A MemoryCache is a Cache that holds a bounded number of
+// responses in memory, evicting the least recently used ones.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	lru        *list.List
+	items      map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+var _ Cache = (*MemoryCache)(nil)
+
+// NewMemoryCache returns a cache holding up to maxEntries responses,
+// or DefaultMemoryCacheSize if maxEntries isn't positive
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMemoryCacheSize
+	}
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get returns the entry stored under key, if any
+func (mc *MemoryCache) Get(key string) (*CacheEntry, bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	el, ok := mc.items[key]
+	if !ok {
+		return nil, false
+	}
+	mc.lru.MoveToFront(el)
+	return el.Value.(*memoryCacheItem).entry, true
+}
+
+// Set stores an entry under key, evicting the least
+// recently used entry if the cache is full
+func (mc *MemoryCache) Set(key string, entry *CacheEntry) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if el, ok := mc.items[key]; ok {
+		el.Value.(*memoryCacheItem).entry = entry
+		mc.lru.MoveToFront(el)
+		return
+	}
+
+	mc.items[key] = mc.lru.PushFront(&memoryCacheItem{key: key, entry: entry})
+	for mc.lru.Len() > mc.maxEntries {
+		oldest := mc.lru.Back()
+		mc.lru.Remove(oldest)
+		delete(mc.items, oldest.Value.(*memoryCacheItem).key)
+	}
+}
+
+// Invalidate deletes all entries for which match returns true
+func (mc *MemoryCache) Invalidate(match func(entry *CacheEntry) bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	for el := mc.lru.Front(); el != nil; {
+		next := el.Next()
+		item := el.Value.(*memoryCacheItem)
+		if match(item.entry) {
+			mc.lru.Remove(el)
+			delete(mc.items, item.key)
+		}
+		el = next
+	}
+}
+
+// Len returns how many responses are cached
+func (mc *MemoryCache) Len() int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.lru.Len()
+}
@@ -0,0 +1,328 @@
+package itchio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newCachingServer serves games with an ETag, honouring If-None-Match,
+// and fails with 503 while unavailable is set
+func newCachingServer(requests *int32, unavailable *int32, cacheControl string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if atomic.LoadInt32(unavailable) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		switch r.URL.Path {
+		case "/wharf/builds":
+			_, _ = w.Write([]byte(`{"build":{"id":9}}`))
+			return
+		case "/wharf/channels":
+			w.Header().Set("ETag", `"channels"`)
+			if r.Header.Get("If-None-Match") == `"channels"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			_, _ = w.Write([]byte(`{"channels":{}}`))
+			return
+		}
+
+		etag := fmt.Sprintf(`"%s"`, r.Header.Get("Authorization"))
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"game":{"id":3,"title":"Cached for %s"}}`, r.Header.Get("Authorization"))
+	}))
+}
+
+func TestCacheRevalidate(t *testing.T) {
+	var requests, unavailable int32
+	server := newCachingServer(&requests, &unavailable, "")
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+	client.RetryPolicy = NoRetry
+	client.Cache = NewMemoryCache(0)
+	ctx := context.Background()
+
+	var meta ResponseMeta
+	res, err := client.GetGame(WithResponseMeta(ctx, &meta), GetGameParams{GameID: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, "Cached for APIKEY", res.Game.Title)
+	assert.False(t, meta.FromCache)
+
+	res, err = client.GetGame(WithResponseMeta(ctx, &meta), GetGameParams{GameID: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, "Cached for APIKEY", res.Game.Title)
+	assert.True(t, meta.FromCache, "304 responses are served from the cache")
+	assert.Equal(t, http.StatusNotModified, meta.StatusCode)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&requests), "responses without a lifetime are revalidated")
+
+	other := newTestKeyClient(server)
+	other.Key = "OTHERKEY"
+	other.Cache = client.Cache
+	res, err = other.GetGame(ctx, GetGameParams{GameID: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, "Cached for OTHERKEY", res.Game.Title, "responses aren't shared between identities")
+
+	atomic.StoreInt32(&unavailable, 1)
+	atomic.StoreInt32(&requests, 0)
+	client.RetryPolicy = &BackoffRetryPolicy{Delays: []time.Duration{time.Hour}}
+	res, err = client.GetGame(WithResponseMeta(ctx, &meta), GetGameParams{GameID: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, "Cached for APIKEY", res.Game.Title)
+	assert.True(t, meta.Stale, "stale responses are served when the API is unavailable")
+	assert.EqualValues(t, 2, atomic.LoadInt32(&requests), "stale responses are served after a short retry")
+	client.RetryPolicy = NoRetry
+
+	_, err = client.GetGame(ctx, GetGameParams{GameID: 4})
+	assert.Error(t, err, "there's no fallback for uncached responses")
+
+	server.Close()
+	res, err = client.GetGame(WithResponseMeta(ctx, &meta), GetGameParams{GameID: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, "Cached for APIKEY", res.Game.Title)
+	assert.True(t, meta.Stale, "stale responses are served when the API is unreachable")
+
+	client.Auth = loggedOutAuth{KeyAuth("APIKEY")}
+	_, err = client.GetGame(ctx, GetGameParams{GameID: 3})
+	assert.True(t, errors.Is(err, ErrReauthRequired), "authentication failures aren't hidden by stale responses")
+}
+
+// loggedOutAuth has the identity of a key, but can't authenticate anymore
+type loggedOutAuth struct {
+	KeyAuth
+}
+
+func (loggedOutAuth) Authenticate(ctx context.Context, c *Client, req *http.Request) error {
+	return ErrReauthRequired
+}
+
+func TestCacheFresh(t *testing.T) {
+	var requests, unavailable int32
+	server := newCachingServer(&requests, &unavailable, "private, max-age=60")
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+	client.Cache = NewMemoryCache(0)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		var meta ResponseMeta
+		res, err := client.GetGame(WithResponseMeta(ctx, &meta), GetGameParams{GameID: 3})
+		assert.NoError(t, err)
+		assert.Equal(t, "Cached for APIKEY", res.Game.Title)
+		assert.Equal(t, i > 0, meta.FromCache)
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&requests), "fresh responses are served without a request")
+
+	noStore := newCachingServer(&requests, &unavailable, "no-store")
+	defer noStore.Close()
+	client.BaseURL = noStore.URL
+	atomic.StoreInt32(&requests, 0)
+	for i := 0; i < 2; i++ {
+		_, err := client.GetGame(ctx, GetGameParams{GameID: 3})
+		assert.NoError(t, err)
+	}
+	assert.EqualValues(t, 2, atomic.LoadInt32(&requests), "no-store responses aren't cached")
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	var requests, unavailable int32
+	server := newCachingServer(&requests, &unavailable, "max-age=60")
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+	client.Cache = NewMemoryCache(0)
+	ctx := context.Background()
+
+	get := func() {
+		_, err := client.GetGame(ctx, GetGameParams{GameID: 3})
+		assert.NoError(t, err)
+		_, err = client.ListChannels(ctx, "me/game")
+		assert.NoError(t, err)
+	}
+
+	get()
+	get()
+	assert.EqualValues(t, 2, atomic.LoadInt32(&requests))
+
+	_, err := client.CreateBuild(ctx, CreateBuildParams{Target: "me/game", Channel: "linux"})
+	assert.NoError(t, err)
+	atomic.StoreInt32(&requests, 0)
+	get()
+	assert.EqualValues(t, 2, atomic.LoadInt32(&requests), "builds invalidate games and channels")
+
+	_, err = client.NewDownloadSession(ctx, NewDownloadSessionParams{GameID: 3})
+	assert.NoError(t, err)
+	atomic.StoreInt32(&requests, 0)
+	get()
+	assert.EqualValues(t, 0, atomic.LoadInt32(&requests), "download sessions don't invalidate anything")
+
+	client.InvalidateCache(func(entry *CacheEntry) bool { return entry.Path == "/games/3" })
+	atomic.StoreInt32(&requests, 0)
+	get()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+
+	// download sessions change what the game page shows, say
+	var writes []string
+	client.CacheInvalidator = func(ctx context.Context, path string, invalidate func(match func(entry *CacheEntry) bool)) {
+		if strings.HasPrefix(path, "/games/") {
+			invalidate(func(entry *CacheEntry) bool { return strings.HasPrefix(entry.Path, "/games/") })
+			return
+		}
+		DefaultCacheInvalidator(ctx, path, invalidate)
+	}
+	client.OnWrite(func(ctx context.Context, path string, invalidate func(match func(entry *CacheEntry) bool)) {
+		writes = append(writes, path)
+	})
+	_, err = client.NewDownloadSession(ctx, NewDownloadSessionParams{GameID: 3})
+	assert.NoError(t, err)
+	atomic.StoreInt32(&requests, 0)
+	get()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&requests), "invalidators can be replaced")
+	assert.Equal(t, []string{"/games/3/download-sessions"}, writes)
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	mc := NewMemoryCache(2)
+	mc.Set("a", &CacheEntry{URL: "a"})
+	mc.Set("b", &CacheEntry{URL: "b"})
+	_, ok := mc.Get("a")
+	assert.True(t, ok)
+
+	mc.Set("c", &CacheEntry{URL: "c"})
+	assert.Equal(t, 2, mc.Len())
+	_, ok = mc.Get("b")
+	assert.False(t, ok, "the least recently used entry is evicted")
+	_, ok = mc.Get("a")
+	assert.True(t, ok)
+}
+
+func TestDiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "itchio-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	dc, err := NewDiskCache(dir, 0)
+	assert.NoError(t, err)
+
+	_, ok := dc.Get("missing")
+	assert.False(t, ok)
+
+	storedAt := time.Now().Truncate(time.Second)
+	dc.Set("key", &CacheEntry{
+		Identity: "me",
+		URL:      "https://api.itch.io/games/3?api_key=secret",
+		Path:     "/games/3",
+		Header:   http.Header{"Etag": []string{`"abc"`}},
+		Body:     []byte(`{"game":{}}`),
+		StoredAt: storedAt,
+	})
+
+	reopened, err := NewDiskCache(dir, 0)
+	assert.NoError(t, err)
+	entry, ok := reopened.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, `"abc"`, entry.Header.Get("ETag"))
+	assert.Equal(t, `{"game":{}}`, string(entry.Body))
+	assert.True(t, storedAt.Equal(entry.StoredAt))
+
+	infos, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+	assert.NotContains(t, infos[0].Name(), "secret")
+
+	reopened.Invalidate(func(entry *CacheEntry) bool { return entry.Identity == "me" })
+	_, ok = dc.Get("key")
+	assert.False(t, ok)
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "itchio-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	entry := &CacheEntry{Identity: "me", Path: "/games/3", Body: []byte(`{"game":{}}`)}
+	payload, err := json.Marshal(entry)
+	assert.NoError(t, err)
+	entrySize := int64(len(payload))
+
+	// room for three and a half entries
+	dc, err := NewDiskCache(dir, entrySize*7/2)
+	assert.NoError(t, err)
+	now := time.Now()
+	for i, key := range []string{"a", "b", "c"} {
+		dc.Set(key, entry)
+		used := now.Add(time.Duration(i-3) * time.Minute)
+		assert.NoError(t, os.Chtimes(dc.entryPath(key), used, used))
+	}
+	_, ok := dc.Get("a")
+	assert.True(t, ok)
+
+	dc.Set("d", entry)
+	for _, key := range []string{"a", "c", "d"} {
+		_, ok := dc.Get(key)
+		assert.True(t, ok, "%s should be kept", key)
+	}
+	_, ok = dc.Get("b")
+	assert.False(t, ok, "the least recently used entry is evicted")
+	assert.Equal(t, 3*entrySize, atomic.LoadInt64(&dc.size))
+
+	reopened, err := NewDiskCache(dir, entrySize)
+	assert.NoError(t, err)
+	infos, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, infos, 0, "lowering the limit evicts entries")
+	assert.EqualValues(t, 0, atomic.LoadInt64(&reopened.size))
+}
+
+func TestDiskCacheRedactsCredentials(t *testing.T) {
+	var requests, unavailable int32
+	server := newCachingServer(&requests, &unavailable, "max-age=60")
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "itchio-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	client := newTestKeyClient(server)
+	client.Cache, err = NewDiskCache(dir, 0)
+	assert.NoError(t, err)
+
+	params := GetGameParams{GameID: 3, Credentials: GameCredentials{Password: "hunter2"}}
+	for i := 0; i < 2; i++ {
+		res, err := client.GetGame(context.Background(), params)
+		assert.NoError(t, err)
+		assert.Equal(t, "Cached for APIKEY", res.Game.Title)
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+
+	infos, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+	payload, err := ioutil.ReadFile(filepath.Join(dir, infos[0].Name()))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(payload), "hunter2", "credentials aren't written to disk")
+}
@@ -0,0 +1,174 @@
+package itchio
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A CallOption tweaks a single API call, without affecting other
+// calls made with the same Client. Endpoint methods, Query.Get and
+// Query.Post accept any number of them.
+type CallOption func(o *callOptions)
+
+type callOptions struct {
+	timeout        time.Duration
+	retryPolicy    RetryPolicy
+	header         http.Header
+	acceptLanguage string
+	meta           *ResponseMeta
+	priority       *Priority
+	auth           Authenticator
+}
+
+type callOptionsKeyType struct{}
+
+var callOptionsKey = callOptionsKeyType{}
+
+// CallTimeout bounds how long the call may take, including rate
+// limiting and retries.
+func CallTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = timeout
+	}
+}
+
+// CallRetryPolicy makes the call retry according to policy,
+// instead of the client's RetryPolicy.
+func CallRetryPolicy(policy RetryPolicy) CallOption {
+	return func(o *callOptions) {
+		o.retryPolicy = policy
+	}
+}
+
+// CallNoRetry makes the call fail on the first error, whatever
+// the client's RetryPolicy. OAuth clients still retry once after
+// refreshing an expired token.
+func CallNoRetry() CallOption {
+	return CallRetryPolicy(NoRetry)
+}
+
+// CallHeader sets an additional header on the call's requests. It can
+// override the client's User-Agent or Accept, but not Authorization:
+// use CallAuthenticator or CallKey for that.
+func CallHeader(key string, value string) CallOption {
+	return func(o *callOptions) {
+		if o.header == nil {
+			o.header = make(http.Header)
+		}
+		o.header.Set(key, value)
+	}
+}
+
+// CallAcceptLanguage makes the call request responses in the given
+// languages, instead of the client's AcceptedLanguage.
+func CallAcceptLanguage(acceptLanguage string) CallOption {
+	return func(o *callOptions) {
+		o.acceptLanguage = acceptLanguage
+	}
+}
+
+// CallResponseMeta makes the call record its metadata into meta,
+// like WithResponseMeta. Iterators and bulk fetches make several calls,
+// so it shouldn't be passed to them.
+func CallResponseMeta(meta *ResponseMeta) CallOption {
+	return func(o *callOptions) {
+		o.meta = meta
+	}
+}
+
+// CallPriority sets the call's priority, like WithPriority.
+func CallPriority(priority Priority) CallOption {
+	return func(o *callOptions) {
+		o.priority = &priority
+	}
+}
+
+// CallAuthenticator makes the call authenticate with auth, instead of
+// the client's authenticator, to act on behalf of another user without
+// changing the client. Coalesced and cached responses aren't shared
+// between them.
+func CallAuthenticator(auth Authenticator) CallOption {
+	return func(o *callOptions) {
+		o.auth = auth
+	}
+}
+
+// CallKey makes the call authenticate with an API key,
+// like CallAuthenticator(KeyAuth(key)).
+func CallKey(key string) CallOption {
+	return CallAuthenticator(KeyAuth(key))
+}
+
+// withCallOptions returns a context carrying opts, on top of the call
+// options ctx may already carry. The cancel function must be called
+// once the call is done.
+func withCallOptions(ctx context.Context, opts []CallOption) (context.Context, context.CancelFunc) {
+	if len(opts) == 0 {
+		return ctx, func() {}
+	}
+
+	o := &callOptions{}
+	if parent := callOptionsFromContext(ctx); parent != nil {
+		*o = *parent
+		o.header = parent.header.Clone()
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	ctx = context.WithValue(ctx, callOptionsKey, o)
+
+	if o.auth != nil {
+		ctx = withAuthenticator(ctx, o.auth)
+	}
+	if o.meta != nil {
+		ctx = WithResponseMeta(ctx, o.meta)
+	}
+	if o.priority != nil {
+		ctx = WithPriority(ctx, *o.priority)
+	}
+	if o.timeout > 0 {
+		return context.WithTimeout(ctx, o.timeout)
+	}
+	return ctx, func() {}
+}
+
+func callOptionsFromContext(ctx context.Context) *callOptions {
+	o, _ := ctx.Value(callOptionsKey).(*callOptions)
+	return o
+}
+
+// applyHeaders sets the headers requested by call options on req
+func (o *callOptions) applyHeaders(req *http.Request) {
+	if o == nil {
+		return
+	}
+	if o.acceptLanguage != "" {
+		req.Header.Set("Accept-Language", o.acceptLanguage)
+	}
+	for k, vv := range o.header {
+		if k == "Authorization" {
+			continue
+		}
+		req.Header[k] = vv
+	}
+}
+
+// variant identifies the call options that may change the response to a
+// request, so that coalescing and caching don't mix up responses.
+func (o *callOptions) variant() string {
+	if o == nil {
+		return ""
+	}
+	var parts []string
+	if o.acceptLanguage != "" {
+		parts = append(parts, "Accept-Language: "+o.acceptLanguage)
+	}
+	for k, vv := range o.header {
+		parts = append(parts, k+": "+strings.Join(vv, ", "))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,145 @@
+package itchio
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallOptions(t *testing.T) {
+	var requests int32
+	var mu sync.Mutex
+	var lastHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		mu.Lock()
+		lastHeader = r.Header.Clone()
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/games/1":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/games/2":
+			time.Sleep(100 * time.Millisecond)
+			fallthrough
+		default:
+			_, _ = w.Write([]byte(`{"game":{"id":3}}`))
+		}
+	}))
+	defer server.Close()
+
+	header := func() http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return lastHeader
+	}
+
+	client := newTestKeyClient(server)
+	client.RetryPolicy = &BackoffRetryPolicy{Delays: []time.Duration{time.Millisecond, time.Millisecond}}
+	ctx := context.Background()
+
+	var meta ResponseMeta
+	_, err := client.GetGame(ctx, GetGameParams{GameID: 3},
+		CallHeader("X-Trace", "abc"),
+		CallHeader("User-Agent", "butler"),
+		CallHeader("Authorization", "hijacked"),
+		CallAcceptLanguage("fr"),
+		CallResponseMeta(&meta),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", header().Get("X-Trace"))
+	assert.Equal(t, "butler", header().Get("User-Agent"))
+	assert.Equal(t, "fr", header().Get("Accept-Language"))
+	assert.Equal(t, "APIKEY", header().Get("Authorization"), "call options can't override credentials")
+	assert.Equal(t, 200, meta.StatusCode)
+
+	_, err = client.GetGame(ctx, GetGameParams{GameID: 3})
+	assert.NoError(t, err)
+	assert.Empty(t, header().Get("X-Trace"), "call options only apply to one call")
+	assert.Equal(t, "*", header().Get("Accept-Language"))
+
+	atomic.StoreInt32(&requests, 0)
+	_, err = client.GetGame(ctx, GetGameParams{GameID: 1}, CallNoRetry(), CallResponseMeta(&meta))
+	assert.Error(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+	assert.Equal(t, 1, meta.Attempts)
+
+	atomic.StoreInt32(&requests, 0)
+	_, err = client.GetGame(ctx, GetGameParams{GameID: 1})
+	assert.Error(t, err)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&requests), "the client's retry policy is left alone")
+
+	atomic.StoreInt32(&requests, 0)
+	_, err = client.GetGame(ctx, GetGameParams{GameID: 1}, CallRetryPolicy(&BackoffRetryPolicy{Delays: []time.Duration{time.Millisecond}}))
+	assert.Error(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&requests))
+
+	start := time.Now()
+	_, err = client.GetGame(ctx, GetGameParams{GameID: 2}, CallTimeout(20*time.Millisecond))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+
+	_, err = client.CreateBuild(ctx, CreateBuildParams{Target: "a/b", Channel: "c"}, CallHeader("X-Trace", "post"))
+	assert.NoError(t, err)
+	assert.Equal(t, "post", header().Get("X-Trace"))
+
+	_, err = client.GetGame(ctx, GetGameParams{GameID: 3}, CallKey("OTHERKEY"))
+	assert.NoError(t, err)
+	assert.Equal(t, "OTHERKEY", header().Get("Authorization"))
+	_, err = client.GetGame(ctx, GetGameParams{GameID: 3}, CallAuthenticator(Anonymous))
+	assert.NoError(t, err)
+	assert.Empty(t, header().Get("Authorization"))
+	_, err = client.GetGame(ctx, GetGameParams{GameID: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, "APIKEY", header().Get("Authorization"), "call credentials only apply to one call")
+}
+
+func TestCallAuthenticatorIdentity(t *testing.T) {
+	client := ClientWithKey("APIKEY")
+	ctx := context.Background()
+
+	callCtx, cancel := withCallOptions(ctx, []CallOption{CallKey("OTHERKEY")})
+	defer cancel()
+	assert.Equal(t, KeyAuth("OTHERKEY").Identity(), client.authIdentity(callCtx))
+	assert.NotEqual(t, client.authIdentity(ctx), client.authIdentity(callCtx))
+
+	nestedCtx, cancel := withCallOptions(callCtx, []CallOption{CallHeader("X-Trace", "abc")})
+	defer cancel()
+	assert.Equal(t, client.authIdentity(callCtx), client.authIdentity(nestedCtx))
+}
+
+func TestCallOptionsCoalescing(t *testing.T) {
+	var requests int32
+	server := newSlowGameServer(50*time.Millisecond, &requests)
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+	client.CoalesceRequests = true
+
+	concurrently(4, func(i int) {
+		lang := "en"
+		if i%2 == 1 {
+			lang = "fr"
+		}
+		_, err := client.GetGame(context.Background(), GetGameParams{GameID: 3}, CallAcceptLanguage(lang))
+		assert.NoError(t, err)
+	})
+	assert.EqualValues(t, 2, atomic.LoadInt32(&requests), "requests with different headers aren't shared")
+
+	atomic.StoreInt32(&requests, 0)
+	concurrently(4, func(i int) {
+		key := "APIKEY"
+		if i%2 == 1 {
+			key = "OTHERKEY"
+		}
+		_, err := client.GetGame(context.Background(), GetGameParams{GameID: 3}, CallKey(key))
+		assert.NoError(t, err)
+	})
+	assert.EqualValues(t, 2, atomic.LoadInt32(&requests), "requests with different credentials aren't shared")
+}
@@ -0,0 +1,314 @@
+package itchio
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// CassetteMode is whether a Cassette records or replays interactions
+type CassetteMode int
+
+const (
+	// CassetteReplay serves recorded interactions, without hitting the network
+	CassetteReplay CassetteMode = iota
+	// CassetteRecord performs requests, and records them
+	CassetteRecord
+)
+
+// ErrCassetteMiss is returned (wrapped) by cassettes in replay mode, when
+// no recorded interaction matches a request.
+var ErrCassetteMiss = errors.New("no matching interaction in cassette")
+
+// A Cassette is an http.RoundTripper that records API interactions to a
+// file, and replays them later, for deterministic offline tests:
+//
+//	cassette, err := itchio.NewCassette("testdata/profile.json", itchio.CassetteRecord)
+//	client.HTTPClient = &http.Client{Transport: cassette}
+//	// (make some API calls)
+//	err = cassette.Save()
+//
+// In replay mode, requests are matched on their method, path, query string
+// and form body, in the order they were recorded: each interaction is only
+// served once. The host is ignored, so replayed clients can use any BaseURL.
+//
+// Credentials (the Authorization header, api_key and other secrets from
+// query strings, forms and JSON bodies) are redacted from recordings, and
+// requests are redacted the same way before being matched, so replayed clients
+// don't need the key used for recording. This means that secrets in replayed
+// responses (like API keys returned on login) read as Redacted.
+type Cassette struct {
+	// Transport performs requests in record mode. If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	path string
+	mode CassetteMode
+
+	mu           sync.Mutex
+	interactions []*cassetteInteraction
+	used         []bool
+}
+
+var _ http.RoundTripper = (*Cassette)(nil)
+
+type cassetteFile struct {
+	Version      int                    `json:"version"`
+	Interactions []*cassetteInteraction `json:"interactions"`
+}
+
+type cassetteInteraction struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+}
+
+type cassetteRequest struct {
+	Method string     `json:"method"`
+	Path   string     `json:"path"`
+	Query  url.Values `json:"query,omitempty"`
+	Form   url.Values `json:"form,omitempty"`
+	Body   string     `json:"body,omitempty"`
+}
+
+type cassetteResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+	// Encoding is "base64" for bodies that aren't valid UTF-8
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// NewCassette returns a cassette that records to path, or replays from it.
+// In replay mode, path must exist. In record mode, nothing is written
+// until Save is called.
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	c := &Cassette{path: path, mode: mode}
+	if mode != CassetteReplay {
+		return c, nil
+	}
+
+	payload, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var file cassetteFile
+	if err := json.Unmarshal(payload, &file); err != nil {
+		return nil, errors.Wrapf(err, "reading cassette %s", path)
+	}
+	c.interactions = file.Interactions
+	c.used = make([]bool, len(file.Interactions))
+	return c, nil
+}
+
+// Mode returns whether the cassette records or replays
+func (c *Cassette) Mode() CassetteMode {
+	return c.mode
+}
+
+// Len returns the number of interactions recorded or loaded
+func (c *Cassette) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.interactions)
+}
+
+// Unused returns the number of loaded interactions that haven't been
+// replayed yet, which tests can check to make sure a scenario ran to completion.
+func (c *Cassette) Unused() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for _, used := range c.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+// RoundTrip implements http.RoundTripper
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, body, err := cassetteRequestFrom(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.mode == CassetteReplay {
+		return c.replay(req, recorded)
+	}
+	return c.record(req, recorded, body)
+}
+
+func (c *Cassette) replay(req *http.Request, recorded cassetteRequest) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, interaction := range c.interactions {
+		if c.used[i] || !interaction.Request.matches(recorded) {
+			continue
+		}
+		c.used[i] = true
+		return interaction.Response.toResponse(req)
+	}
+	return nil, errors.Wrapf(ErrCassetteMiss, "%s %s", req.Method, RedactURL(req.URL))
+}
+
+func (c *Cassette) record(req *http.Request, recorded cassetteRequest, body []byte) (*http.Response, error) {
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	// don't consume the caller's body
+	if req.Body != nil {
+		forwarded := *req
+		forwarded.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req = &forwarded
+	}
+
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(payload))
+
+	response := cassetteResponse{
+		Status: res.StatusCode,
+		Header: RedactHeader(res.Header),
+	}
+	payload = RedactBody(res.Header.Get("Content-Type"), payload)
+	if utf8.Valid(payload) {
+		response.Body = string(payload)
+	} else {
+		response.Body = base64.StdEncoding.EncodeToString(payload)
+		response.Encoding = "base64"
+	}
+
+	c.mu.Lock()
+	c.interactions = append(c.interactions, &cassetteInteraction{Request: recorded, Response: response})
+	c.used = append(c.used, true)
+	c.mu.Unlock()
+
+	return res, nil
+}
+
+// Save writes all interactions recorded so far to the cassette's file,
+// creating parent directories as needed.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	file := cassetteFile{
+		Version:      1,
+		Interactions: append([]*cassetteInteraction{}, c.interactions...),
+	}
+	c.mu.Unlock()
+
+	payload, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(ioutil.WriteFile(c.path, payload, 0644))
+}
+
+// cassetteRequestFrom returns the redacted form of a request, as it's
+// recorded and matched, along with its body.
+func cassetteRequestFrom(req *http.Request) (cassetteRequest, []byte, error) {
+	recorded := cassetteRequest{
+		Method: req.Method,
+		Path:   "/" + strings.TrimLeft(req.URL.Path, "/"),
+	}
+	if recorded.Method == "" {
+		recorded.Method = http.MethodGet
+	}
+	if query := req.URL.Query(); len(query) > 0 {
+		recorded.Query = RedactValues(query)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return recorded, nil, errors.WithStack(err)
+		}
+	}
+	if len(body) == 0 {
+		return recorded, body, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return recorded, nil, errors.Wrap(err, "parsing form body")
+		}
+		recorded.Form = RedactValues(values)
+	} else {
+		recorded.Body = string(RedactBody(req.Header.Get("Content-Type"), body))
+	}
+	return recorded, body, nil
+}
+
+func (r cassetteRequest) matches(other cassetteRequest) bool {
+	return r.Method == other.Method &&
+		r.Path == other.Path &&
+		sameValues(r.Query, other.Query) &&
+		sameValues(r.Form, other.Form) &&
+		r.Body == other.Body
+}
+
+func sameValues(a url.Values, b url.Values) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func (r cassetteResponse) toResponse(req *http.Request) (*http.Response, error) {
+	body := []byte(r.Body)
+	if r.Encoding == "base64" {
+		var err error
+		body, err = base64.StdEncoding.DecodeString(r.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding recorded body")
+		}
+	}
+
+	header := http.Header{}
+	for k, vv := range r.Header {
+		header[k] = append([]string(nil), vv...)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
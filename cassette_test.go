@@ -0,0 +1,94 @@
+package itchio
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestCassette(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login":
+			_, _ = w.Write([]byte(`{"key":{"id":1,"key":"fresh-api-key"},"cookie":{"itchio_token":"xyz"}}`))
+		case "/search/games":
+			_, _ = w.Write([]byte(`{"page":` + r.URL.Query().Get("page") + `,"games":[{"id":12,"title":"` + r.URL.Query().Get("query") + `"}]}`))
+		default:
+			_, _ = w.Write([]byte(`{"user":{"id":1,"username":"amos"}}`))
+		}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassettes", "scenario.json")
+	ctx := context.Background()
+
+	scenario := func(client *Client) error {
+		if _, err := client.GetProfile(ctx); err != nil {
+			return err
+		}
+		res, err := client.SearchGames(ctx, SearchGamesParams{Query: "overland", Page: 2})
+		if err != nil {
+			return err
+		}
+		assert.EqualValues(t, "overland", res.Games[0].Title)
+		_, err = client.LoginWithPassword(ctx, LoginWithPasswordParams{Username: "amos", Password: "hunter2"})
+		return err
+	}
+
+	{
+		recorder, err := NewCassette(path, CassetteRecord)
+		assert.NoError(t, err)
+		recorder.Transport = server.Client().Transport
+
+		client := newTestKeyClient(server)
+		client.HTTPClient = &http.Client{Transport: recorder}
+		assert.NoError(t, scenario(client))
+		assert.Equal(t, 3, recorder.Len())
+		assert.NoError(t, recorder.Save())
+	}
+
+	recording, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	for _, secret := range []string{"APIKEY", "hunter2", "fresh-api-key", "xyz"} {
+		assert.NotContains(t, string(recording), secret)
+	}
+
+	server.Close()
+
+	{
+		player, err := NewCassette(path, CassetteReplay)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, player.Unused())
+
+		client := ClientWithKey("another key")
+		client.BaseURL = "http://replayed.invalid"
+		client.HTTPClient = &http.Client{Transport: player}
+		client.Limiter = rate.NewLimiter(rate.Inf, 1)
+		assert.NoError(t, scenario(client), "replays don't need the recording's key or host")
+		assert.Equal(t, 0, player.Unused())
+
+		_, err = client.GetProfile(ctx)
+		assert.True(t, errors.Is(err, ErrCassetteMiss), "interactions are only replayed once")
+	}
+
+	{
+		player, err := NewCassette(path, CassetteReplay)
+		assert.NoError(t, err)
+
+		client := ClientWithKey("another key")
+		client.HTTPClient = &http.Client{Transport: player}
+		client.Limiter = rate.NewLimiter(rate.Inf, 1)
+		_, err = client.SearchGames(ctx, SearchGamesParams{Query: "overland", Page: 3})
+		assert.True(t, errors.Is(err, ErrCassetteMiss), "query strings must match")
+		_, err = client.LoginWithPassword(ctx, LoginWithPasswordParams{Username: "someone else", Password: "hunter2"})
+		assert.True(t, errors.Is(err, ErrCassetteMiss), "form bodies must match")
+	}
+}
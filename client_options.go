@@ -0,0 +1,179 @@
+package itchio
+
+import (
+	"net/http"
+
+	"github.com/itchio/httpkit/timeout"
+)
+
+// An Option configures a Client, see NewClient and Client.With
+type Option func(c *Client)
+
+// NewClient creates an itch.io API client. Without options, it makes
+// unauthenticated requests to the reference itch.io server.
+//
+// Clients may be used from several goroutines, but changing their fields
+// while requests are in flight is a data race: use With to derive clients
+// with different settings instead.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		HTTPClient:       timeout.NewDefaultClient(),
+		RetryPolicy:      DefaultRetryPolicy(),
+		UserAgent:        "go-itchio",
+		AcceptedLanguage: "*",
+		Limiter:          DefaultLimiter(),
+		Logger:           DefaultLogger(),
+	}
+	c.SetServer("https://api.itch.io")
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// With returns a new client with the same settings as c, changed by opts.
+// The new client shares c's HTTP client, limiter, cache and Authenticator
+// (so OAuth token refreshes benefit both), but changing its settings, or
+// registering middleware and callbacks on it, doesn't affect c.
+func (c *Client) With(opts ...Option) *Client {
+	c.mu.RLock()
+	middleware := c.middleware
+	onSchemaDrift := c.onSchemaDrift
+	onWrite := c.onWrite
+	c.mu.RUnlock()
+
+	// Client holds a mutex, and in-flight request state,
+	// so it's copied field by field.
+	clone := &Client{
+		Key:              c.Key,
+		Auth:             c.Auth,
+		HTTPClient:       c.HTTPClient,
+		BaseURL:          c.BaseURL,
+		RetryPolicy:      c.RetryPolicy,
+		UserAgent:        c.UserAgent,
+		AcceptedLanguage: c.AcceptedLanguage,
+		Logger:           c.Logger,
+		Limiter:          c.Limiter,
+		CoalesceRequests: c.CoalesceRequests,
+		Cache:            c.Cache,
+		CacheInvalidator: c.CacheInvalidator,
+
+		// middleware and callbacks are copied on write,
+		// so the slices can be shared.
+		middleware:    middleware,
+		onSchemaDrift: onSchemaDrift,
+		onWrite:       onWrite,
+	}
+	for _, opt := range opts {
+		opt(clone)
+	}
+	return clone
+}
+
+// WithKey makes the client authenticate with an API key,
+// instead of any OAuth credentials it had.
+func WithKey(key string) Option {
+	return func(c *Client) {
+		c.Key = key
+		c.Auth = nil
+	}
+}
+
+// WithOAuth makes the client authenticate with OAuth credentials, which it
+// refreshes as needed, see NewOAuthClient.
+//
+// Panics if creds is nil or config.ClientID is empty.
+func WithOAuth(creds *OAuthCredentials, config OAuthConfig) Option {
+	if creds == nil {
+		panic("itchio: WithOAuth called with nil credentials")
+	}
+	if config.ClientID == "" {
+		panic("itchio: WithOAuth called with empty ClientID")
+	}
+
+	return func(c *Client) {
+		c.Key = ""
+		c.Auth = NewOAuthAuthenticator(creds, config)
+	}
+}
+
+// WithAuthenticator makes the client authenticate requests with auth
+func WithAuthenticator(auth Authenticator) Option {
+	return func(c *Client) {
+		c.Key = ""
+		c.Auth = auth
+	}
+}
+
+// WithBaseURL makes the client talk to another server than
+// the reference itch.io one, see SetServer.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.SetServer(baseURL)
+	}
+}
+
+// WithHTTPClient makes the client send requests with httpClient
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.HTTPClient = httpClient
+	}
+}
+
+// WithLimiter makes the client pace requests with limiter.
+// Nil disables rate limiting.
+func WithLimiter(limiter Limiter) Option {
+	return func(c *Client) {
+		c.Limiter = limiter
+	}
+}
+
+// WithRetryPolicy makes the client retry requests according to policy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.RetryPolicy = policy
+	}
+}
+
+// WithLogger makes the client log through logger
+func WithLogger(logger Logger) Option {
+	return func(c *Client) {
+		c.Logger = logger
+	}
+}
+
+// WithMiddleware appends middleware to the client's chain, see Use
+func WithMiddleware(mws ...Middleware) Option {
+	return func(c *Client) {
+		c.Use(mws...)
+	}
+}
+
+// WithUserAgent sets the User-Agent header of the client's requests
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.UserAgent = userAgent
+	}
+}
+
+// WithAcceptedLanguage sets the Accept-Language header of the client's requests
+func WithAcceptedLanguage(acceptedLanguage string) Option {
+	return func(c *Client) {
+		c.AcceptedLanguage = acceptedLanguage
+	}
+}
+
+// WithCache makes the client cache responses, see Client.Cache
+func WithCache(cache Cache) Option {
+	return func(c *Client) {
+		c.Cache = cache
+	}
+}
+
+// WithCoalescing makes the client coalesce identical concurrent
+// requests, see Client.CoalesceRequests
+func WithCoalescing(coalesce bool) Option {
+	return func(c *Client) {
+		c.CoalesceRequests = coalesce
+	}
+}
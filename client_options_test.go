@@ -0,0 +1,120 @@
+package itchio
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestNewClient(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Get("Authorization")+" "+r.Header.Get("User-Agent"))
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"game":{"id":3}}`))
+	}))
+	defer server.Close()
+
+	var middlewareCalls int32
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	client := NewClient(
+		WithKey("KEY"),
+		WithBaseURL(server.URL),
+		WithHTTPClient(server.Client()),
+		WithLimiter(limiter),
+		WithRetryPolicy(NoRetry),
+		WithLogger(NopLogger),
+		WithUserAgent("butler"),
+		WithMiddleware(func(next RoundTripFunc) RoundTripFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&middlewareCalls, 1)
+				return next(req)
+			}
+		}),
+	)
+	ctx := context.Background()
+
+	_, err := client.GetGame(ctx, GetGameParams{GameID: 3})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&middlewareCalls))
+
+	var derivedCalls int32
+	derived := client.With(WithKey("OTHER"), WithUserAgent("itch"), WithMiddleware(func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&derivedCalls, 1)
+			return next(req)
+		}
+	}))
+	assert.True(t, derived.HTTPClient == client.HTTPClient, "the transport is shared")
+	assert.True(t, derived.Limiter == client.Limiter, "the limiter is shared")
+
+	_, err = derived.GetGame(ctx, GetGameParams{GameID: 3})
+	assert.NoError(t, err)
+	_, err = client.GetGame(ctx, GetGameParams{GameID: 3})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"KEY butler", "OTHER itch", "KEY butler"}, seen, "the original client keeps its settings")
+	assert.EqualValues(t, 3, atomic.LoadInt32(&middlewareCalls), "middleware are inherited")
+	assert.EqualValues(t, 1, atomic.LoadInt32(&derivedCalls), "middleware added to a derived client don't affect the original")
+}
+
+func TestWithSharesOAuthSession(t *testing.T) {
+	var refreshes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth/token" {
+			atomic.AddInt32(&refreshes, 1)
+			_, _ = w.Write([]byte(`{"access_token":"new-access","refresh_token":"new-refresh","expires_in":3600}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer new-access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"game":{"id":3}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(
+		WithOAuth(&OAuthCredentials{
+			AccessToken:  "old-access",
+			RefreshToken: "old-refresh",
+			ExpiresAt:    time.Now().Add(-time.Minute),
+		}, OAuthConfig{ClientID: "client"}),
+		WithBaseURL(server.URL),
+		WithHTTPClient(server.Client()),
+		WithLimiter(nil),
+	)
+	derived := client.With(WithAcceptedLanguage("fr"))
+
+	ctx := context.Background()
+	concurrently(4, func(i int) {
+		c := client
+		if i%2 == 1 {
+			c = derived
+		}
+		_, err := c.GetGame(ctx, GetGameParams{GameID: 3})
+		assert.NoError(t, err)
+	})
+	assert.EqualValues(t, 1, atomic.LoadInt32(&refreshes), "derived clients share the OAuth session")
+}
+
+func TestWithConcurrently(t *testing.T) {
+	server := newSlowGameServer(time.Millisecond, new(int32))
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+	concurrently(8, func(i int) {
+		c := client.With(WithUserAgent("worker"), WithMiddleware(func(next RoundTripFunc) RoundTripFunc { return next }))
+		_, err := c.GetGame(context.Background(), GetGameParams{GameID: 3})
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,114 @@
+package itchio
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// flightGroup tracks the coalesced GET requests in flight, see Client.CoalesceRequests
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// a flight is a GET request shared by several callers
+type flight struct {
+	done chan struct{}
+	// value is a pointer to the decoded response, set when done
+	value interface{}
+	meta  ResponseMeta
+	err   error
+
+	// waiters is how many callers still wait for the flight.
+	// The request is canceled when they've all given up.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// flightKey identifies requests that can share a response: they must be for
+// the same URL (which includes game credentials), made on behalf of the same
+// user, with the same headers, and decode into the same type.
+func (c *Client) flightKey(ctx context.Context, url string, dst interface{}) string {
+	return reflect.TypeOf(dst).String() + " " + c.authIdentity(ctx) + " " + callOptionsFromContext(ctx).variant() + " " + url
+}
+
+// coalescedGet performs a GET request like getResponse, unless an identical
+// one is already in flight, in which case it waits for its result.
+func (c *Client) coalescedGet(ctx context.Context, url string, dst interface{}) error {
+	dstValue := reflect.ValueOf(dst)
+	if dstValue.Kind() != reflect.Ptr || dstValue.IsNil() {
+		return c.getResponse(ctx, url, dst)
+	}
+
+	g := &c.flights
+	key := c.flightKey(ctx, url, dst)
+
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f, ok := g.flights[key]
+	if !ok {
+		f = &flight{done: make(chan struct{})}
+		// the request outlives the caller that started it if others
+		// are waiting for it, but keeps its context's values.
+		flightCtx, cancel := context.WithCancel(detachedContext{parent: ctx})
+		f.cancel = cancel
+		g.flights[key] = f
+
+		go func() {
+			value := reflect.New(dstValue.Type().Elem()).Interface()
+			err := c.getResponse(WithResponseMeta(flightCtx, &f.meta), url, value)
+
+			g.mu.Lock()
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+			f.value, f.err = value, err
+			g.mu.Unlock()
+
+			cancel()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+			f.cancel()
+		}
+		g.mu.Unlock()
+		return errors.WithStack(ctx.Err())
+	}
+
+	if meta := responseMetaFromContext(ctx); meta != nil {
+		*meta = f.meta
+	}
+	if f.err != nil {
+		return f.err
+	}
+	dstValue.Elem().Set(reflect.ValueOf(f.value).Elem())
+	return nil
+}
+
+// detachedContext has the values of its parent, but is never done
+type detachedContext struct {
+	parent context.Context
+}
+
+func (dc detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (dc detachedContext) Done() <-chan struct{}             { return nil }
+func (dc detachedContext) Err() error                        { return nil }
+func (dc detachedContext) Value(key interface{}) interface{} { return dc.parent.Value(key) }
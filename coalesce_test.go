@@ -0,0 +1,133 @@
+package itchio
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSlowGameServer(delay time.Duration, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		time.Sleep(delay)
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "POST" {
+			_, _ = w.Write([]byte(`{"uuid":"abc"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"game":{"id":3,"title":"Coalesced"}}`))
+	}))
+}
+
+// concurrently runs f n times, and waits for all calls to return
+func concurrently(n int, f func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCoalesceRequests(t *testing.T) {
+	var requests int32
+	server := newSlowGameServer(50*time.Millisecond, &requests)
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+	client.CoalesceRequests = true
+	ctx := context.Background()
+
+	var metas [8]ResponseMeta
+	concurrently(8, func(i int) {
+		res, err := client.GetGame(WithResponseMeta(ctx, &metas[i]), GetGameParams{GameID: 3})
+		assert.NoError(t, err)
+		assert.Equal(t, "Coalesced", res.Game.Title)
+	})
+	assert.EqualValues(t, 1, atomic.LoadInt32(&requests), "identical GETs share one request")
+	for _, meta := range metas {
+		assert.Equal(t, 200, meta.StatusCode)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	concurrently(4, func(i int) {
+		_, err := client.GetGame(ctx, GetGameParams{GameID: 3, Credentials: GameCredentials{DownloadKeyID: int64(i)}})
+		assert.NoError(t, err)
+	})
+	assert.EqualValues(t, 4, atomic.LoadInt32(&requests), "requests with different credentials aren't shared")
+
+	atomic.StoreInt32(&requests, 0)
+	concurrently(4, func(i int) {
+		_, err := client.NewDownloadSession(ctx, NewDownloadSessionParams{GameID: 3})
+		assert.NoError(t, err)
+	})
+	assert.EqualValues(t, 4, atomic.LoadInt32(&requests), "POSTs are never coalesced")
+
+	atomic.StoreInt32(&requests, 0)
+	other := newTestKeyClient(server)
+	other.Key = "OTHER KEY"
+	other.CoalesceRequests = true
+	concurrently(2, func(i int) {
+		c := client
+		if i == 1 {
+			c = other
+		}
+		_, err := c.GetGame(ctx, GetGameParams{GameID: 3})
+		assert.NoError(t, err)
+	})
+	assert.EqualValues(t, 2, atomic.LoadInt32(&requests))
+}
+
+func TestCoalesceRequestsDisabled(t *testing.T) {
+	var requests int32
+	server := newSlowGameServer(20*time.Millisecond, &requests)
+	defer server.Close()
+	client := newTestKeyClient(server)
+
+	concurrently(3, func(i int) {
+		_, err := client.GetGame(context.Background(), GetGameParams{GameID: 3})
+		assert.NoError(t, err)
+	})
+	assert.EqualValues(t, 3, atomic.LoadInt32(&requests))
+}
+
+func TestCoalesceRequestsCancel(t *testing.T) {
+	var requests int32
+	server := newSlowGameServer(100*time.Millisecond, &requests)
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+	client.CoalesceRequests = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := client.GetGame(ctx, GetGameParams{GameID: 3})
+		assert.Error(t, err)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		res, err := client.GetGame(context.Background(), GetGameParams{GameID: 3})
+		assert.NoError(t, err, "the first caller giving up doesn't fail the others")
+		assert.Equal(t, "Coalesced", res.Game.Title)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	wg.Wait()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+}
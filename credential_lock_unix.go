@@ -0,0 +1,26 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package itchio
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// lockFileExclusive blocks until f is locked, with flock(2). The lock
+// is released when f is unlocked or closed, or the process exits.
+func lockFileExclusive(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return errors.WithStack(err)
+		}
+	}
+}
+
+func unlockFile(f *os.File) error {
+	return errors.WithStack(syscall.Flock(int(f.Fd()), syscall.LOCK_UN))
+}
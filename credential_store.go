@@ -0,0 +1,89 @@
+package itchio
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoCredentials is returned by CredentialStore.Load when
+// no credentials have been saved
+var ErrNoCredentials = errors.New("itchio: no stored credentials")
+
+// A CredentialStore persists OAuth credentials, so users stay logged in
+// across restarts. OAuth clients with a store (see OAuthConfig.Store)
+// save their credentials to it every time they're refreshed.
+type CredentialStore interface {
+	// Load returns the stored credentials, or ErrNoCredentials
+	Load() (*OAuthCredentials, error)
+	// Save replaces the stored credentials
+	Save(creds *OAuthCredentials) error
+	// Delete removes the stored credentials, for example when logging out.
+	// Deleting from an empty store isn't an error.
+	Delete() error
+}
+
+// A CredentialUpdater is a CredentialStore that can be shared by several
+// processes. Refresh tokens are rotated: when two processes refresh with
+// the same token, the second one fails, and credentials are lost. Clients
+// refresh under the store's lock instead, and pick up the credentials
+// another process has refreshed in the meantime.
+type CredentialUpdater interface {
+	CredentialStore
+
+	// Update locks the store, calls f with the stored credentials (nil if
+	// there are none), and saves the credentials f returns, unless they're
+	// nil, before unlocking.
+	Update(f func(stored *OAuthCredentials) (*OAuthCredentials, error)) error
+}
+
+// NewOAuthClientFromStore creates an OAuth client with the credentials
+// saved in store, which refreshed credentials get saved to.
+// See NewOAuthClient.
+//
+// It returns ErrNoCredentials if the store is empty, in which case
+// users need to log in, for example with OAuthFlow.
+func NewOAuthClientFromStore(store CredentialStore, config OAuthConfig) (*Client, error) {
+	if config.ClientID == "" {
+		return nil, errors.New("itchio: NewOAuthClientFromStore called with empty ClientID")
+	}
+
+	creds, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if creds == nil {
+		return nil, ErrNoCredentials
+	}
+	config.Store = store
+	return NewOAuthClient(creds, config), nil
+}
+
+// updateStoredCredentials calls f with the credentials in store, and saves
+// the ones it returns. Stores that aren't CredentialUpdaters aren't locked
+// in between.
+func updateStoredCredentials(store CredentialStore, f func(stored *OAuthCredentials) (*OAuthCredentials, error)) error {
+	if updater, ok := store.(CredentialUpdater); ok {
+		return updater.Update(f)
+	}
+
+	stored, err := store.Load()
+	if err != nil {
+		if errors.Cause(err) != ErrNoCredentials {
+			return err
+		}
+		stored = nil
+	}
+	creds, err := f(stored)
+	if err != nil || creds == nil {
+		return err
+	}
+	return store.Save(creds)
+}
+
+// storedCredentials is how credentials are serialized by stores
+type storedCredentials struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
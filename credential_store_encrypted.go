@@ -0,0 +1,139 @@
+package itchio
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// ErrWrongPassphrase is returned when loading encrypted credentials
+// with the wrong passphrase, or that have been tampered with
+var ErrWrongPassphrase = errors.New("itchio: wrong passphrase, or corrupted credentials")
+
+const (
+	// credentialKDFIterations is how many PBKDF2-SHA256 iterations
+	// keys are derived with, as recommended by OWASP
+	credentialKDFIterations = 600000
+	// maxCredentialKDFIterations leaves room to raise credentialKDFIterations,
+	// while keeping corrupted files from making loads hang
+	maxCredentialKDFIterations = 10 * credentialKDFIterations
+	credentialSaltSize         = 16
+	credentialKeySize          = 32
+)
+
+// encryptedCredentials is the format of encrypted credential files.
+// KDF parameters are stored, so they can be raised later.
+type encryptedCredentials struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// credentialCipher encrypts credentials with a passphrase
+type credentialCipher struct {
+	passphrase []byte
+
+	// deriving keys is slow on purpose, so the last one is kept
+	mu         sync.Mutex
+	salt       []byte
+	iterations int
+	key        []byte
+}
+
+func newCredentialCipher(passphrase []byte) *credentialCipher {
+	return &credentialCipher{passphrase: passphrase}
+}
+
+// deriveKey returns the key for a salt and iteration count
+func (cc *credentialCipher) deriveKey(salt []byte, iterations int) []byte {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if cc.key == nil || cc.iterations != iterations || !hmac.Equal(cc.salt, salt) {
+		cc.salt = salt
+		cc.iterations = iterations
+		cc.key = pbkdf2.Key(cc.passphrase, salt, iterations, credentialKeySize, sha256.New)
+	}
+	return cc.key
+}
+
+// encrypt seals payload with a fresh nonce. The salt is only
+// renewed when the cipher hasn't derived a key yet.
+func (cc *credentialCipher) encrypt(payload []byte) ([]byte, error) {
+	cc.mu.Lock()
+	salt := cc.salt
+	if cc.iterations != credentialKDFIterations {
+		salt = nil
+	}
+	cc.mu.Unlock()
+
+	if salt == nil {
+		salt = make([]byte, credentialSaltSize)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	aead, err := newCredentialAEAD(cc.deriveKey(salt, credentialKDFIterations))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sealed, err := json.Marshal(encryptedCredentials{
+		Version:    1,
+		KDF:        "pbkdf2-sha256",
+		Iterations: credentialKDFIterations,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, payload, nil),
+	})
+	return sealed, errors.WithStack(err)
+}
+
+// decrypt opens what encrypt sealed
+func (cc *credentialCipher) decrypt(sealed []byte) ([]byte, error) {
+	var ec encryptedCredentials
+	if err := json.Unmarshal(sealed, &ec); err != nil {
+		return nil, errors.Wrap(err, "decoding encrypted credentials")
+	}
+	if ec.Version != 1 || ec.KDF != "pbkdf2-sha256" || ec.Iterations <= 0 || ec.Iterations > maxCredentialKDFIterations {
+		return nil, errors.Errorf("itchio: unsupported encrypted credentials (version %d, kdf %q, %d iterations)", ec.Version, ec.KDF, ec.Iterations)
+	}
+
+	aead, err := newCredentialAEAD(cc.deriveKey(ec.Salt, ec.Iterations))
+	if err != nil {
+		return nil, err
+	}
+	if len(ec.Nonce) != aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	payload, err := aead.Open(nil, ec.Nonce, ec.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return payload, nil
+}
+
+func newCredentialAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	return aead, errors.WithStack(err)
+}
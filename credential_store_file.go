@@ -0,0 +1,199 @@
+package itchio
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// A FileCredentialStore is a CredentialStore that keeps credentials in a
+// file, as JSON, or encrypted with a passphrase. Saves are atomic, and
+// the file is locked while it's read or written, including by other
+// processes, so it can be shared by several of them.
+type FileCredentialStore struct {
+	path string
+	// cipher is nil for plain JSON files
+	cipher *credentialCipher
+
+	// mu serializes access from this process: file locks
+	// don't reliably do that on every platform.
+	mu sync.Mutex
+}
+
+var _ CredentialUpdater = (*FileCredentialStore)(nil)
+
+// NewFileCredentialStore returns a store that keeps credentials in a JSON
+// file at path. Its directory is created if needed.
+//
+// The file is only readable by its owner, but credentials are stored in
+// plain text: consider NewEncryptedCredentialStore, or the platform's
+// keychain, on shared machines.
+func NewFileCredentialStore(path string) *FileCredentialStore {
+	return &FileCredentialStore{path: path}
+}
+
+// NewEncryptedCredentialStore returns a store that keeps credentials in a
+// file at path, encrypted with AES-GCM, with a key derived from passphrase
+// with PBKDF2. Loading fails with ErrWrongPassphrase if the file was saved
+// with another passphrase.
+func NewEncryptedCredentialStore(path string, passphrase string) *FileCredentialStore {
+	return &FileCredentialStore{
+		path:   path,
+		cipher: newCredentialCipher([]byte(passphrase)),
+	}
+}
+
+// Load returns the stored credentials, or ErrNoCredentials
+func (fs *FileCredentialStore) Load() (*OAuthCredentials, error) {
+	var creds *OAuthCredentials
+	err := fs.locked(func() error {
+		var err error
+		creds, err = fs.read()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if creds == nil {
+		return nil, ErrNoCredentials
+	}
+	return creds, nil
+}
+
+// Save replaces the stored credentials
+func (fs *FileCredentialStore) Save(creds *OAuthCredentials) error {
+	return fs.locked(func() error {
+		return fs.write(creds)
+	})
+}
+
+// Delete removes the file credentials are stored in
+func (fs *FileCredentialStore) Delete() error {
+	return fs.locked(func() error {
+		err := os.Remove(fs.path)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+		return nil
+	})
+}
+
+// Update calls f with the stored credentials, and saves the ones it
+// returns, with the file locked in between
+func (fs *FileCredentialStore) Update(f func(stored *OAuthCredentials) (*OAuthCredentials, error)) error {
+	return fs.locked(func() error {
+		stored, err := fs.read()
+		if err != nil {
+			return err
+		}
+		creds, err := f(stored)
+		if err != nil || creds == nil {
+			return err
+		}
+		return fs.write(creds)
+	})
+}
+
+// locked calls f while holding the store's lock. The lock is taken on a
+// separate file, since saving replaces the credentials file.
+func (fs *FileCredentialStore) locked(f func() error) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(fs.path), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	lockFile, err := os.OpenFile(fs.path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer lockFile.Close()
+
+	if err := lockFileExclusive(lockFile); err != nil {
+		return errors.Wrap(err, "locking credential store")
+	}
+	defer unlockFile(lockFile)
+
+	return f()
+}
+
+// read returns the stored credentials, or nil if there are none.
+// Must be called with the lock held.
+func (fs *FileCredentialStore) read() (*OAuthCredentials, error) {
+	payload, err := ioutil.ReadFile(fs.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	if fs.cipher != nil {
+		payload, err = fs.cipher.decrypt(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var stored storedCredentials
+	if err := json.Unmarshal(payload, &stored); err != nil {
+		return nil, errors.Wrap(err, "decoding stored credentials")
+	}
+	if stored.AccessToken == "" && stored.RefreshToken == "" {
+		return nil, errors.Errorf("itchio: no tokens in %s", fs.path)
+	}
+	return &OAuthCredentials{
+		AccessToken:  stored.AccessToken,
+		RefreshToken: stored.RefreshToken,
+		ExpiresAt:    stored.ExpiresAt,
+	}, nil
+}
+
+// write replaces the stored credentials. Must be called with the lock held.
+func (fs *FileCredentialStore) write(creds *OAuthCredentials) error {
+	payload, err := json.Marshal(storedCredentials{
+		AccessToken:  creds.AccessToken,
+		RefreshToken: creds.RefreshToken,
+		ExpiresAt:    creds.ExpiresAt,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if fs.cipher != nil {
+		payload, err = fs.cipher.encrypt(payload)
+		if err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(fs.path, payload)
+}
+
+// writeFileAtomic writes to a temporary file first, then renames it
+// over path, so readers never see a partial file. The file is only
+// readable by its owner.
+func writeFileAtomic(path string, payload []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = tmp.Write(payload)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package itchio
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileCredentialStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "itchio-credentials")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	creds := &OAuthCredentials{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(time.Hour).Round(time.Second),
+	}
+
+	stores := map[string]*FileCredentialStore{
+		"plain":     NewFileCredentialStore(filepath.Join(dir, "plain", "credentials.json")),
+		"encrypted": NewEncryptedCredentialStore(filepath.Join(dir, "encrypted", "credentials"), "hunter2"),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			_, err := store.Load()
+			assert.Equal(t, ErrNoCredentials, err)
+
+			assert.NoError(t, store.Save(creds))
+			loaded, err := store.Load()
+			assert.NoError(t, err)
+			if assert.NotNil(t, loaded) {
+				assert.Equal(t, creds.AccessToken, loaded.AccessToken)
+				assert.Equal(t, creds.RefreshToken, loaded.RefreshToken)
+				assert.True(t, creds.ExpiresAt.Equal(loaded.ExpiresAt))
+			}
+
+			info, err := os.Stat(store.path)
+			assert.NoError(t, err)
+			if runtime.GOOS != "windows" {
+				assert.EqualValues(t, 0600, info.Mode().Perm())
+			}
+			payload, err := ioutil.ReadFile(store.path)
+			assert.NoError(t, err)
+			assert.Equal(t, name == "plain", strings.Contains(string(payload), "refresh"))
+
+			assert.NoError(t, store.Delete())
+			assert.NoError(t, store.Delete(), "deleting twice is fine")
+			_, err = store.Load()
+			assert.Equal(t, ErrNoCredentials, err)
+		})
+	}
+}
+
+func TestEncryptedCredentialStoreWrongPassphrase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "itchio-credentials")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials")
+
+	assert.NoError(t, NewEncryptedCredentialStore(path, "right").Save(&OAuthCredentials{AccessToken: "access"}))
+	_, err = NewEncryptedCredentialStore(path, "wrong").Load()
+	assert.True(t, errors.Is(err, ErrWrongPassphrase))
+	_, err = NewFileCredentialStore(path).Load()
+	assert.Error(t, err, "encrypted files aren't mistaken for plain ones")
+}
+
+func TestEncryptedCredentialStoreIterationsCap(t *testing.T) {
+	cc := newCredentialCipher([]byte("passphrase"))
+	sealed, err := json.Marshal(encryptedCredentials{
+		Version:    1,
+		KDF:        "pbkdf2-sha256",
+		Iterations: math.MaxInt32,
+		Salt:       []byte("salt"),
+		Nonce:      make([]byte, 12),
+	})
+	assert.NoError(t, err)
+
+	start := time.Now()
+	_, err = cc.decrypt(sealed)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported encrypted credentials")
+	assert.True(t, time.Since(start) < time.Second, "keys aren't derived with absurd iteration counts")
+}
+
+func TestCredentialKeyDerivation(t *testing.T) {
+	// keys must stay PBKDF2-HMAC-SHA256 ones, for existing files to stay
+	// readable: these are the usual test vectors for it
+	cc := newCredentialCipher([]byte("password"))
+	for _, v := range []struct {
+		iterations int
+		key        string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	} {
+		key := cc.deriveKey([]byte("salt"), v.iterations)
+		assert.Equal(t, v.key, hex.EncodeToString(key), "%d iterations", v.iterations)
+	}
+}
+
+// newRotatingTokenServer serves profiles to valid access tokens, and
+// rotates refresh tokens like the real API: each can only be used once
+func newRotatingTokenServer(t *testing.T, refreshes *int) *httptest.Server {
+	var mu sync.Mutex
+	access := map[string]bool{}
+	refresh := map[string]bool{"refresh-0": true}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path == "/oauth/token" {
+			assert.NoError(t, r.ParseForm())
+			token := r.PostForm.Get("refresh_token")
+			if !refresh[token] {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors":["invalid_grant"]}`))
+				return
+			}
+			delete(refresh, token)
+			*refreshes++
+			access[fmt.Sprintf("access-%d", *refreshes)] = true
+			refresh[fmt.Sprintf("refresh-%d", *refreshes)] = true
+			_, _ = fmt.Fprintf(w, `{"access_token":"access-%d","refresh_token":"refresh-%d","expires_in":3600}`, *refreshes, *refreshes)
+			return
+		}
+
+		if !access[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"user":{"id":1}}`))
+	}))
+}
+
+func TestOAuthClientFromStore(t *testing.T) {
+	var refreshes int
+	server := newRotatingTokenServer(t, &refreshes)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "itchio-credentials")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials.json")
+
+	_, err = NewOAuthClientFromStore(NewFileCredentialStore(path), OAuthConfig{ClientID: "client"})
+	assert.Equal(t, ErrNoCredentials, err)
+
+	assert.NoError(t, NewFileCredentialStore(path).Save(&OAuthCredentials{
+		AccessToken:  "access-0",
+		RefreshToken: "refresh-0",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	}))
+
+	// two processes sharing the same credentials, each with its own store
+	newClient := func() *Client {
+		store := NewFileCredentialStore(path)
+		client, err := NewOAuthClientFromStore(store, OAuthConfig{
+			ClientID: "client",
+			OnRefresh: func(creds *OAuthCredentials) error {
+				stored, err := store.Load()
+				assert.NoError(t, err)
+				assert.Equal(t, creds.RefreshToken, stored.RefreshToken, "credentials are saved before OnRefresh is called")
+				return nil
+			},
+		})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		client.HTTPClient = server.Client()
+		client.BaseURL = server.URL
+		return client
+	}
+	first, second := newClient(), newClient()
+	ctx := context.Background()
+
+	_, err = first.GetProfile(ctx)
+	assert.NoError(t, err)
+	_, err = second.GetProfile(ctx)
+	assert.NoError(t, err, "the second client picks up the rotated refresh token")
+	assert.Equal(t, 1, refreshes)
+	assert.Equal(t, "refresh-1", second.oauthAuthenticator().Credentials().RefreshToken)
+
+	stored, err := NewFileCredentialStore(path).Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "refresh-1", stored.RefreshToken)
+}
+
+func TestStoreRefreshesAreNotRetried(t *testing.T) {
+	var refreshCalls int32
+	server := newTokenServer(&refreshCalls, 1)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "itchio-credentials")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	client := newTestOAuthClient(t, server, &OAuthCredentials{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	}, OAuthConfig{ClientID: "client", Store: NewFileCredentialStore(filepath.Join(dir, "credentials.json"))})
+	client.RetryPolicy = &BackoffRetryPolicy{Delays: []time.Duration{0, 0}}
+
+	// other processes would be waiting for the store's lock
+	assert.Error(t, client.refreshTokenIfNeeded(context.Background()))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&refreshCalls))
+
+	assert.NoError(t, client.refreshTokenIfNeeded(context.Background()))
+	assert.Equal(t, "access-2", client.oauthAuthenticator().Credentials().AccessToken)
+}
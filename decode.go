@@ -0,0 +1,1260 @@
+package itchio
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// API responses used to be decoded in three steps: encoding/json into a
+// map[string]interface{}, camelify, then mapstructure with hooks. For large
+// pages (owned keys, collection games), building and walking the intermediate
+// map cost more than the request itself.
+//
+// decodeJSON goes straight from the snake_case response body to the typed
+// structs, and keeps the semantics of the old pipeline:
+//
+//   - object keys are camelified before being matched against json tags
+//     (falling back to field names, case-insensitively). Map keys are
+//     camelified too, except under "upload_headers", which is kept as-is
+//   - input is weakly typed (mapstructure's WeaklyTypedInput): numbers and
+//     booleans decode into strings, strings and booleans into numbers,
+//     single values into slices, empty objects into slices, and arrays of
+//     objects into maps (see https://github.com/itchio/itch/issues/1549)
+//   - null leaves the destination untouched
+//   - timestamps are parsed as RFC3339
+//   - objects decoded into Game or Upload that still have "traits" go
+//     through GameHookFunc and UploadHookFunc
+//
+// json.RawMessage fields capture the value as-is.
+
+// maxDecodeDepth bounds how deeply nested a response can be
+const maxDecodeDepth = 10000
+
+// maxCachedKeys bounds how many distinct keys each struct plan remembers
+const maxCachedKeys = 1024
+
+// decodeHookFunc has the signature of mapstructure decode hooks,
+// like GameHookFunc and UploadHookFunc.
+type decodeHookFunc func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error)
+
+// decodeHooks are the legacy hooks applied to objects with "traits"
+var decodeHooks = map[reflect.Type]decodeHookFunc{
+	reflect.TypeOf(Game{}):   GameHookFunc,
+	reflect.TypeOf(Upload{}): UploadHookFunc,
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// decodeJSON decodes a JSON object into dst, which must be a non-nil pointer.
+func decodeJSON(data []byte, dst interface{}) error {
+	d := decoder{data: data}
+	return d.decode(dst)
+}
+
+type decoder struct {
+	data  []byte
+	pos   int
+	depth int
+
+	// errorsValue is the raw value of the top-level "errors" key, if any
+	errorsValue []byte
+
+	// drift collects schema drift findings, if enabled
+	drift *driftCollector
+}
+
+func (d *decoder) decode(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.Errorf("decode: expected a non-nil pointer, got %T", dst)
+	}
+
+	c, err := d.peek()
+	if err != nil {
+		return err
+	}
+	switch c {
+	case '{':
+		v = v.Elem()
+		if v.Kind() == reflect.Struct {
+			return d.decodeStruct(v, true, true)
+		}
+		return d.decodeValue(v, true)
+	case 'n':
+		return d.readLiteral("null")
+	default:
+		return d.syntaxError("expected a JSON object")
+	}
+}
+
+// decodeValue decodes the value at the current position into v.
+// camel is false for values under "upload_headers", whose keys are kept as-is.
+func (d *decoder) decodeValue(v reflect.Value, camel bool) error {
+	c, err := d.peek()
+	if err != nil {
+		return err
+	}
+	if c == 'n' {
+		return d.readLiteral("null")
+	}
+
+	t := v.Type()
+	switch t {
+	case timeType:
+		return d.decodeTime(v)
+	case rawMessageType:
+		return d.decodeRawMessage(v)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return d.decodeValue(v.Elem(), camel)
+		}
+		p := reflect.New(t.Elem())
+		if err := d.decodeValue(p.Elem(), camel); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			return errors.Errorf("unsupported type: %s", t)
+		}
+		value, err := d.decodeGeneric(camel)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(value))
+		return nil
+	case reflect.Struct:
+		switch c {
+		case '{':
+			return d.decodeStruct(v, camel, false)
+		case '[':
+			// PHP encodes empty objects as empty arrays
+			return d.decodeEmptyArray(t)
+		}
+		return d.typeError(t, c)
+	case reflect.Map:
+		switch c {
+		case '{':
+			return d.decodeMap(v, camel)
+		case '[':
+			return d.decodeMapFromArray(v, camel)
+		}
+		return d.typeError(t, c)
+	case reflect.Slice:
+		return d.decodeSlice(v, camel)
+	case reflect.String:
+		return d.decodeString(v)
+	case reflect.Bool:
+		return d.decodeBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return d.decodeInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return d.decodeUint(v)
+	case reflect.Float32, reflect.Float64:
+		return d.decodeFloat(v)
+	}
+	return errors.Errorf("unsupported type: %s", t)
+}
+
+func (d *decoder) decodeStruct(v reflect.Value, camel bool, top bool) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	t := v.Type()
+	plan := structPlanFor(t)
+	start := d.pos
+	d.pos++
+
+	var seen []bool
+	var mark int
+	if d.drift != nil {
+		seen = make([]bool, len(plan.fields))
+		mark = len(d.drift.findings)
+	}
+
+	sawTraits := false
+	first := true
+	for {
+		key, more, err := d.nextKey(&first)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+
+		if top && string(key) == "errors" {
+			valueStart := d.skipSpace()
+			if err := d.skipValue(); err != nil {
+				return err
+			}
+			d.errorsValue = d.data[valueStart:d.pos]
+			continue
+		}
+
+		info := plan.resolve(key, camel)
+		switch info.field {
+		case unknownKey:
+			if d.drift != nil {
+				d.drift.unused(t, string(key))
+			}
+			err = d.skipValue()
+		case traitsKey:
+			sawTraits = true
+			err = d.skipValue()
+		default:
+			f := &plan.fields[info.field]
+			if d.drift != nil {
+				seen[info.field] = true
+				d.drift.push(string(key), t)
+			}
+			err = d.decodeValue(v.Field(f.index), camel && !info.keepCase)
+			if d.drift != nil {
+				d.drift.pop()
+			}
+			if err != nil {
+				err = fieldError(f.name, err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	d.depth--
+
+	if sawTraits {
+		if d.drift != nil {
+			// everything is decoded again, and reported then
+			d.drift.findings = d.drift.findings[:mark]
+			d.drift.add(SchemaDriftCoercedField, t, d.drift.path("traits"), "legacy traits to "+t.String())
+		}
+		return decodeWithHook(v, plan.hook, d.data[start:d.pos], camel, d.drift)
+	}
+
+	if d.drift != nil {
+		for i, f := range plan.fields {
+			if !seen[i] && !f.optional {
+				d.drift.missing(t, f.name)
+			}
+		}
+	}
+	return nil
+}
+
+// decodeWithHook decodes an object that needs one of the legacy hooks
+// the slow way: through a camelified map, like mapstructure used to.
+// The fields decoded in the first pass are decoded again to the same values.
+func decodeWithHook(v reflect.Value, hook decodeHookFunc, raw []byte, camel bool, drift *driftCollector) error {
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return errors.WithStack(err)
+	}
+	if camel {
+		m = camelifyMap(m)
+	}
+
+	hooked, err := hook(reflect.TypeOf(m), v.Type(), m)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(hooked)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	sub := decoder{data: payload, drift: drift}
+	return sub.decodeValue(v, camel)
+}
+
+func (d *decoder) decodeMap(v reflect.Value, camel bool) error {
+	t := v.Type()
+	if t.Key().Kind() != reflect.String {
+		return errors.Errorf("unsupported map key type: %s", t.Key())
+	}
+	if err := d.enter(); err != nil {
+		return err
+	}
+	d.pos++
+
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(t))
+	}
+	elem := reflect.New(t.Elem()).Elem()
+	zero := reflect.Zero(t.Elem())
+
+	first := true
+	for {
+		key, more, err := d.nextKey(&first)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+
+		k := string(key)
+		childCamel := camel && !isCamelifyBlacklisted(k)
+		if camel {
+			k = camelcase(k)
+		}
+
+		elem.Set(zero)
+		d.pushKey(k)
+		err = d.decodeValue(elem, childCamel)
+		d.popPath()
+		if err != nil {
+			return fieldError("["+k+"]", err)
+		}
+		v.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), elem)
+	}
+	d.depth--
+	return nil
+}
+
+// decodeMapFromArray merges an array of objects into a map.
+// An empty array decodes into an empty map.
+func (d *decoder) decodeMapFromArray(v reflect.Value, camel bool) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	d.pos++
+
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	d.coerced(v.Type(), "array")
+
+	first := true
+	for i := 0; ; i++ {
+		more, err := d.nextElem(&first)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		d.pushIndex(i)
+		err = d.decodeValue(v, camel)
+		d.popPath()
+		if err != nil {
+			return fieldError("["+strconv.Itoa(i)+"]", err)
+		}
+	}
+	d.depth--
+	return nil
+}
+
+func (d *decoder) decodeSlice(v reflect.Value, camel bool) error {
+	t := v.Type()
+	c := d.data[d.pos]
+
+	switch {
+	case c == '[':
+		// handled below
+	case c == '{':
+		// empty objects turn into empty slices, others are lifted
+		save := d.pos
+		d.pos++
+		if next, err := d.peek(); err == nil && next == '}' {
+			d.pos++
+			d.coerced(t, "empty object")
+			v.Set(reflect.MakeSlice(t, 0, 0))
+			return nil
+		}
+		d.pos = save
+		return d.decodeLifted(v, camel)
+	case c == '"' && t.Elem().Kind() == reflect.Uint8:
+		s, err := d.readString()
+		if err != nil {
+			return err
+		}
+		d.coerced(t, "string")
+		v.SetBytes(append([]byte(nil), s...))
+		return nil
+	default:
+		return d.decodeLifted(v, camel)
+	}
+
+	if err := d.enter(); err != nil {
+		return err
+	}
+	d.pos++
+
+	var s reflect.Value
+	n := 0
+	first := true
+	for {
+		more, err := d.nextElem(&first)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+
+		if !s.IsValid() {
+			s = reflect.MakeSlice(t, 0, 4)
+		} else if n == s.Cap() {
+			grown := reflect.MakeSlice(t, n, 2*n)
+			reflect.Copy(grown, s)
+			s = grown
+		}
+		s = s.Slice(0, n+1)
+		d.pushIndex(n)
+		err = d.decodeValue(s.Index(n), camel)
+		d.popPath()
+		if err != nil {
+			return fieldError("["+strconv.Itoa(n)+"]", err)
+		}
+		n++
+	}
+	d.depth--
+
+	// like mapstructure, empty arrays leave the slice untouched
+	if s.IsValid() {
+		v.Set(s)
+	}
+	return nil
+}
+
+// decodeLifted decodes a single value into a slice of length 1
+func (d *decoder) decodeLifted(v reflect.Value, camel bool) error {
+	d.coerced(v.Type(), jsonKindName(d.data[d.pos]))
+	s := reflect.MakeSlice(v.Type(), 1, 1)
+	if err := d.decodeValue(s.Index(0), camel); err != nil {
+		return fieldError("[0]", err)
+	}
+	v.Set(s)
+	return nil
+}
+
+func (d *decoder) decodeEmptyArray(t reflect.Type) error {
+	d.pos++
+	first := true
+	more, err := d.nextElem(&first)
+	if err != nil {
+		return err
+	}
+	if more {
+		return d.typeError(t, '[')
+	}
+	d.coerced(t, "empty array")
+	return nil
+}
+
+func (d *decoder) decodeTime(v reflect.Value) error {
+	if d.data[d.pos] != '"' {
+		return d.typeError(v.Type(), d.data[d.pos])
+	}
+	s, err := d.readString()
+	if err != nil {
+		return err
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, string(s))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	v.Set(reflect.ValueOf(parsed))
+	return nil
+}
+
+func (d *decoder) decodeRawMessage(v reflect.Value) error {
+	start := d.pos
+	if err := d.skipValue(); err != nil {
+		return err
+	}
+	raw := append(json.RawMessage(nil), d.data[start:d.pos]...)
+	v.Set(reflect.ValueOf(raw))
+	return nil
+}
+
+func (d *decoder) decodeString(v reflect.Value) error {
+	tok, kind, err := d.readScalar()
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case jsonString:
+		v.SetString(string(tok))
+	case jsonTrue:
+		d.coerced(v.Type(), "bool")
+		v.SetString("1")
+	case jsonFalse:
+		d.coerced(v.Type(), "bool")
+		v.SetString("0")
+	case jsonNumber:
+		d.coerced(v.Type(), "number")
+		v.SetString(formatNumber(tok))
+	default:
+		return d.typeError(v.Type(), d.data[d.pos])
+	}
+	return nil
+}
+
+func (d *decoder) decodeBool(v reflect.Value) error {
+	tok, kind, err := d.readScalar()
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case jsonTrue:
+		v.SetBool(true)
+	case jsonFalse:
+		v.SetBool(false)
+	case jsonNumber:
+		d.coerced(v.Type(), "number")
+		f, err := parseFloat(tok)
+		if err != nil {
+			return err
+		}
+		v.SetBool(f != 0)
+	case jsonString:
+		d.coerced(v.Type(), "string")
+		s := string(tok)
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			if s != "" {
+				return errors.Errorf("cannot parse %q as bool: %v", s, err)
+			}
+			b = false
+		}
+		v.SetBool(b)
+	default:
+		return d.typeError(v.Type(), d.data[d.pos])
+	}
+	return nil
+}
+
+func (d *decoder) decodeInt(v reflect.Value) error {
+	tok, kind, err := d.readScalar()
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case jsonNumber:
+		if !isIntegerLiteral(tok) {
+			d.coerced(v.Type(), "float")
+		}
+		n, err := parseInt(tok)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case jsonTrue, jsonFalse:
+		d.coerced(v.Type(), "bool")
+		v.SetInt(boolToInt(kind == jsonTrue))
+	case jsonString:
+		d.coerced(v.Type(), "string")
+		n, err := strconv.ParseInt(string(tok), 0, v.Type().Bits())
+		if err != nil {
+			return errors.Errorf("cannot parse %q as int: %v", tok, err)
+		}
+		v.SetInt(n)
+	default:
+		return d.typeError(v.Type(), d.data[d.pos])
+	}
+	return nil
+}
+
+func (d *decoder) decodeUint(v reflect.Value) error {
+	tok, kind, err := d.readScalar()
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case jsonNumber:
+		if tok[0] != '-' && isIntegerLiteral(tok) {
+			n, err := strconv.ParseUint(string(tok), 10, 64)
+			if err == nil {
+				v.SetUint(n)
+				return nil
+			}
+		}
+		if isIntegerLiteral(tok) {
+			d.coerced(v.Type(), "negative number")
+		} else {
+			d.coerced(v.Type(), "float")
+		}
+		n, err := parseInt(tok)
+		if err != nil {
+			return err
+		}
+		v.SetUint(uint64(n))
+	case jsonTrue, jsonFalse:
+		d.coerced(v.Type(), "bool")
+		v.SetUint(uint64(boolToInt(kind == jsonTrue)))
+	case jsonString:
+		d.coerced(v.Type(), "string")
+		n, err := strconv.ParseUint(string(tok), 0, v.Type().Bits())
+		if err != nil {
+			return errors.Errorf("cannot parse %q as uint: %v", tok, err)
+		}
+		v.SetUint(n)
+	default:
+		return d.typeError(v.Type(), d.data[d.pos])
+	}
+	return nil
+}
+
+func (d *decoder) decodeFloat(v reflect.Value) error {
+	tok, kind, err := d.readScalar()
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case jsonNumber:
+		f, err := parseFloat(tok)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case jsonTrue, jsonFalse:
+		d.coerced(v.Type(), "bool")
+		v.SetFloat(float64(boolToInt(kind == jsonTrue)))
+	case jsonString:
+		d.coerced(v.Type(), "string")
+		f, err := strconv.ParseFloat(string(tok), v.Type().Bits())
+		if err != nil {
+			return errors.Errorf("cannot parse %q as float: %v", tok, err)
+		}
+		v.SetFloat(f)
+	default:
+		return d.typeError(v.Type(), d.data[d.pos])
+	}
+	return nil
+}
+
+// decodeGeneric decodes the value at the current position into the types
+// encoding/json uses for interface{}, with camelified object keys.
+func (d *decoder) decodeGeneric(camel bool) (interface{}, error) {
+	c, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+
+	switch c {
+	case '{':
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		d.pos++
+		m := make(map[string]interface{})
+		first := true
+		for {
+			key, more, err := d.nextKey(&first)
+			if err != nil {
+				return nil, err
+			}
+			if !more {
+				break
+			}
+			k := string(key)
+			childCamel := camel && !isCamelifyBlacklisted(k)
+			if camel {
+				k = camelcase(k)
+			}
+			value, err := d.decodeGeneric(childCamel)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = value
+		}
+		d.depth--
+		return m, nil
+	case '[':
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		d.pos++
+		var a []interface{}
+		if !camel {
+			a = []interface{}{}
+		}
+		first := true
+		for {
+			more, err := d.nextElem(&first)
+			if err != nil {
+				return nil, err
+			}
+			if !more {
+				break
+			}
+			value, err := d.decodeGeneric(camel)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, value)
+		}
+		d.depth--
+		return a, nil
+	}
+
+	tok, kind, err := d.readScalar()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case jsonString:
+		return string(tok), nil
+	case jsonTrue:
+		return true, nil
+	case jsonFalse:
+		return false, nil
+	case jsonNull:
+		return nil, nil
+	default:
+		return parseFloat(tok)
+	}
+}
+
+func (d *decoder) typeError(t reflect.Type, c byte) error {
+	return errors.Errorf("expected %s, got %s", t, jsonKindName(c))
+}
+
+func jsonKindName(c byte) string {
+	switch c {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "bool"
+	case 'n':
+		return "null"
+	}
+	return "number"
+}
+
+// A decodeFieldError locates a decoding error within a response
+type decodeFieldError struct {
+	path string
+	err  error
+}
+
+func (e *decodeFieldError) Error() string {
+	return fmt.Sprintf("'%s': %v", e.path, e.err)
+}
+
+func (e *decodeFieldError) Unwrap() error {
+	return e.err
+}
+
+// fieldError prefixes the path of err with name, which is either
+// a field name or an index ("[3]")
+func fieldError(name string, err error) error {
+	if fe, ok := err.(*decodeFieldError); ok {
+		if strings.HasPrefix(fe.path, "[") {
+			fe.path = name + fe.path
+		} else {
+			fe.path = name + "." + fe.path
+		}
+		return fe
+	}
+	return &decodeFieldError{path: name, err: err}
+}
+
+const (
+	unknownKey = -1
+	traitsKey  = -2
+)
+
+type structPlan struct {
+	fields []planField
+	byName map[string]int
+	hook   decodeHookFunc
+
+	// keys caches how raw (snake_case) keys resolve, it holds a map[string]keyInfo
+	keys   atomic.Value
+	keysMu sync.Mutex
+}
+
+type planField struct {
+	index int
+	name  string
+	// optional fields are tagged omitempty, and aren't reported missing
+	optional bool
+}
+
+type keyInfo struct {
+	// field is an index into structPlan.fields, unknownKey or traitsKey
+	field int
+	// keepCase is set for keys whose values aren't camelified
+	keepCase bool
+}
+
+var structPlans sync.Map // reflect.Type => *structPlan
+
+func structPlanFor(t reflect.Type) *structPlan {
+	if plan, ok := structPlans.Load(t); ok {
+		return plan.(*structPlan)
+	}
+
+	plan := &structPlan{
+		byName: make(map[string]int),
+		hook:   decodeHooks[t],
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name := sf.Name
+		tagParts := strings.Split(sf.Tag.Get("json"), ",")
+		if tagParts[0] != "" {
+			name = tagParts[0]
+		}
+		optional := false
+		for _, opt := range tagParts[1:] {
+			if opt == "omitempty" {
+				optional = true
+			}
+		}
+		if _, ok := plan.byName[name]; !ok {
+			plan.byName[name] = len(plan.fields)
+		}
+		plan.fields = append(plan.fields, planField{index: i, name: name, optional: optional})
+	}
+	plan.keys.Store(map[string]keyInfo{})
+
+	actual, _ := structPlans.LoadOrStore(t, plan)
+	return actual.(*structPlan)
+}
+
+// resolve returns which field a raw key decodes into
+func (p *structPlan) resolve(key []byte, camel bool) keyInfo {
+	if !camel {
+		return keyInfo{field: p.match(string(key)), keepCase: true}
+	}
+
+	keys := p.keys.Load().(map[string]keyInfo)
+	if info, ok := keys[string(key)]; ok {
+		return info
+	}
+
+	raw := string(key)
+	name := camelcase(raw)
+	info := keyInfo{field: p.match(name), keepCase: isCamelifyBlacklisted(raw)}
+	if p.hook != nil && name == "traits" {
+		info.field = traitsKey
+	}
+
+	p.keysMu.Lock()
+	keys = p.keys.Load().(map[string]keyInfo)
+	if len(keys) < maxCachedKeys {
+		updated := make(map[string]keyInfo, len(keys)+1)
+		for k, v := range keys {
+			updated[k] = v
+		}
+		updated[raw] = info
+		p.keys.Store(updated)
+	}
+	p.keysMu.Unlock()
+
+	return info
+}
+
+func (p *structPlan) match(name string) int {
+	if i, ok := p.byName[name]; ok {
+		return i
+	}
+	for i, f := range p.fields {
+		if strings.EqualFold(f.name, name) {
+			return i
+		}
+	}
+	return unknownKey
+}
+
+func isCamelifyBlacklisted(key string) bool {
+	_, ok := camelifyBlacklist[key]
+	return ok
+}
+
+type jsonKind int
+
+const (
+	jsonString jsonKind = iota
+	jsonNumber
+	jsonTrue
+	jsonFalse
+	jsonNull
+	jsonObject
+	jsonArray
+)
+
+func (d *decoder) syntaxError(msg string) error {
+	return errors.Errorf("invalid JSON at offset %d: %s", d.pos, msg)
+}
+
+func (d *decoder) enter() error {
+	d.depth++
+	if d.depth > maxDecodeDepth {
+		return d.syntaxError("exceeded max depth")
+	}
+	return nil
+}
+
+// skipSpace skips whitespace and returns the new position
+func (d *decoder) skipSpace() int {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\n', '\r':
+			d.pos++
+		default:
+			return d.pos
+		}
+	}
+	return d.pos
+}
+
+// peek skips whitespace and returns the next byte without consuming it
+func (d *decoder) peek() (byte, error) {
+	d.skipSpace()
+	if d.pos >= len(d.data) {
+		return 0, d.syntaxError("unexpected end of input")
+	}
+	return d.data[d.pos], nil
+}
+
+// nextKey reads the next key of an object (whose opening brace was
+// already consumed), and the colon after it. more is false once the
+// closing brace has been consumed.
+func (d *decoder) nextKey(first *bool) (key []byte, more bool, err error) {
+	c, err := d.peek()
+	if err != nil {
+		return nil, false, err
+	}
+	if c == '}' {
+		d.pos++
+		return nil, false, nil
+	}
+	if !*first {
+		if c != ',' {
+			return nil, false, d.syntaxError("expected ',' or '}' after object value")
+		}
+		d.pos++
+		if c, err = d.peek(); err != nil {
+			return nil, false, err
+		}
+	}
+	*first = false
+
+	if c != '"' {
+		return nil, false, d.syntaxError("expected string for object key")
+	}
+	key, err = d.readString()
+	if err != nil {
+		return nil, false, err
+	}
+	if c, err = d.peek(); err != nil {
+		return nil, false, err
+	}
+	if c != ':' {
+		return nil, false, d.syntaxError("expected ':' after object key")
+	}
+	d.pos++
+	return key, true, nil
+}
+
+// nextElem moves to the next element of an array (whose opening bracket
+// was already consumed). more is false once the closing bracket has been consumed.
+func (d *decoder) nextElem(first *bool) (more bool, err error) {
+	c, err := d.peek()
+	if err != nil {
+		return false, err
+	}
+	if c == ']' {
+		d.pos++
+		return false, nil
+	}
+	if !*first {
+		if c != ',' {
+			return false, d.syntaxError("expected ',' or ']' after array element")
+		}
+		d.pos++
+		if _, err = d.peek(); err != nil {
+			return false, err
+		}
+	}
+	*first = false
+	return true, nil
+}
+
+// readScalar reads a string, number, or literal. For objects and
+// arrays, it returns their kind without consuming anything.
+func (d *decoder) readScalar() (tok []byte, kind jsonKind, err error) {
+	c, err := d.peek()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch c {
+	case '"':
+		tok, err = d.readString()
+		return tok, jsonString, err
+	case '{':
+		return d.data[d.pos : d.pos+1], jsonObject, nil
+	case '[':
+		return d.data[d.pos : d.pos+1], jsonArray, nil
+	case 't':
+		kind, err = jsonTrue, d.readLiteral("true")
+	case 'f':
+		kind, err = jsonFalse, d.readLiteral("false")
+	case 'n':
+		kind, err = jsonNull, d.readLiteral("null")
+	default:
+		tok, err = d.readNumber()
+		return tok, jsonNumber, err
+	}
+	return nil, kind, err
+}
+
+func (d *decoder) readLiteral(lit string) error {
+	end := d.pos + len(lit)
+	if end > len(d.data) || string(d.data[d.pos:end]) != lit {
+		return d.syntaxError("invalid literal")
+	}
+	d.pos = end
+	return nil
+}
+
+// readString reads a string and returns its contents. Unless the string
+// has escapes or invalid UTF-8, the returned slice points into d.data.
+func (d *decoder) readString() ([]byte, error) {
+	start := d.pos + 1
+	ascii := true
+	for i := start; i < len(d.data); i++ {
+		c := d.data[i]
+		switch {
+		case c == '"':
+			d.pos = i + 1
+			if !ascii && !utf8.Valid(d.data[start:i]) {
+				return d.unquote(start-1, d.pos)
+			}
+			return d.data[start:i], nil
+		case c == '\\':
+			return d.readEscapedString(start - 1)
+		case c < 0x20:
+			d.pos = i
+			return nil, d.syntaxError("invalid character in string")
+		case c >= utf8.RuneSelf:
+			ascii = false
+		}
+	}
+	d.pos = len(d.data)
+	return nil, d.syntaxError("unexpected end of input in string")
+}
+
+// readEscapedString reads a string with escapes, starting at its opening quote
+func (d *decoder) readEscapedString(start int) ([]byte, error) {
+	for i := start + 1; i < len(d.data); i++ {
+		switch d.data[i] {
+		case '\\':
+			i++
+		case '"':
+			d.pos = i + 1
+			return d.unquote(start, d.pos)
+		}
+	}
+	d.pos = len(d.data)
+	return nil, d.syntaxError("unexpected end of input in string")
+}
+
+// unquote decodes a quoted string the way encoding/json does
+func (d *decoder) unquote(start, end int) ([]byte, error) {
+	var s string
+	if err := json.Unmarshal(d.data[start:end], &s); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return []byte(s), nil
+}
+
+// readNumber reads a number, validating it against the JSON grammar
+func (d *decoder) readNumber() ([]byte, error) {
+	start := d.pos
+	i := d.pos
+	data := d.data
+
+	if i < len(data) && data[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(data) && data[i] == '0':
+		i++
+	case i < len(data) && data[i] >= '1' && data[i] <= '9':
+		for i < len(data) && isDigit(data[i]) {
+			i++
+		}
+	default:
+		d.pos = i
+		return nil, d.syntaxError("invalid character looking for value")
+	}
+
+	if i < len(data) && data[i] == '.' {
+		i++
+		if i >= len(data) || !isDigit(data[i]) {
+			d.pos = i
+			return nil, d.syntaxError("expected digit after decimal point")
+		}
+		for i < len(data) && isDigit(data[i]) {
+			i++
+		}
+	}
+
+	if i < len(data) && (data[i] == 'e' || data[i] == 'E') {
+		i++
+		if i < len(data) && (data[i] == '+' || data[i] == '-') {
+			i++
+		}
+		if i >= len(data) || !isDigit(data[i]) {
+			d.pos = i
+			return nil, d.syntaxError("expected digit in exponent")
+		}
+		for i < len(data) && isDigit(data[i]) {
+			i++
+		}
+	}
+
+	d.pos = i
+	return data[start:i], nil
+}
+
+// skipValue consumes the value at the current position, validating it
+func (d *decoder) skipValue() error {
+	c, err := d.peek()
+	if err != nil {
+		return err
+	}
+
+	switch c {
+	case '{':
+		if err := d.enter(); err != nil {
+			return err
+		}
+		d.pos++
+		first := true
+		for {
+			_, more, err := d.nextKey(&first)
+			if err != nil {
+				return err
+			}
+			if !more {
+				break
+			}
+			if err := d.skipValue(); err != nil {
+				return err
+			}
+		}
+		d.depth--
+		return nil
+	case '[':
+		if err := d.enter(); err != nil {
+			return err
+		}
+		d.pos++
+		first := true
+		for {
+			more, err := d.nextElem(&first)
+			if err != nil {
+				return err
+			}
+			if !more {
+				break
+			}
+			if err := d.skipValue(); err != nil {
+				return err
+			}
+		}
+		d.depth--
+		return nil
+	}
+
+	_, _, err = d.readScalar()
+	return err
+}
+
+func isIntegerLiteral(tok []byte) bool {
+	for _, c := range tok {
+		if c == '.' || c == 'e' || c == 'E' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseInt parses a number literal as an int64. Integers are parsed
+// exactly, other numbers are truncated, like mapstructure does with float64s.
+func parseInt(tok []byte) (int64, error) {
+	if isIntegerLiteral(tok) {
+		digits := tok
+		if digits[0] == '-' {
+			digits = digits[1:]
+		}
+		if len(digits) <= 18 {
+			var n int64
+			for _, c := range digits {
+				n = n*10 + int64(c-'0')
+			}
+			if tok[0] == '-' {
+				n = -n
+			}
+			return n, nil
+		}
+		if n, err := strconv.ParseInt(string(tok), 10, 64); err == nil {
+			return n, nil
+		}
+	}
+
+	f, err := parseFloat(tok)
+	if err != nil {
+		return 0, err
+	}
+	return int64(f), nil
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func parseFloat(tok []byte) (float64, error) {
+	f, err := strconv.ParseFloat(string(tok), 64)
+	if err != nil {
+		return 0, errors.Errorf("cannot parse number %s: %v", tok, err)
+	}
+	return f, nil
+}
+
+// formatNumber formats a number literal the way mapstructure
+// formats a float64 into a string.
+func formatNumber(tok []byte) string {
+	if isIntegerLiteral(tok) && len(tok) <= 15 {
+		return string(tok)
+	}
+	f, err := strconv.ParseFloat(string(tok), 64)
+	if err != nil {
+		return string(tok)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
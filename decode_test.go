@@ -0,0 +1,359 @@
+package itchio
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/assert"
+)
+
+// legacyDecode is the decoding pipeline decodeJSON replaced: encoding/json
+// into a map, camelify, then mapstructure. It's kept around to check that
+// both agree, and to benchmark against.
+func legacyDecode(body []byte, dst interface{}) error {
+	intermediate := make(map[string]interface{})
+	err := json.NewDecoder(bytes.NewReader(body)).Decode(&intermediate)
+	if err != nil {
+		return err
+	}
+	intermediate = camelifyMap(intermediate)
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		TagName:          "json",
+		Result:           dst,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeHookFunc(time.RFC3339Nano),
+			GameHookFunc,
+			UploadHookFunc,
+		),
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(intermediate)
+}
+
+func assertDecodesLikeLegacy(t *testing.T, body string, newDst func() interface{}) interface{} {
+	t.Helper()
+
+	expected := newDst()
+	assert.NoError(t, legacyDecode([]byte(body), expected))
+
+	actual := newDst()
+	assert.NoError(t, decodeJSON([]byte(body), actual))
+	assert.EqualValues(t, expected, actual)
+	return actual
+}
+
+func Test_DecodeLikeLegacy(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   string
+		newDst func() interface{}
+	}{
+		{
+			name:   "owned keys",
+			body:   ownedKeysPayload(3),
+			newDst: func() interface{} { return &ListProfileOwnedKeysResponse{} },
+		},
+		{
+			name:   "collection games",
+			body:   collectionGamesPayload(3),
+			newDst: func() interface{} { return &GetCollectionGamesResponse{} },
+		},
+		{
+			name: "weakly typed",
+			body: `{"user": {"id": "42", "username": 1234, "display_name": true, "developer": "1", "press_user": 0}}`,
+			newDst: func() interface{} {
+				return &GetProfileResponse{}
+			},
+		},
+		{
+			name: "floats and bools into ints",
+			body: `{"game": {"id": 12.9, "min_price": true, "views_count": "0x10", "published": "", "sale": {"rate": "-15.5"}}}`,
+			newDst: func() interface{} {
+				return &GetGameResponse{}
+			},
+		},
+		{
+			name: "nulls",
+			body: `{"game": {"id": 1, "user": null, "created_at": null, "title": null}}`,
+			newDst: func() interface{} {
+				return &GetGameResponse{}
+			},
+		},
+		{
+			name: "empty arrays and objects",
+			body: `{"uploads": {}, "channels": []}`,
+			newDst: func() interface{} {
+				return &struct {
+					Uploads  []*Upload          `json:"uploads"`
+					Channels map[string]Channel `json:"channels"`
+				}{}
+			},
+		},
+		{
+			name: "single value lifted into a slice",
+			body: `{"uploads": {"id": 3, "filename": "a.zip"}, "tags": "one"}`,
+			newDst: func() interface{} {
+				return &struct {
+					Uploads []*Upload `json:"uploads"`
+					Tags    []string  `json:"tags"`
+				}{}
+			},
+		},
+		{
+			name: "array of objects merged into a map",
+			body: `{"channels": [{"windows": {"name": "windows"}}, {"linux": {"name": "linux"}}]}`,
+			newDst: func() interface{} {
+				return &ListChannelsResponse{}
+			},
+		},
+		{
+			name: "upload headers keep their case",
+			body: `{"file": {"upload_url": "https://example.org", "upload_params": {"x_amz_date": "1"}, "upload_headers": {"Content-Type": "application/zip", "x_goog_resumable": "start"}}}`,
+			newDst: func() interface{} {
+				return &CreateBuildFileResponse{}
+			},
+		},
+		{
+			name: "generic values",
+			body: `{"data": {"some_thing": [1, "two", {"nested_key": []}], "empty": []}}`,
+			newDst: func() interface{} {
+				return &struct {
+					Data BuildEventData `json:"data"`
+				}{}
+			},
+		},
+		{
+			name: "game traits",
+			body: `{"game": {"id": 123, "traits": ["in_press_system", "p_linux", "p_windows", "can_be_bought"], "short_text": "hi"}}`,
+			newDst: func() interface{} {
+				return &GetGameResponse{}
+			},
+		},
+		{
+			name: "upload traits",
+			body: `{"uploads": [{"id": 4, "traits": ["p_osx", "demo"], "filename": "b.dmg"}, {"id": 5, "traits": []}]}`,
+			newDst: func() interface{} {
+				return &ListGameUploadsResponse{}
+			},
+		},
+		{
+			name: "escapes and unicode",
+			body: `{"game": {"id": 1, "title": "Café \"Noir\"\n", "short_text": "日本語のゲーム"}}`,
+			newDst: func() interface{} {
+				return &GetGameResponse{}
+			},
+		},
+		{
+			name: "field names without tags",
+			body: `{"launch_count": 3, "Title": "x"}`,
+			newDst: func() interface{} {
+				return &struct {
+					LaunchCount int64
+					Title       string
+				}{}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertDecodesLikeLegacy(t, tc.body, tc.newDst)
+		})
+	}
+}
+
+func Test_DecodeTraits(t *testing.T) {
+	res := assertDecodesLikeLegacy(t, `{"games": [
+		{"id": 1, "traits": ["has_demo", "p_osx"], "user": {"id": 2, "display_name": "Amos"}},
+		{"id": 2, "platforms": {"windows": "amd64"}}
+	]}`, func() interface{} { return &ListProfileGamesResponse{} }).(*ListProfileGamesResponse)
+
+	assert.Len(t, res.Games, 2)
+	assert.True(t, res.Games[0].HasDemo)
+	assert.EqualValues(t, Platforms{OSX: ArchitecturesAll}, res.Games[0].Platforms)
+	assert.EqualValues(t, "Amos", res.Games[0].User.DisplayName)
+	assert.EqualValues(t, Platforms{Windows: ArchitecturesAmd64}, res.Games[1].Platforms)
+}
+
+func Test_DecodeKeepsExistingValues(t *testing.T) {
+	res := GetGameResponse{Game: &Game{ID: 1, Title: "before", URL: "https://example.org"}}
+	assert.NoError(t, decodeJSON([]byte(`{"game": {"title": "after", "url": null}}`), &res))
+	assert.EqualValues(t, 1, res.Game.ID)
+	assert.EqualValues(t, "after", res.Game.Title)
+	assert.EqualValues(t, "https://example.org", res.Game.URL)
+}
+
+func Test_DecodeRawMessage(t *testing.T) {
+	var res struct {
+		Manifest *json.RawMessage
+	}
+	assert.NoError(t, decodeJSON([]byte(`{"manifest": {"actions": [{"name": "play"}]}}`), &res))
+	assert.EqualValues(t, `{"actions": [{"name": "play"}]}`, string(*res.Manifest))
+}
+
+func Test_DecodeErrors(t *testing.T) {
+	var res GetGameResponse
+
+	err := decodeJSON([]byte(`{"game": {"id": 1, "user": {"id": "nope"}}}`), &res)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "'game.user.id'")
+
+	err = decodeJSON([]byte(`{"game": {"id": 1, "created_at": ""}}`), &res)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "'game.createdAt'")
+
+	err = decodeJSON([]byte(`{"game": {"id": 1, "title": ["a", "b"]}}`), &res)
+	assert.Error(t, err)
+
+	for _, body := range []string{
+		``,
+		`[]`,
+		`{"game": }`,
+		`{"game": {"id": 1,}}`,
+		`{"game": {"id": 01}}`,
+		`{"game": {"id": 1} "x": 2}`,
+		`{"game": {"title": "unterminated}}`,
+		`{"unknown": [1, 2, tru]}`,
+	} {
+		var res GetGameResponse
+		assert.Error(t, decodeJSON([]byte(body), &res), "for %q", body)
+		assert.Error(t, legacyDecode([]byte(body), &res), "legacy for %q", body)
+	}
+}
+
+func Test_DecodeErrorsField(t *testing.T) {
+	d := decoder{data: []byte(`{"errors": ["invalid game"], "game": {"id": 1}}`)}
+	var res GetGameResponse
+	assert.NoError(t, d.decode(&res))
+	assert.EqualValues(t, []string{"invalid game"}, errorMessages(d.errorsValue))
+}
+
+func ownedKeysPayload(n int) string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf(`{
+			"id": %d,
+			"game_id": %d,
+			"owner_id": 1234,
+			"created_at": "2019-04-12T13:21:48.000000000Z",
+			"updated_at": "2019-04-12T13:21:48.000000000Z",
+			"purchase_id": 9876,
+			"game": %s
+		}`, 1000+i, 5000+i, gamePayload(5000+i))
+	}
+	return fmt.Sprintf(`{"page": 1, "per_page": %d, "owned_keys": [%s]}`, n, join(keys))
+}
+
+func collectionGamesPayload(n int) string {
+	games := make([]string, n)
+	for i := range games {
+		games[i] = fmt.Sprintf(`{
+			"collection_id": 12,
+			"game_id": %d,
+			"position": %d,
+			"user_id": 1234,
+			"blurb": "one of the best",
+			"created_at": "2019-04-12T13:21:48.000000000Z",
+			"updated_at": "2019-04-12T13:21:48.000000000Z",
+			"game": %s
+		}`, 5000+i, i, gamePayload(5000+i))
+	}
+	return fmt.Sprintf(`{"page": 1, "per_page": %d, "collection_games": [%s]}`, n, join(games))
+}
+
+func gamePayload(id int) string {
+	return fmt.Sprintf(`{
+		"id": %d,
+		"url": "https://someone.itch.io/game-%d",
+		"title": "Game number %d",
+		"short_text": "A game about numbers, and \"quotes\"",
+		"type": "default",
+		"classification": "game",
+		"cover_url": "https://img.itch.zone/aW1hZ2UvMTIzNC81Njc4LnBuZw==/315x250%%23c/abcd.png",
+		"still_cover_url": "https://img.itch.zone/aW1hZ2UvMTIzNC81Njc4LnBuZw==/315x250%%23c/abcd.png",
+		"created_at": "2018-11-12T10:00:00.000000000Z",
+		"published_at": "2018-11-13T10:00:00.000000000Z",
+		"min_price": 500,
+		"can_be_bought": true,
+		"has_demo": false,
+		"in_press_system": true,
+		"platforms": {"windows": "all", "linux": "amd64"},
+		"user_id": 1234,
+		"user": {
+			"id": 1234,
+			"username": "someone",
+			"display_name": "Some One",
+			"url": "https://someone.itch.io",
+			"cover_url": "https://img.itch.zone/avatar.png"
+		},
+		"sale": {
+			"id": 77,
+			"game_id": %d,
+			"rate": 25.5,
+			"start_date": "2019-04-01T00:00:00Z",
+			"end_date": "2019-05-01T00:00:00Z"
+		},
+		"embed": {"game_id": %d, "width": 640, "height": 480, "fullscreen": true}
+	}`, id, id, id, id, id)
+}
+
+func join(items []string) string {
+	var buf bytes.Buffer
+	for i, item := range items {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(item)
+	}
+	return buf.String()
+}
+
+func benchmarkDecode(b *testing.B, body []byte, newDst func() interface{}, decode func([]byte, interface{}) error) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	for i := 0; i < b.N; i++ {
+		if err := decode(body, newDst()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeOwnedKeys(b *testing.B) {
+	body := []byte(ownedKeysPayload(50))
+	newDst := func() interface{} { return &ListProfileOwnedKeysResponse{} }
+	b.Run("legacy", func(b *testing.B) { benchmarkDecode(b, body, newDst, legacyDecode) })
+	b.Run("direct", func(b *testing.B) { benchmarkDecode(b, body, newDst, decodeJSON) })
+}
+
+func BenchmarkDecodeCollectionGames(b *testing.B) {
+	body := []byte(collectionGamesPayload(50))
+	newDst := func() interface{} { return &GetCollectionGamesResponse{} }
+	b.Run("legacy", func(b *testing.B) { benchmarkDecode(b, body, newDst, legacyDecode) })
+	b.Run("direct", func(b *testing.B) { benchmarkDecode(b, body, newDst, decodeJSON) })
+}
+
+// make sure the benchmark payloads decode to something sensible
+func Test_DecodeBenchmarkPayloads(t *testing.T) {
+	res := assertDecodesLikeLegacy(t, ownedKeysPayload(2), func() interface{} {
+		return &ListProfileOwnedKeysResponse{}
+	}).(*ListProfileOwnedKeysResponse)
+
+	assert.Len(t, res.OwnedKeys, 2)
+	key := res.OwnedKeys[1]
+	assert.EqualValues(t, 5001, key.GameID)
+	assert.EqualValues(t, "Some One", key.Game.User.DisplayName)
+	assert.EqualValues(t, 25.5, key.Game.Sale.Rate)
+	assert.EqualValues(t, 640, key.Game.Embed.Width)
+	assert.EqualValues(t, ArchitecturesAmd64, key.Game.Platforms.Linux)
+	assert.False(t, key.Game.CreatedAt.IsZero())
+	assert.True(t, reflect.DeepEqual(key.Game.Sale.EndDate, time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)))
+}
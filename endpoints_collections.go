@@ -15,10 +15,10 @@ type GetCollectionResponse struct {
 }
 
 // GetCollection retrieves a single collection by ID.
-func (c *Client) GetCollection(ctx context.Context, params GetCollectionParams) (*GetCollectionResponse, error) {
+func (c *Client) GetCollection(ctx context.Context, params GetCollectionParams, opts ...CallOption) (*GetCollectionResponse, error) {
 	q := NewQuery(c, "/collections/%d", params.CollectionID)
 	r := &GetCollectionResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -37,9 +37,27 @@ type GetCollectionGamesResponse struct {
 }
 
 // GetCollectionGames retrieves a page of a collection's games.
-func (c *Client) GetCollectionGames(ctx context.Context, params GetCollectionGamesParams) (*GetCollectionGamesResponse, error) {
+func (c *Client) GetCollectionGames(ctx context.Context, params GetCollectionGamesParams, opts ...CallOption) (*GetCollectionGamesResponse, error) {
 	q := NewQuery(c, "/collections/%d/collection-games", params.CollectionID)
 	q.AddInt64IfNonZero("page", params.Page)
 	r := &GetCollectionGamesResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
+}
+
+// AllCollectionGames iterates over all of a collection's games,
+// starting at params.Page (or the first page).
+func (c *Client) AllCollectionGames(ctx context.Context, params GetCollectionGamesParams, opts ...CallOption) *CollectionGamePager {
+	return &CollectionGamePager{newPager(ctx, params.Page, func(ctx context.Context, page int64) ([]interface{}, int64, error) {
+		p := params
+		p.Page = page
+		res, err := c.GetCollectionGames(ctx, p, opts...)
+		if err != nil {
+			return nil, 0, err
+		}
+		items := make([]interface{}, len(res.CollectionGames))
+		for i, cg := range res.CollectionGames {
+			items[i] = cg
+		}
+		return items, res.PerPage, nil
+	})}
 }
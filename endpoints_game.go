@@ -15,9 +15,9 @@ type GetGameResponse struct {
 }
 
 // GetGame retrieves a single game by ID.
-func (c *Client) GetGame(ctx context.Context, p GetGameParams) (*GetGameResponse, error) {
+func (c *Client) GetGame(ctx context.Context, p GetGameParams, opts ...CallOption) (*GetGameResponse, error) {
 	q := NewQuery(c, "/games/%d", p.GameID)
 	q.AddGameCredentials(p.Credentials)
 	r := &GetGameResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
@@ -32,7 +32,7 @@ type LoginWithPasswordResponse struct {
 // their username (or e-mail) and password.
 // The response may indicate that a TOTP code is needed (for two-factor auth),
 // or a recaptcha challenge is needed (an unfortunate remedy for an unfortunate ailment).
-func (c *Client) LoginWithPassword(ctx context.Context, params LoginWithPasswordParams) (*LoginWithPasswordResponse, error) {
+func (c *Client) LoginWithPassword(ctx context.Context, params LoginWithPasswordParams, opts ...CallOption) (*LoginWithPasswordResponse, error) {
 	q := NewQuery(c, "/login")
 	q.AddString("source", "desktop")
 	q.AddString("username", params.Username)
@@ -41,7 +41,7 @@ func (c *Client) LoginWithPassword(ctx context.Context, params LoginWithPassword
 	q.AddBoolIfTrue("force_recaptcha", params.ForceRecaptcha)
 
 	r := &LoginWithPasswordResponse{}
-	return r, q.Post(ctx, r)
+	return r, q.Post(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -60,13 +60,13 @@ type TOTPVerifyResponse struct {
 
 // TOTPVerify sends a user-entered TOTP token to the server for
 // verification (and to complete login).
-func (c *Client) TOTPVerify(ctx context.Context, params TOTPVerifyParams) (*TOTPVerifyResponse, error) {
+func (c *Client) TOTPVerify(ctx context.Context, params TOTPVerifyParams, opts ...CallOption) (*TOTPVerifyResponse, error) {
 	q := NewQuery(c, "/totp/verify")
 	q.AddString("token", params.Token)
 	q.AddString("code", params.Code)
 
 	r := &TOTPVerifyResponse{}
-	return r, q.Post(ctx, r)
+	return r, q.Post(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -105,7 +105,7 @@ func (r *ExchangeOAuthCodeResponse) OAuthCredentials() *OAuthCredentials {
 
 // ExchangeOAuthCode exchanges an OAuth authorization code (with PKCE) for an API key.
 // Used by the desktop app's OAuth login flow.
-func (c *Client) ExchangeOAuthCode(ctx context.Context, params ExchangeOAuthCodeParams) (*ExchangeOAuthCodeResponse, error) {
+func (c *Client) ExchangeOAuthCode(ctx context.Context, params ExchangeOAuthCodeParams, opts ...CallOption) (*ExchangeOAuthCodeResponse, error) {
 	q := NewQuery(c, "/oauth/token")
 	q.AddString("grant_type", "authorization_code")
 	q.AddString("code", params.Code)
@@ -114,7 +114,7 @@ func (c *Client) ExchangeOAuthCode(ctx context.Context, params ExchangeOAuthCode
 	q.AddString("client_id", params.ClientID)
 
 	r := &ExchangeOAuthCodeResponse{}
-	return r, q.Post(ctx, r)
+	return r, q.Post(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -134,13 +134,13 @@ type SubkeyResponse struct {
 // Subkey creates a scoped-down, temporary offspring of the main
 // API key this client was created with. It is useful to automatically grant
 // some access to games being launched.
-func (c *Client) Subkey(ctx context.Context, params SubkeyParams) (*SubkeyResponse, error) {
+func (c *Client) Subkey(ctx context.Context, params SubkeyParams, opts ...CallOption) (*SubkeyResponse, error) {
 	q := NewQuery(c, "/credentials/subkey")
 	q.AddInt64("game_id", params.GameID)
 	q.AddString("scope", params.Scope)
 
 	r := &SubkeyResponse{}
-	return r, q.Post(ctx, r)
+	return r, q.Post(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -160,12 +160,12 @@ type RefreshOAuthTokenResponse struct {
 
 // RefreshOAuthToken exchanges a refresh token for a new access token.
 // This is called automatically by OAuth clients when tokens are near expiry.
-func (c *Client) RefreshOAuthToken(ctx context.Context, params RefreshOAuthTokenParams) (*RefreshOAuthTokenResponse, error) {
+func (c *Client) RefreshOAuthToken(ctx context.Context, params RefreshOAuthTokenParams, opts ...CallOption) (*RefreshOAuthTokenResponse, error) {
 	q := NewQuery(c, "/oauth/token")
 	q.AddString("grant_type", "refresh_token")
 	q.AddString("refresh_token", params.RefreshToken)
 	q.AddString("client_id", params.ClientID)
 
 	r := &RefreshOAuthTokenResponse{}
-	return r, q.Post(ctx, r)
+	return r, q.Post(ctx, r, opts...)
 }
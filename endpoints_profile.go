@@ -10,10 +10,10 @@ type GetProfileResponse struct {
 }
 
 // GetProfile returns information about the user the current credentials belong to
-func (c *Client) GetProfile(ctx context.Context) (*GetProfileResponse, error) {
+func (c *Client) GetProfile(ctx context.Context, opts ...CallOption) (*GetProfileResponse, error) {
 	q := NewQuery(c, "/profile")
 	r := &GetProfileResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -25,10 +25,10 @@ type ListProfileGamesResponse struct {
 }
 
 // ListProfileGames lists the games one develops (ie. can edit)
-func (c *Client) ListProfileGames(ctx context.Context) (*ListProfileGamesResponse, error) {
+func (c *Client) ListProfileGames(ctx context.Context, opts ...CallOption) (*ListProfileGamesResponse, error) {
 	q := NewQuery(c, "/profile/games")
 	r := &ListProfileGamesResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -47,11 +47,29 @@ type ListProfileOwnedKeysResponse struct {
 
 // ListProfileOwnedKeys lists the download keys the account with
 // the current API key owns.
-func (c *Client) ListProfileOwnedKeys(ctx context.Context, p ListProfileOwnedKeysParams) (*ListProfileOwnedKeysResponse, error) {
+func (c *Client) ListProfileOwnedKeys(ctx context.Context, p ListProfileOwnedKeysParams, opts ...CallOption) (*ListProfileOwnedKeysResponse, error) {
 	q := NewQuery(c, "/profile/owned-keys")
 	q.AddInt64IfNonZero("page", p.Page)
 	r := &ListProfileOwnedKeysResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
+}
+
+// AllOwnedKeys iterates over all the download keys the account with the
+// current API key owns, starting at p.Page (or the first page).
+func (c *Client) AllOwnedKeys(ctx context.Context, p ListProfileOwnedKeysParams, opts ...CallOption) *DownloadKeyPager {
+	return &DownloadKeyPager{newPager(ctx, p.Page, func(ctx context.Context, page int64) ([]interface{}, int64, error) {
+		params := p
+		params.Page = page
+		res, err := c.ListProfileOwnedKeys(ctx, params, opts...)
+		if err != nil {
+			return nil, 0, err
+		}
+		items := make([]interface{}, len(res.OwnedKeys))
+		for i, dk := range res.OwnedKeys {
+			items[i] = dk
+		}
+		return items, res.PerPage, nil
+	})}
 }
 
 //-------------------------------------------------------
@@ -62,8 +80,8 @@ type ListProfileCollectionsResponse struct {
 }
 
 // ListProfileCollections lists the collections associated to a profile.
-func (c *Client) ListProfileCollections(ctx context.Context) (*ListProfileCollectionsResponse, error) {
+func (c *Client) ListProfileCollections(ctx context.Context, opts ...CallOption) (*ListProfileCollectionsResponse, error) {
 	q := NewQuery(c, "/profile/collections")
 	r := &ListProfileCollectionsResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
@@ -18,12 +18,30 @@ type SearchGamesResponse struct {
 // SearchGames performs a text search for games (or any project type).
 // The games must be published, and not deindexed. There are a bunch
 // of subtleties about visibility and ranking, but that's internal.
-func (c *Client) SearchGames(ctx context.Context, params SearchGamesParams) (*SearchGamesResponse, error) {
+func (c *Client) SearchGames(ctx context.Context, params SearchGamesParams, opts ...CallOption) (*SearchGamesResponse, error) {
 	q := NewQuery(c, "/search/games")
 	q.AddString("query", params.Query)
 	q.AddInt64IfNonZero("page", params.Page)
 	r := &SearchGamesResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
+}
+
+// SearchAllGames iterates over all the results of a game search,
+// starting at params.Page (or the first page).
+func (c *Client) SearchAllGames(ctx context.Context, params SearchGamesParams, opts ...CallOption) *GamePager {
+	return &GamePager{newPager(ctx, params.Page, func(ctx context.Context, page int64) ([]interface{}, int64, error) {
+		p := params
+		p.Page = page
+		res, err := c.SearchGames(ctx, p, opts...)
+		if err != nil {
+			return nil, 0, err
+		}
+		items := make([]interface{}, len(res.Games))
+		for i, g := range res.Games {
+			items[i] = g
+		}
+		return items, res.PerPage, nil
+	})}
 }
 
 //-------------------------------------------------------
@@ -42,10 +60,28 @@ type SearchUsersResponse struct {
 }
 
 // SearchUsers performs a text search for users.
-func (c *Client) SearchUsers(ctx context.Context, params SearchUsersParams) (*SearchUsersResponse, error) {
+func (c *Client) SearchUsers(ctx context.Context, params SearchUsersParams, opts ...CallOption) (*SearchUsersResponse, error) {
 	q := NewQuery(c, "/search/users")
 	q.AddString("query", params.Query)
 	q.AddInt64IfNonZero("page", params.Page)
 	r := &SearchUsersResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
+}
+
+// SearchAllUsers iterates over all the results of a user search,
+// starting at params.Page (or the first page).
+func (c *Client) SearchAllUsers(ctx context.Context, params SearchUsersParams, opts ...CallOption) *UserPager {
+	return &UserPager{newPager(ctx, params.Page, func(ctx context.Context, page int64) ([]interface{}, int64, error) {
+		p := params
+		p.Page = page
+		res, err := c.SearchUsers(ctx, p, opts...)
+		if err != nil {
+			return nil, 0, err
+		}
+		items := make([]interface{}, len(res.Users))
+		for i, u := range res.Users {
+			items[i] = u
+		}
+		return items, res.PerPage, nil
+	})}
 }
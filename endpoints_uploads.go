@@ -32,11 +32,11 @@ type ListGameUploadsResponse struct {
 
 // ListGameUploads lists the uploads for a game that we have access to with our API key
 // and game credentials.
-func (c *Client) ListGameUploads(ctx context.Context, p ListGameUploadsParams) (*ListGameUploadsResponse, error) {
+func (c *Client) ListGameUploads(ctx context.Context, p ListGameUploadsParams, opts ...CallOption) (*ListGameUploadsResponse, error) {
 	q := NewQuery(c, "/games/%d/uploads", p.GameID)
 	q.AddGameCredentials(p.Credentials)
 	r := &ListGameUploadsResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -55,11 +55,11 @@ type GetUploadResponse struct {
 }
 
 // GetUpload retrieves information about a single upload, by ID.
-func (c *Client) GetUpload(ctx context.Context, params GetUploadParams) (*GetUploadResponse, error) {
+func (c *Client) GetUpload(ctx context.Context, params GetUploadParams, opts ...CallOption) (*GetUploadResponse, error) {
 	q := NewQuery(c, "/uploads/%d", params.UploadID)
 	q.AddGameCredentials(params.Credentials)
 	r := &GetUploadResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -78,11 +78,11 @@ type ListUploadBuildsResponse struct {
 }
 
 // ListUploadBuilds lists recent builds for a given upload, by ID.
-func (c *Client) ListUploadBuilds(ctx context.Context, params ListUploadBuildsParams) (*ListUploadBuildsResponse, error) {
+func (c *Client) ListUploadBuilds(ctx context.Context, params ListUploadBuildsParams, opts ...CallOption) (*ListUploadBuildsResponse, error) {
 	q := NewQuery(c, "/uploads/%d/builds", params.UploadID)
 	q.AddGameCredentials(params.Credentials)
 	r := &ListUploadBuildsResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -101,11 +101,11 @@ type GetBuildResponse struct {
 }
 
 // GetBuild retrieves info about a single build, by ID.
-func (c *Client) GetBuild(ctx context.Context, p GetBuildParams) (*GetBuildResponse, error) {
+func (c *Client) GetBuild(ctx context.Context, p GetBuildParams, opts ...CallOption) (*GetBuildResponse, error) {
 	q := NewQuery(c, "/builds/%d", p.BuildID)
 	q.AddGameCredentials(p.Credentials)
 	r := &GetBuildResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -132,11 +132,11 @@ type UpgradePath struct {
 // GetBuildUpgradePath returns the complete list of builds one
 // needs to go through to go from one version to another.
 // It only works when upgrading (at the time of this writing).
-func (c *Client) GetBuildUpgradePath(ctx context.Context, p GetBuildUpgradePathParams) (*GetBuildUpgradePathResponse, error) {
+func (c *Client) GetBuildUpgradePath(ctx context.Context, p GetBuildUpgradePathParams, opts ...CallOption) (*GetBuildUpgradePathResponse, error) {
 	q := NewQuery(c, "/builds/%d/upgrade-paths/%d", p.CurrentBuildID, p.TargetBuildID)
 	q.AddGameCredentials(p.Credentials)
 	r := &GetBuildUpgradePathResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -157,11 +157,11 @@ type NewDownloadSessionResponse struct {
 // for more accurate download analytics. Downloading multiple patch
 // and signature files may all be part of the same "download session":
 // upgrading a game to its latest version. It should only count as one download.
-func (c *Client) NewDownloadSession(ctx context.Context, p NewDownloadSessionParams) (*NewDownloadSessionResponse, error) {
+func (c *Client) NewDownloadSession(ctx context.Context, p NewDownloadSessionParams, opts ...CallOption) (*NewDownloadSessionResponse, error) {
 	q := NewQuery(c, "/games/%d/download-sessions", p.GameID)
 	q.AddGameCredentials(p.Credentials)
 	r := &NewDownloadSessionResponse{}
-	return r, q.Post(ctx, r)
+	return r, q.Post(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -177,13 +177,24 @@ type MakeUploadDownloadURLParams struct {
 	Credentials GameCredentials
 }
 
-// MakeUploadDownloadURL generates a download URL for an upload
+// MakeUploadDownloadURL generates a download URL for an upload.
+// It returns an empty string if the client's credentials can't be
+// renewed, see MakeUploadDownloadURLContext.
 func (c *Client) MakeUploadDownloadURL(p MakeUploadDownloadURLParams) string {
+	url, _ := c.MakeUploadDownloadURLContext(context.Background(), p)
+	return url
+}
+
+// MakeUploadDownloadURLContext generates a download URL for an upload,
+// renewing the client's credentials first if needed
+func (c *Client) MakeUploadDownloadURLContext(ctx context.Context, p MakeUploadDownloadURLParams) (string, error) {
 	q := NewQuery(c, "uploads/%d/download", p.UploadID)
-	q.AddAPICredentials()
+	if err := q.AddAPICredentialsContext(ctx); err != nil {
+		return "", err
+	}
 	q.AddGameCredentials(p.Credentials)
 	q.AddStringIfNonEmpty("uuid", p.UUID)
-	return q.URL()
+	return q.URL(), nil
 }
 
 //-------------------------------------------------------
@@ -203,18 +214,29 @@ type MakeBuildDownloadURLParams struct {
 	Credentials GameCredentials
 }
 
-// MakeBuildDownloadURL generates as download URL for a specific build
+// MakeBuildDownloadURL generates as download URL for a specific build.
+// It returns an empty string if the client's credentials can't be
+// renewed, see MakeBuildDownloadURLContext.
 func (c *Client) MakeBuildDownloadURL(p MakeBuildDownloadURLParams) string {
+	url, _ := c.MakeBuildDownloadURLContext(context.Background(), p)
+	return url
+}
+
+// MakeBuildDownloadURLContext generates as download URL for a specific
+// build, renewing the client's credentials first if needed
+func (c *Client) MakeBuildDownloadURLContext(ctx context.Context, p MakeBuildDownloadURLParams) (string, error) {
 	subType := p.SubType
 	if subType == "" {
 		subType = BuildFileSubTypeDefault
 	}
 
 	q := NewQuery(c, "builds/%d/download/%s/%s", p.BuildID, p.Type, subType)
-	q.AddAPICredentials()
+	if err := q.AddAPICredentialsContext(ctx); err != nil {
+		return "", err
+	}
 	q.AddGameCredentials(p.Credentials)
 	q.AddStringIfNonEmpty("uuid", p.UUID)
-	return q.URL()
+	return q.URL(), nil
 }
 
 type GetUploadScannedArchiveParams struct {
@@ -251,16 +273,16 @@ const (
 	ScannedArchiveObjectTypeBuild  ScannedArchiveObjectType = "build"
 )
 
-func (c *Client) GetUploadScannedArchive(ctx context.Context, p GetUploadScannedArchiveParams) (*GetScannedArchiveResponse, error) {
+func (c *Client) GetUploadScannedArchive(ctx context.Context, p GetUploadScannedArchiveParams, opts ...CallOption) (*GetScannedArchiveResponse, error) {
 	q := NewQuery(c, "/uploads/%d/scanned-archive", p.UploadID)
 	q.AddGameCredentials(p.Credentials)
 	r := &GetScannedArchiveResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
 
-func (c *Client) GetBuildScannedArchive(ctx context.Context, p GetBuildScannedArchiveParams) (*GetScannedArchiveResponse, error) {
+func (c *Client) GetBuildScannedArchive(ctx context.Context, p GetBuildScannedArchiveParams, opts ...CallOption) (*GetScannedArchiveResponse, error) {
 	q := NewQuery(c, "/builds/%d/scanned-archive", p.BuildID)
 	q.AddGameCredentials(p.Credentials)
 	r := &GetScannedArchiveResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
@@ -13,8 +13,8 @@ type GetUserResponse struct {
 }
 
 // GetUser retrieves info about a single user, by ID.
-func (c *Client) GetUser(ctx context.Context, p GetUserParams) (*GetUserResponse, error) {
+func (c *Client) GetUser(ctx context.Context, p GetUserParams, opts ...CallOption) (*GetUserResponse, error) {
 	q := NewQuery(c, "/users/%d", p.UserID)
 	r := &GetUserResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
@@ -16,10 +16,10 @@ type WharfStatusResponse struct {
 }
 
 // WharfStatus requests the status of the wharf infrastructure
-func (c *Client) WharfStatus(ctx context.Context) (*WharfStatusResponse, error) {
+func (c *Client) WharfStatus(ctx context.Context, opts ...CallOption) (*WharfStatusResponse, error) {
 	q := NewQuery(c, "/wharf/status")
 	r := &WharfStatusResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -42,11 +42,11 @@ type Channel struct {
 }
 
 // ListChannels returns a list of the channels for a game
-func (c *Client) ListChannels(ctx context.Context, target string) (*ListChannelsResponse, error) {
+func (c *Client) ListChannels(ctx context.Context, target string, opts ...CallOption) (*ListChannelsResponse, error) {
 	q := NewQuery(c, "/wharf/channels")
 	q.AddString("target", target)
 	r := &ListChannelsResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -57,11 +57,11 @@ type GetChannelResponse struct {
 }
 
 // GetChannel returns information about a given channel for a given game
-func (c *Client) GetChannel(ctx context.Context, target string, channel string) (*GetChannelResponse, error) {
+func (c *Client) GetChannel(ctx context.Context, target string, channel string, opts ...CallOption) (*GetChannelResponse, error) {
 	q := NewQuery(c, "/wharf/channels/%s", channel)
 	q.AddString("target", target)
 	r := &GetChannelResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -86,13 +86,13 @@ type CreateBuildResponse struct {
 
 // CreateBuild creates a new build for a given user/game:channel, with
 // an optional user version
-func (c *Client) CreateBuild(ctx context.Context, p CreateBuildParams) (*CreateBuildResponse, error) {
+func (c *Client) CreateBuild(ctx context.Context, p CreateBuildParams, opts ...CallOption) (*CreateBuildResponse, error) {
 	q := NewQuery(c, "/wharf/builds")
 	q.AddString("target", p.Target)
 	q.AddString("channel", p.Channel)
 	q.AddStringIfNonEmpty("user_version", p.UserVersion)
 	r := &CreateBuildResponse{}
-	return r, q.Post(ctx, r)
+	return r, q.Post(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -103,10 +103,10 @@ type ListBuildFilesResponse struct {
 }
 
 // ListBuildFiles returns a list of files associated to a build
-func (c *Client) ListBuildFiles(ctx context.Context, buildID int64) (*ListBuildFilesResponse, error) {
+func (c *Client) ListBuildFiles(ctx context.Context, buildID int64, opts ...CallOption) (*ListBuildFilesResponse, error) {
 	q := NewQuery(c, "/wharf/builds/%d/files", buildID)
 	r := &ListBuildFilesResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -150,14 +150,14 @@ type CreateBuildFileResponse struct {
 }
 
 // CreateBuildFile creates a new build file for a build.
-func (c *Client) CreateBuildFile(ctx context.Context, p CreateBuildFileParams) (*CreateBuildFileResponse, error) {
+func (c *Client) CreateBuildFile(ctx context.Context, p CreateBuildFileParams, opts ...CallOption) (*CreateBuildFileResponse, error) {
 	q := NewQuery(c, "/wharf/builds/%d/files", p.BuildID)
 	q.AddString("type", string(p.Type))
 	q.AddStringIfNonEmpty("sub_type", string(p.SubType))
 	q.AddStringIfNonEmpty("upload_type", string(p.FileUploadType))
 	q.AddStringIfNonEmpty("filename", p.Filename)
 	r := &CreateBuildFileResponse{}
-	return r, q.Post(ctx, r)
+	return r, q.Post(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -175,11 +175,11 @@ type FinalizeBuildFileResponse struct{}
 // FinalizeBuildFile marks the end of the upload for a build file.
 // It validates that the size of the file in storage is the same
 // we pass to this API call.
-func (c *Client) FinalizeBuildFile(ctx context.Context, p FinalizeBuildFileParams) (*FinalizeBuildFileResponse, error) {
+func (c *Client) FinalizeBuildFile(ctx context.Context, p FinalizeBuildFileParams, opts ...CallOption) (*FinalizeBuildFileResponse, error) {
 	q := NewQuery(c, "/wharf/builds/%d/files/%d", p.BuildID, p.FileID)
 	q.AddInt64("size", p.Size)
 	r := &FinalizeBuildFileResponse{}
-	return r, q.Post(ctx, r)
+	return r, q.Post(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -195,11 +195,22 @@ type MakeBuildFileDownloadURLParams struct {
 	FileID  int64
 }
 
-// MakeBuildFileDownloadURL returns a download URL for a given build file
+// MakeBuildFileDownloadURL returns a download URL for a given build file.
+// It returns an empty string if the client's credentials can't be
+// renewed, see MakeBuildFileDownloadURLContext.
 func (c *Client) MakeBuildFileDownloadURL(p MakeBuildFileDownloadURLParams) string {
+	url, _ := c.MakeBuildFileDownloadURLContext(context.Background(), p)
+	return url
+}
+
+// MakeBuildFileDownloadURLContext returns a download URL for a given
+// build file, renewing the client's credentials first if needed
+func (c *Client) MakeBuildFileDownloadURLContext(ctx context.Context, p MakeBuildFileDownloadURLParams) (string, error) {
 	q := NewQuery(c, "/wharf/builds/%d/files/%d/download", p.BuildID, p.FileID)
-	q.AddAPICredentials()
-	return q.URL()
+	if err := q.AddAPICredentialsContext(ctx); err != nil {
+		return "", err
+	}
+	return q.URL(), nil
 }
 
 //-------------------------------------------------------
@@ -227,7 +238,7 @@ type BuildEventData map[string]interface{}
 type CreateBuildEventResponse struct{}
 
 // CreateBuildEvent associates a new build event to a build
-func (c *Client) CreateBuildEvent(ctx context.Context, p CreateBuildEventParams) (*CreateBuildEventResponse, error) {
+func (c *Client) CreateBuildEvent(ctx context.Context, p CreateBuildEventParams, opts ...CallOption) (*CreateBuildEventResponse, error) {
 	q := NewQuery(c, "/wharf/builds/%d/events", p.BuildID)
 	q.AddString("type", string(p.Type))
 	q.AddString("message", p.Message)
@@ -238,7 +249,7 @@ func (c *Client) CreateBuildEvent(ctx context.Context, p CreateBuildEventParams)
 	}
 	q.AddString("data", string(jsonData))
 	r := &CreateBuildEventResponse{}
-	return r, q.Post(ctx, r)
+	return r, q.Post(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -255,12 +266,12 @@ type CreateBuildFailureResponse struct{}
 
 // CreateBuildFailure marks a given build as failed. We get to specify an error message and
 // if it's a fatal error (if not, the build can be retried after a bit)
-func (c *Client) CreateBuildFailure(ctx context.Context, p CreateBuildFailureParams) (*CreateBuildFailureResponse, error) {
+func (c *Client) CreateBuildFailure(ctx context.Context, p CreateBuildFailureParams, opts ...CallOption) (*CreateBuildFailureResponse, error) {
 	q := NewQuery(c, "/wharf/builds/%d/failures", p.BuildID)
 	q.AddString("message", p.Message)
 	q.AddBoolIfTrue("fatal", p.Fatal)
 	r := &CreateBuildFailureResponse{}
-	return r, q.Post(ctx, r)
+	return r, q.Post(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -275,11 +286,11 @@ type CreateRediffBuildFailureParams struct {
 type CreateRediffBuildFailureResponse struct{}
 
 // CreateRediffBuildFailure marks a given build as having failed to rediff (optimize)
-func (c *Client) CreateRediffBuildFailure(ctx context.Context, p CreateRediffBuildFailureParams) (*CreateRediffBuildFailureResponse, error) {
+func (c *Client) CreateRediffBuildFailure(ctx context.Context, p CreateRediffBuildFailureParams, opts ...CallOption) (*CreateRediffBuildFailureResponse, error) {
 	q := NewQuery(c, "/wharf/builds/%d/failures/rediff", p.BuildID)
 	q.AddString("message", p.Message)
 	r := &CreateRediffBuildFailureResponse{}
-	return r, q.Post(ctx, r)
+	return r, q.Post(ctx, r, opts...)
 }
 
 //-------------------------------------------------------
@@ -297,8 +308,8 @@ type BuildEvent struct {
 }
 
 // ListBuildEvents returns a series of events associated with a given build
-func (c *Client) ListBuildEvents(ctx context.Context, buildID int64) (*ListBuildEventsResponse, error) {
+func (c *Client) ListBuildEvents(ctx context.Context, buildID int64, opts ...CallOption) (*ListBuildEventsResponse, error) {
 	q := NewQuery(c, "/wharf/builds/%d/events", buildID)
 	r := &ListBuildEventsResponse{}
-	return r, q.Get(ctx, r)
+	return r, q.Get(ctx, r, opts...)
 }
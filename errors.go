@@ -2,23 +2,131 @@ package itchio
 
 import (
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/pkg/errors"
 )
 
+var (
+	// ErrUnauthorized matches API errors with HTTP status 401: missing, invalid or expired credentials
+	ErrUnauthorized = errors.New("itch.io API: unauthorized")
+	// ErrForbidden matches API errors with HTTP status 403: credentials are valid, but lack access
+	ErrForbidden = errors.New("itch.io API: forbidden")
+	// ErrNotFound matches API errors with HTTP status 404
+	ErrNotFound = errors.New("itch.io API: not found")
+	// ErrRateLimited matches API errors with HTTP status 429 or 503 (which is
+	// what the itch.io rate limiter responds with), once all retries are exhausted
+	ErrRateLimited = errors.New("itch.io API: rate limited")
+	// ErrServerUnavailable matches API errors with HTTP status 502, 503 or 504
+	ErrServerUnavailable = errors.New("itch.io API: server unavailable")
+	// ErrDecode matches errors that happen when an API response can't be decoded
+	ErrDecode = errors.New("itch.io API: could not decode response")
+	// ErrReauthRequired is returned by OAuth clients once their refresh token
+	// has been rejected: users need to log in again, see OAuthConfig.OnReauthRequired
+	ErrReauthRequired = errors.New("itchio: OAuth session ended, users need to log in again")
+)
+
+// maxBodyExcerpt is how many bytes of a response body errors keep around
+const maxBodyExcerpt = 512
+
 // APIError represents an itch.io API error. Some errors
 // are just HTTP status codes, others have more detailed messages.
+//
+// Use errors.Is with ErrUnauthorized, ErrForbidden, ErrNotFound,
+// ErrRateLimited or ErrServerUnavailable to check for common cases.
 type APIError struct {
 	Messages   []string `json:"messages"`
 	StatusCode int      `json:"statusCode"`
 	Path       string   `json:"path"`
+	Method     string   `json:"method,omitempty"`
+	// RequestID identifies the request server-side, if the server sent one
+	RequestID string `json:"requestId,omitempty"`
+	// Body is the beginning of the response body, with secrets redacted
+	Body string `json:"body,omitempty"`
 }
 
 var _ error = (*APIError)(nil)
 
 func (ae *APIError) Error() string {
-	return fmt.Sprintf("itch.io API error (%d): %s: %s", ae.StatusCode, ae.Path, strings.Join(ae.Messages, ", "))
+	details := strings.Join(ae.Messages, ", ")
+	if details == "" {
+		details = fmt.Sprintf("HTTP %d %s", ae.StatusCode, http.StatusText(ae.StatusCode))
+	}
+	return fmt.Sprintf("itch.io API error (%d): %s: %s", ae.StatusCode, ae.Path, details)
+}
+
+// Is allows matching API errors against sentinel errors with errors.Is
+func (ae *APIError) Is(target error) bool {
+	return statusMatches(ae.StatusCode, target)
+}
+
+func statusMatches(statusCode int, target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return statusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return statusCode == http.StatusForbidden
+	case ErrNotFound:
+		return statusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return isRateLimitedStatus(statusCode)
+	case ErrServerUnavailable:
+		switch statusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	return false
+}
+
+// A DecodeError is returned when an API response can't be decoded,
+// because it's not valid JSON, or because it doesn't have the expected
+// shape. It matches ErrDecode with errors.Is.
+type DecodeError struct {
+	StatusCode int
+	Path       string
+	Method     string
+	RequestID  string
+	// Body is the beginning of the response body, with secrets redacted
+	Body string
+	// Err is the underlying JSON or decoding error
+	Err error
+}
+
+var _ error = (*DecodeError)(nil)
+
+func (de *DecodeError) Error() string {
+	return fmt.Sprintf("itch.io API: could not decode response (%d) for %s %s: %v\n\nBody: %s\n\n", de.StatusCode, de.Method, de.Path, de.Err, de.Body)
+}
+
+// Is allows matching decode errors against ErrDecode with errors.Is
+func (de *DecodeError) Is(target error) bool {
+	return target == ErrDecode
+}
+
+// Unwrap returns the underlying decoding error
+func (de *DecodeError) Unwrap() error {
+	return de.Err
+}
+
+// reauthRequiredError is returned by the refresh that found out an OAuth
+// session was over. It matches ErrReauthRequired with errors.Is, and
+// unwraps to the refresh error.
+type reauthRequiredError struct {
+	err error
+}
+
+func (e *reauthRequiredError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrReauthRequired, e.err)
+}
+
+func (e *reauthRequiredError) Is(target error) bool {
+	return target == ErrReauthRequired
+}
+
+func (e *reauthRequiredError) Unwrap() error {
+	return e.err
 }
 
 // IsAPIError returns true if an error is an itch.io API error,
@@ -32,7 +140,65 @@ func IsAPIError(err error) bool {
 // passed error (no matter how deeply wrapped it is)
 // is an *APIError. Otherwise it returns nil, false.
 func AsAPIError(err error) (*APIError, bool) {
-	rootErr := errors.Cause(err)
-	apiError, ok := rootErr.(*APIError)
+	var apiError *APIError
+	ok := errors.As(err, &apiError)
 	return apiError, ok
 }
+
+// A BodyNotReplayableError is returned when a request needs to be sent
+// again (to retry it, or after refreshing credentials), but its body was
+// already consumed and cannot be rebuilt because GetBody is not set.
+type BodyNotReplayableError struct {
+	Method string
+	Path   string
+}
+
+var _ error = (*BodyNotReplayableError)(nil)
+
+func (e *BodyNotReplayableError) Error() string {
+	return fmt.Sprintf("cannot send %s %s again: request body was consumed and GetBody is not set", e.Method, e.Path)
+}
+
+// requestID returns the identifier the server assigned to a request, if any
+func requestID(header http.Header) string {
+	return header.Get("X-Request-Id")
+}
+
+// bodyExcerpt returns the beginning of a response body, with secrets redacted
+func bodyExcerpt(contentType string, body []byte) string {
+	excerpt := RedactBody(contentType, body)
+	if len(excerpt) > maxBodyExcerpt {
+		return string(excerpt[:maxBodyExcerpt]) + "..."
+	}
+	return string(excerpt)
+}
+
+// newAPIError returns an *APIError describing res
+func newAPIError(res *http.Response, body []byte, messages []string) *APIError {
+	ae := &APIError{
+		Messages:   messages,
+		StatusCode: res.StatusCode,
+		RequestID:  requestID(res.Header),
+		Body:       bodyExcerpt(res.Header.Get("Content-Type"), body),
+	}
+	if res.Request != nil {
+		ae.Method = res.Request.Method
+		ae.Path = res.Request.URL.Path
+	}
+	return ae
+}
+
+// newDecodeError returns a *DecodeError describing why res couldn't be decoded
+func newDecodeError(res *http.Response, body []byte, err error) *DecodeError {
+	de := &DecodeError{
+		StatusCode: res.StatusCode,
+		RequestID:  requestID(res.Header),
+		Body:       bodyExcerpt(res.Header.Get("Content-Type"), body),
+		Err:        err,
+	}
+	if res.Request != nil {
+		de.Method = res.Request.Method
+		de.Path = res.Request.URL.Path
+	}
+	return de
+}
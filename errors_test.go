@@ -0,0 +1,87 @@
+package itchio
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorTaxonomy(t *testing.T) {
+	cases := []struct {
+		status   int
+		body     string
+		sentinel error
+	}{
+		{401, `{"errors":["invalid key"]}`, ErrUnauthorized},
+		{403, `{"errors":["no access"]}`, ErrForbidden},
+		{404, `not found`, ErrNotFound},
+		{429, ``, ErrRateLimited},
+		{502, `<html>bad gateway</html>`, ErrServerUnavailable},
+	}
+
+	for _, tc := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Request-Id", "req-123")
+			w.WriteHeader(tc.status)
+			_, _ = w.Write([]byte(tc.body))
+		}))
+
+		client := newTestKeyClient(server)
+		client.RetryPolicy = NoRetry
+
+		_, err := client.GetGame(context.Background(), GetGameParams{GameID: 3})
+		assert.True(t, errors.Is(err, tc.sentinel), "HTTP %d should match %v", tc.status, tc.sentinel)
+		assert.False(t, errors.Is(err, ErrDecode))
+
+		var ae *APIError
+		if assert.True(t, errors.As(err, &ae)) {
+			assert.Equal(t, tc.status, ae.StatusCode)
+			assert.Equal(t, "GET", ae.Method)
+			assert.Equal(t, "/games/3", ae.Path)
+			assert.Equal(t, "req-123", ae.RequestID)
+		}
+		assert.True(t, IsAPIError(err))
+
+		server.Close()
+	}
+}
+
+func TestServiceUnavailableMatchesRateLimited(t *testing.T) {
+	ae := &APIError{StatusCode: 503}
+	assert.True(t, errors.Is(ae, ErrRateLimited))
+	assert.True(t, errors.Is(ae, ErrServerUnavailable))
+	assert.False(t, errors.Is(ae, ErrNotFound))
+	assert.Equal(t, "itch.io API error (503): : HTTP 503 Service Unavailable", ae.Error())
+}
+
+func TestDecodeError(t *testing.T) {
+	server, client := testTools(200, `{"game": {"id": 1`)
+	defer server.Close()
+
+	_, err := client.GetGame(context.Background(), GetGameParams{GameID: 1})
+	assert.True(t, errors.Is(err, ErrDecode))
+	assert.False(t, IsAPIError(err))
+
+	var de *DecodeError
+	if assert.True(t, errors.As(err, &de)) {
+		assert.Equal(t, 200, de.StatusCode)
+		assert.Equal(t, "/games/1", de.Path)
+		assert.Contains(t, de.Body, `"id": 1`)
+		assert.Error(t, de.Unwrap())
+	}
+}
+
+func TestBodyExcerptIsRedactedAndTruncated(t *testing.T) {
+	excerpt := bodyExcerpt("application/json", []byte(`{"password":"hunter2"}`))
+	assert.NotContains(t, excerpt, "hunter2")
+
+	long := make([]byte, maxBodyExcerpt*2)
+	for i := range long {
+		long[i] = 'a'
+	}
+	assert.Len(t, bodyExcerpt("text/plain", long), maxBodyExcerpt+len("..."))
+}
@@ -0,0 +1,310 @@
+package itchio
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A HARRecorder records all traffic going through a client, and writes
+// it out as a HAR 1.2 file (http://www.softwareishard.com/blog/har-12-spec/),
+// which can be opened with most browser devtools. Credentials, passwords,
+// TOTP codes and tokens are redacted, so recordings can be attached to bug reports.
+//
+// To record a client's traffic, add the recorder's middleware:
+//
+//	rec := itchio.NewHARRecorder()
+//	client.Use(rec.Middleware())
+//	// (make some API calls)
+//	err := rec.WriteFile("itchio.har")
+//
+// Response bodies are read in full before being handed to the rest of
+// the client, so recording is meant for debugging, not production use.
+type HARRecorder struct {
+	mu      sync.Mutex
+	entries []*harEntry
+}
+
+// NewHARRecorder returns a recorder with no entries
+func NewHARRecorder() *HARRecorder {
+	return &HARRecorder{}
+}
+
+// Middleware returns a middleware that records every request and response
+// going through it.
+func (hr *HARRecorder) Middleware() Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			entry := &harEntry{
+				StartedDateTime: time.Now().Format(time.RFC3339Nano),
+				Request:         harRequestFrom(req),
+				Cache:           struct{}{},
+			}
+
+			start := time.Now()
+			res, err := next(req)
+			if err != nil {
+				entry.Error = redactURLError(err).Error()
+				entry.Response = harResponse{
+					Cookies:     []harNameValue{},
+					Headers:     []harNameValue{},
+					HeadersSize: -1,
+					BodySize:    -1,
+				}
+			} else {
+				entry.Response, res.Body = harResponseFrom(res)
+			}
+
+			elapsed := harMilliseconds(time.Since(start))
+			entry.Time = elapsed
+			entry.Timings = harTimings{Send: 0, Wait: elapsed, Receive: 0}
+
+			hr.mu.Lock()
+			hr.entries = append(hr.entries, entry)
+			hr.mu.Unlock()
+
+			return res, err
+		}
+	}
+}
+
+// Len returns the number of entries recorded so far
+func (hr *HARRecorder) Len() int {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	return len(hr.entries)
+}
+
+// Reset discards all entries recorded so far
+func (hr *HARRecorder) Reset() {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	hr.entries = nil
+}
+
+// WriteTo writes all entries recorded so far as a HAR 1.2 document
+func (hr *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	hr.mu.Lock()
+	doc := harDocument{
+		Log: harLog{
+			Version: "1.2",
+			Creator: harCreator{Name: "go-itchio", Version: "1"},
+			Pages:   []struct{}{},
+			Entries: append([]*harEntry{}, hr.entries...),
+		},
+	}
+	hr.mu.Unlock()
+
+	payload, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	n, err := w.Write(payload)
+	return int64(n), errors.WithStack(err)
+}
+
+// WriteFile writes all entries recorded so far to a HAR file
+func (hr *HARRecorder) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = hr.WriteTo(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return errors.WithStack(f.Close())
+}
+
+type harDocument struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string      `json:"version"`
+	Creator harCreator  `json:"creator"`
+	Pages   []struct{}  `json:"pages"`
+	Entries []*harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	// custom fields must start with an underscore
+	Error string `json:"_error,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string         `json:"mimeType"`
+	Params   []harNameValue `json:"params"`
+	Text     string         `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func harMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func harRequestFrom(req *http.Request) harRequest {
+	hreq := harRequest{
+		Method:      req.Method,
+		URL:         RedactURL(req.URL),
+		HTTPVersion: req.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(req.Header),
+		QueryString: harValues(RedactValues(req.URL.Query())),
+		HeadersSize: -1,
+		BodySize:    req.ContentLength,
+	}
+	if hreq.HTTPVersion == "" {
+		hreq.HTTPVersion = "HTTP/1.1"
+	}
+
+	// only record bodies we can read without consuming the request's
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			payload, err := ioutil.ReadAll(body)
+			body.Close()
+			if err == nil && len(payload) > 0 {
+				contentType := req.Header.Get("Content-Type")
+				hreq.PostData = &harPostData{
+					MimeType: contentType,
+					Params:   []harNameValue{},
+					Text:     string(RedactBody(contentType, payload)),
+				}
+				hreq.BodySize = int64(len(payload))
+			}
+		}
+	}
+
+	return hreq
+}
+
+// harResponseFrom records res, and returns a body that can be
+// read again in its place.
+func harResponseFrom(res *http.Response) (harResponse, io.ReadCloser) {
+	hres := harResponse{
+		Status:      res.StatusCode,
+		StatusText:  http.StatusText(res.StatusCode),
+		HTTPVersion: res.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(res.Header),
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	if hres.HTTPVersion == "" {
+		hres.HTTPVersion = "HTTP/1.1"
+	}
+	if location, err := res.Location(); err == nil {
+		hres.RedirectURL = RedactURL(location)
+	}
+
+	body := res.Body
+	if body == nil {
+		return hres, body
+	}
+
+	payload, err := ioutil.ReadAll(body)
+	body.Close()
+
+	contentType := res.Header.Get("Content-Type")
+	hres.Content = harContent{
+		Size:     int64(len(payload)),
+		MimeType: contentType,
+		Text:     string(RedactBody(contentType, payload)),
+	}
+	hres.BodySize = int64(len(payload))
+
+	replay := ioutil.NopCloser(bytes.NewReader(payload))
+	if err != nil {
+		replay = ioutil.NopCloser(io.MultiReader(bytes.NewReader(payload), &errReader{err: err}))
+	}
+	return hres, replay
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	return harValues(RedactHeader(header))
+}
+
+func harValues(values map[string][]string) []harNameValue {
+	res := []harNameValue{}
+	for k, vv := range values {
+		for _, v := range vv {
+			res = append(res, harNameValue{Name: k, Value: v})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// errReader returns an error when read, so a failure to read a
+// response body is still seen by whoever reads the replayed body.
+type errReader struct {
+	err error
+}
+
+func (er *errReader) Read(p []byte) (int, error) {
+	return 0, er.err
+}
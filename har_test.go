@@ -0,0 +1,77 @@
+package itchio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHARRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login":
+			_, _ = w.Write([]byte(`{"key":{"id":1,"key":"fresh-api-key"},"cookie":{"itchio_token":"xyz"}}`))
+		default:
+			_, _ = w.Write([]byte(`{"user":{"id":1,"username":"amos"}}`))
+		}
+	}))
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+	rec := NewHARRecorder()
+	client.Use(rec.Middleware())
+
+	ctx := context.Background()
+	_, err := client.GetProfile(ctx)
+	assert.NoError(t, err)
+
+	login, err := client.LoginWithPassword(ctx, LoginWithPasswordParams{
+		Username: "amos",
+		Password: "hunter2",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "fresh-api-key", login.Key.Key, "recording must not alter responses")
+	assert.Equal(t, 2, rec.Len())
+
+	var buf bytes.Buffer
+	_, err = rec.WriteTo(&buf)
+	assert.NoError(t, err)
+
+	har := buf.String()
+	for _, secret := range []string{"APIKEY", "hunter2", "fresh-api-key", "xyz"} {
+		assert.NotContains(t, har, secret)
+	}
+
+	var doc harDocument
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, "1.2", doc.Log.Version)
+	assert.Len(t, doc.Log.Entries, 2)
+
+	profile := doc.Log.Entries[0]
+	assert.Equal(t, "GET", profile.Request.Method)
+	assert.Equal(t, 200, profile.Response.Status)
+	assert.Contains(t, profile.Response.Content.Text, "amos")
+
+	loginEntry := doc.Log.Entries[1]
+	assert.Equal(t, "POST", loginEntry.Request.Method)
+	assert.NotNil(t, loginEntry.Request.PostData)
+	assert.True(t, strings.Contains(loginEntry.Request.PostData.Text, "username=amos"))
+
+	path := filepath.Join(t.TempDir(), "itchio.har")
+	assert.NoError(t, rec.WriteFile(path))
+	written, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.Bytes(), written)
+
+	rec.Reset()
+	assert.Equal(t, 0, rec.Len())
+}
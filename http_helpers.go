@@ -1,37 +1,21 @@
 package itchio
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math/rand"
 	"net/http"
 	"net/url"
-	"os"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 )
 
-func getDebugLevel() int64 {
-	val, err := strconv.ParseInt(os.Getenv("GO_ITCHIO_DEBUG"), 10, 64)
-	if err != nil {
-		return 0
-	}
-	return val
-}
-
-var (
-	debugLevel   = getDebugLevel()
-	logRequests  = debugLevel >= 1
-	dumpAPICalls = debugLevel >= 2
-)
+// packageLogger is used by ParseAPIResponse, which isn't tied to a client
+var packageLogger Logger = DefaultLogger()
 
 // Get performs an HTTP GET request to the API
 func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
@@ -44,13 +28,26 @@ func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
 }
 
 // GetResponse performs an HTTP GET request and parses the API response.
+// If the client coalesces requests, it may share the response of an
+// identical request already in flight.
 func (c *Client) GetResponse(ctx context.Context, url string, dst interface{}) error {
+	if c.CoalesceRequests {
+		return c.coalescedGet(ctx, url, dst)
+	}
+	return c.getResponse(ctx, url, dst)
+}
+
+func (c *Client) getResponse(ctx context.Context, url string, dst interface{}) error {
+	if c.Cache != nil {
+		return c.cachedGet(ctx, url, dst)
+	}
+
 	resp, err := c.Get(ctx, url)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	err = ParseAPIResponse(dst, resp)
+	err = parseAPIResponse(dst, resp, c.logger(), c.schemaDriftCallbacks())
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -67,7 +64,7 @@ func (c *Client) PostForm(ctx context.Context, url string, data url.Values) (*ht
 	}
 	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	// Set GetBody so the request can be retried on 401 (OAuth token refresh)
+	// Set GetBody so the request can be retried (rate limiting, OAuth token refresh)
 	req.GetBody = func() (io.ReadCloser, error) {
 		return io.NopCloser(strings.NewReader(encoded)), nil
 	}
@@ -75,142 +72,194 @@ func (c *Client) PostForm(ctx context.Context, url string, data url.Values) (*ht
 }
 
 // PostFormResponse performs an HTTP POST request to the API *and* parses the API response.
-func (c *Client) PostFormResponse(ctx context.Context, url string, data url.Values, dst interface{}) error {
-	resp, err := c.PostForm(ctx, url, data)
+// It then deletes the cached responses the request may have made stale, see
+// CacheInvalidator, and calls OnWrite callbacks.
+func (c *Client) PostFormResponse(ctx context.Context, urlStr string, data url.Values, dst interface{}) error {
+	identity := c.authIdentity(ctx)
+	resp, err := c.PostForm(ctx, urlStr, data)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	err = ParseAPIResponse(dst, resp)
+	err = parseAPIResponse(dst, resp, c.logger(), c.schemaDriftCallbacks())
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
+	c.afterWrite(ctx, identity, urlStr)
 	return nil
 }
 
 // Do performs a request (any method). It takes care of JWT or API key
-// authentication, sets the proper user agent, has built-in retry,
+// authentication, sets the proper user agent, and retries according
+// to the client's RetryPolicy. Waiting (for the rate limiter, or before
+// a retry) stops as soon as the request's context is done.
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
-	return c.doWithRetry(req, true)
+	meta := responseMetaFromContext(req.Context())
+	if meta == nil {
+		return c.doWithRetry(req, true)
+	}
+
+	*meta = ResponseMeta{}
+	start := time.Now()
+	res, err := c.doWithRetry(req, true)
+	meta.Latency = time.Since(start)
+	meta.recordResponse(res)
+	return res, err
 }
 
-// doWithRetry performs the request with optional 401 retry for OAuth clients
+// doWithRetry performs the request, and retries it once if the
+// client's Authenticator renews credentials after a 401
 func (c *Client) doWithRetry(req *http.Request, allow401Retry bool) (*http.Response, error) {
 	ctx := req.Context()
 
-	// Skip OAuth machinery for token refresh requests (prevents deadlock)
-	skipOAuth := shouldSkipOAuthRefresh(ctx)
-
-	// Proactive token refresh for OAuth clients (unless we're doing the refresh itself)
-	if c.isOAuthClient() && !skipOAuth {
-		if err := c.refreshTokenIfNeeded(ctx); err != nil {
-			return nil, errors.Wrap(err, "failed to refresh token")
-		}
-	}
-
-	// Use appropriate auth header:
-	// - For refresh requests: use API key (or empty) since refresh token is in body
-	// - For normal OAuth requests: use Bearer token
-	if skipOAuth {
-		req.Header.Set("Authorization", c.Key)
-	} else {
-		req.Header.Set("Authorization", c.getAuthHeader())
+	auth := c.authenticator(ctx)
+	if err := auth.Authenticate(ctx, c, req); err != nil {
+		return nil, err
 	}
 	req.Header.Set("User-Agent", c.UserAgent)
 	req.Header.Set("Accept-Language", c.AcceptedLanguage)
 	req.Header.Set("Accept", "application/vnd.itch.v2")
+	callOpts := callOptionsFromContext(ctx)
+	callOpts.applyHeaders(req)
 
 	var res *http.Response
 	var err error
 
-	if logRequests {
-		fmt.Fprintf(os.Stderr, "%s %s [request]\n", req.Method, req.URL)
+	logger := c.logger()
+	redactedURL := RedactURL(req.URL)
+	logger.Log(ctx, LogLevelInfo, "request", "method", req.Method, "url", redactedURL)
+	if logger.Enabled(ctx, LogLevelDebug) {
+		logger.Log(ctx, LogLevelDebug, "request headers", headerKeyvals(RedactHeader(req.Header))...)
 	}
 
-	if dumpAPICalls {
-		for k, vv := range req.Header {
-			for _, v := range vv {
-				fmt.Fprintf(os.Stderr, "[request] %s: %s\n", k, v)
-			}
-		}
+	retryPolicy := c.RetryPolicy
+	if callOpts != nil && callOpts.retryPolicy != nil {
+		retryPolicy = callOpts.retryPolicy
 	}
+	if retryPolicy == nil {
+		retryPolicy = NoRetry
+	}
+
+	roundTrip := c.roundTripper()
 
-	retryPatterns := append(c.RetryPatterns, time.Millisecond)
+	meta := responseMetaFromContext(ctx)
 
-	for _, sleepTime := range retryPatterns {
-		r := c.Limiter.Reserve()
-		if !r.OK() {
-			return nil, errors.Errorf("invalid rate limiter settings")
+	for attempt := 1; ; attempt++ {
+		limiterStart := time.Now()
+		if c.Limiter != nil {
+			if err := c.Limiter.Wait(ctx); err != nil {
+				return nil, errors.Wrap(err, "waiting for rate limiter")
+			}
+		}
+		if meta != nil {
+			meta.RateLimitWait += time.Since(limiterStart)
+			meta.Attempts++
 		}
-		limitDelay := r.Delay()
-		time.Sleep(limitDelay)
 
-		if c.onOutgoingRequest != nil {
-			c.onOutgoingRequest(req)
+		start := time.Now()
+		res, err = roundTrip(req)
+		if observer, ok := c.Limiter.(ObservingLimiter); ok {
+			observer.Observe(res, err)
 		}
-		res, err = c.HTTPClient.Do(req)
 		if err != nil {
-			if strings.Contains(err.Error(), "TLS handshake timeout") {
-				time.Sleep(sleepTime + time.Duration(rand.Int()%1000)*time.Millisecond)
-				continue
-			}
-			return nil, err
+			err = redactURLError(err)
+			logger.Log(ctx, LogLevelInfo, "request failed", "method", req.Method, "url", redactedURL, "attempt", attempt, "error", err)
+		} else {
+			logger.Log(ctx, LogLevelInfo, "response", "method", req.Method, "url", redactedURL, "status", res.StatusCode, "attempt", attempt, "duration", time.Since(start))
+		}
+
+		wait, retry := retryPolicy.Retry(attempt, req, res, err)
+		if !retry {
+			break
 		}
 
-		if res.StatusCode == 503 {
+		if res != nil {
 			res.Body.Close()
 
-			// Rate limited, try again according to patterns.
-			// following https://cloud.google.com/storage/docs/json_api/v1/how-tos/upload#exp-backoff to the letter
-			actualSleepTime := sleepTime + time.Duration(rand.Int()%1000)*time.Millisecond
-			if c.onRateLimited != nil {
-				c.onRateLimited(req, res)
+			if isRateLimitedStatus(res.StatusCode) {
+				logger.Log(ctx, LogLevelInfo, "rate limited", "method", req.Method, "url", redactedURL, "status", res.StatusCode, "wait", wait)
 			}
-			if logRequests {
-				fmt.Fprintf(os.Stderr, "%s %s [rate limited, sleeping %v]\n", req.Method, req.URL, actualSleepTime)
-			}
-			time.Sleep(actualSleepTime)
-			continue
 		}
+		logger.Log(ctx, LogLevelInfo, "retrying", "method", req.Method, "url", redactedURL, "attempt", attempt+1, "wait", wait)
 
-		break
+		if err := rewindBody(req); err != nil {
+			return nil, err
+		}
+
+		retryStart := time.Now()
+		err := sleepContext(ctx, wait)
+		if meta != nil {
+			meta.RetryWait += time.Since(retryStart)
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Handle 401 for OAuth clients - attempt one token refresh and retry
-	if res != nil && res.StatusCode == 401 && c.isOAuthClient() && allow401Retry && !skipOAuth {
-		res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
 
-		if logRequests {
-			fmt.Fprintf(os.Stderr, "%s %s [401, attempting token refresh]\n", req.Method, req.URL)
+	// Give the authenticator a chance to renew credentials, and retry once
+	if res != nil && res.StatusCode == 401 && allow401Retry {
+		retry, err := auth.Unauthorized(ctx, c, res)
+		if err != nil {
+			res.Body.Close()
+			return nil, err
 		}
+		if retry {
+			res.Body.Close()
 
-		if err := c.forceTokenRefresh(ctx); err != nil {
-			return nil, errors.Wrap(err, "failed to refresh token after 401")
+			if err := rewindBody(req); err != nil {
+				return nil, err
+			}
+
+			// Retry once with new credentials (don't allow another 401 retry)
+			return c.doWithRetry(req, false)
 		}
+	}
 
-		// Recreate request body if needed for retry
-		if req.GetBody != nil {
-			newBody, err := req.GetBody()
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to get request body for retry")
-			}
-			req.Body = newBody
-		} else if req.ContentLength > 0 {
-			// Original request had a body but GetBody not set - can't retry safely
-			return nil, errors.New("cannot retry request: body was consumed and GetBody not available")
+	return res, err
+}
+
+// redactURLError masks secrets from the URL net/http includes in its errors
+func redactURLError(err error) error {
+	if ue, ok := err.(*url.Error); ok {
+		if u, parseErr := url.Parse(ue.URL); parseErr == nil {
+			return &url.Error{Op: ue.Op, URL: RedactURL(u), Err: ue.Err}
 		}
-		// ContentLength == 0 or -1 with no GetBody means no body or unknown,
-		// which is fine for GET/DELETE requests
+	}
+	return err
+}
 
-		// Update auth header with new token
-		req.Header.Set("Authorization", c.getAuthHeader())
+// headerKeyvals turns headers into a list of key/value pairs for logging
+func headerKeyvals(header http.Header) []interface{} {
+	var keyvals []interface{}
+	for k, vv := range header {
+		for _, v := range vv {
+			keyvals = append(keyvals, k, v)
+		}
+	}
+	return keyvals
+}
 
-		// Retry once with new token (don't allow another 401 retry)
-		return c.doWithRetry(req, false)
+// rewindBody prepares req to be sent again, by rebuilding its body
+// from GetBody. Requests without a body need no preparation.
+func rewindBody(req *http.Request) error {
+	if req.GetBody == nil {
+		if req.Body == nil || req.Body == http.NoBody {
+			return nil
+		}
+		return errors.WithStack(&BodyNotReplayableError{Method: req.Method, Path: req.URL.Path})
 	}
 
-	return res, err
+	body, err := req.GetBody()
+	if err != nil {
+		return errors.Wrap(err, "failed to get request body for retry")
+	}
+	req.Body = body
+	return nil
 }
 
 // MakePath crafts an API url from our configured base URL
@@ -229,17 +278,13 @@ func (c *Client) MakeValuesPath(values url.Values, format string, a ...interface
 	return fmt.Sprintf("%s?%s", path, values.Encode())
 }
 
-func asHTTPCodeError(res *http.Response) error {
-	if res.StatusCode/100 != 2 {
-		err := fmt.Errorf("Server error: HTTP %s for %s", res.Status, res.Request.URL.Path)
-		return err
-	}
-	return nil
-}
-
 // ParseAPIResponse unmarshals an HTTP response into one of out response
 // data structures
 func ParseAPIResponse(dst interface{}, res *http.Response) error {
+	return parseAPIResponse(dst, res, packageLogger, nil)
+}
+
+func parseAPIResponse(dst interface{}, res *http.Response, logger Logger, onDrift []OnSchemaDrift) error {
 	if res == nil || res.Body == nil {
 		return fmt.Errorf("No response from server")
 	}
@@ -252,74 +297,81 @@ func ParseAPIResponse(dst interface{}, res *http.Response) error {
 		return errors.WithStack(err)
 	}
 
-	if dumpAPICalls {
-		fmt.Fprintf(os.Stderr, "[response] %s\n", string(body))
+	ctx := context.Background()
+	if res.Request != nil {
+		ctx = res.Request.Context()
+	}
+	if logger.Enabled(ctx, LogLevelDebug) {
+		logger.Log(ctx, LogLevelDebug, "response body", "body", string(RedactBody(res.Header.Get("Content-Type"), body)))
 	}
 
-	intermediate := make(map[string]interface{})
+	if res.StatusCode/100 != 2 {
+		return newAPIError(res, body, apiErrorMessages(body))
+	}
 
-	err = json.NewDecoder(bytes.NewReader(body)).Decode(&intermediate)
+	d := decoder{data: body}
+	if len(onDrift) > 0 {
+		d.drift = &driftCollector{}
+	}
+	err = d.decode(dst)
 	if err != nil {
-		if he := asHTTPCodeError(res); he != nil {
-			return he
+		// some errors come with a 200 status, and don't fit dst
+		if messages := apiErrorMessages(body); len(messages) > 0 {
+			return newAPIError(res, body, messages)
 		}
+		return newDecodeError(res, body, err)
+	}
 
-		msg := fmt.Sprintf("JSON decode error: %s\n\nBody: %s\n\n", err.Error(), string(body))
-		return errors.New(msg)
+	if messages := errorMessages(d.errorsValue); len(messages) > 0 {
+		return newAPIError(res, body, messages)
 	}
 
-	if errorsField, ok := intermediate["errors"]; ok {
-		if errorsList, ok := errorsField.([]interface{}); ok {
-			var messages []string
-			for _, el := range errorsList {
-				if errorMessage, ok := el.(string); ok {
-					messages = append(messages, errorMessage)
-				}
-			}
-			if len(messages) > 0 {
-				return &APIError{Messages: messages, StatusCode: res.StatusCode, Path: res.Request.URL.Path}
-			}
+	if d.drift != nil && len(d.drift.findings) > 0 {
+		report := d.drift.report(dst)
+		if res.Request != nil {
+			report.Method = res.Request.Method
+			report.Path = res.Request.URL.Path
+		}
+		for _, cb := range onDrift {
+			cb(report)
 		}
 	}
 
-	if he := asHTTPCodeError(res); he != nil {
-		return he
+	if res.StatusCode != 200 {
+		return newAPIError(res, body, nil)
 	}
 
-	intermediate = camelifyMap(intermediate)
+	return nil
+}
 
-	if dumpAPICalls {
-		enc := json.NewEncoder(os.Stderr)
-		enc.SetIndent("[intermediate] ", "  ")
-		_ = enc.Encode(intermediate)
+// apiErrorMessages returns the messages of the top-level "errors"
+// field of a response body, if any
+func apiErrorMessages(body []byte) []string {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil
 	}
+	return errorMessages(doc["errors"])
+}
 
-	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
-		TagName: "json",
-		Result:  dst,
-		// see https://github.com/itchio/itch/issues/1549
-		WeaklyTypedInput: true,
-		DecodeHook: mapstructure.ComposeDecodeHookFunc(
-			mapstructure.StringToTimeHookFunc(time.RFC3339Nano),
-			GameHookFunc,
-			UploadHookFunc,
-		),
-	})
-	if err != nil {
-		return errors.WithStack(err)
+// errorMessages returns the strings in a JSON array of errors
+func errorMessages(raw []byte) []string {
+	if len(raw) == 0 {
+		return nil
 	}
 
-	err = decoder.Decode(intermediate)
-	if err != nil {
-		msg := fmt.Sprintf("mapstructure decode error: %s\n\nBody: %#v\n\n", err.Error(), intermediate)
-		return errors.New(msg)
+	var errorsList []interface{}
+	if err := json.Unmarshal(raw, &errorsList); err != nil {
+		return nil
 	}
 
-	if res.StatusCode != 200 {
-		return errors.Errorf("HTTP %v", res.StatusCode)
+	var messages []string
+	for _, el := range errorsList {
+		if errorMessage, ok := el.(string); ok {
+			messages = append(messages, errorMessage)
+		}
 	}
-
-	return nil
+	return messages
 }
 
 // FindBuildFile looks for an uploaded file of the right type
@@ -1,6 +1,7 @@
 package itchfs
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"path"
@@ -96,12 +97,12 @@ func (s *source) makeDownloadBuildURL(tokens []string) (htfs.GetURLFunc, error)
 	fileType := tokens[6]
 
 	getter := func() (string, error) {
-		return s.ItchClient.MakeBuildDownloadURL(itchio.MakeBuildDownloadURLParams{
+		return s.ItchClient.MakeBuildDownloadURLContext(context.Background(), itchio.MakeBuildDownloadURLParams{
 			BuildID:     buildID,
 			UUID:        s.QueryValues.Get("uuid"),
 			Type:        itchio.BuildFileType(fileType),
 			Credentials: parseGameCredentials(s.QueryValues),
-		}), nil
+		})
 	}
 	return getter, nil
 }
@@ -129,12 +130,12 @@ func (s *source) makeKeyDownloadBuildURL(tokens []string) (htfs.GetURLFunc, erro
 		creds := parseGameCredentials(s.QueryValues)
 		creds.DownloadKeyID, _ = strconv.ParseInt(downloadKey, 10, 64)
 
-		return s.ItchClient.MakeBuildDownloadURL(itchio.MakeBuildDownloadURLParams{
+		return s.ItchClient.MakeBuildDownloadURLContext(context.Background(), itchio.MakeBuildDownloadURLParams{
 			BuildID:     buildID,
 			Type:        itchio.BuildFileType(fileType),
 			UUID:        s.QueryValues.Get("uuid"),
 			Credentials: creds,
-		}), nil
+		})
 	}
 
 	return getter, nil
@@ -152,10 +153,10 @@ func (s *source) makeWharfDownloadBuildURL(tokens []string) (htfs.GetURLFunc, er
 	}
 
 	getter := func() (string, error) {
-		return s.ItchClient.MakeBuildFileDownloadURL(itchio.MakeBuildFileDownloadURLParams{
+		return s.ItchClient.MakeBuildFileDownloadURLContext(context.Background(), itchio.MakeBuildFileDownloadURLParams{
 			BuildID: buildID,
 			FileID:  buildFileID,
-		}), nil
+		})
 	}
 	return getter, nil
 }
@@ -164,11 +165,11 @@ func (s *source) makeDownloadUploadURL(tokens []string) (htfs.GetURLFunc, error)
 	uploadID, _ := strconv.ParseInt(tokens[2], 10, 64)
 
 	getter := func() (string, error) {
-		return s.ItchClient.MakeUploadDownloadURL(itchio.MakeUploadDownloadURLParams{
+		return s.ItchClient.MakeUploadDownloadURLContext(context.Background(), itchio.MakeUploadDownloadURLParams{
 			UploadID:    uploadID,
 			Credentials: parseGameCredentials(s.QueryValues),
 			UUID:        s.QueryValues.Get("uuid"),
-		}), nil
+		})
 	}
 	return getter, nil
 }
@@ -181,11 +182,11 @@ func (s *source) makeKeyDownloadUploadURL(tokens []string) (htfs.GetURLFunc, err
 	creds.DownloadKeyID, _ = strconv.ParseInt(downloadKey, 10, 64)
 
 	getter := func() (string, error) {
-		return s.ItchClient.MakeUploadDownloadURL(itchio.MakeUploadDownloadURLParams{
+		return s.ItchClient.MakeUploadDownloadURLContext(context.Background(), itchio.MakeUploadDownloadURLParams{
 			UploadID:    uploadID,
 			Credentials: creds,
 			UUID:        s.QueryValues.Get("uuid"),
-		}), nil
+		})
 	}
 	return getter, nil
 }
@@ -2,69 +2,78 @@ package itchio
 
 import (
 	"net/http"
-	"time"
-
-	"github.com/itchio/httpkit/timeout"
-	"golang.org/x/time/rate"
+	"sync"
 )
 
 // OnRateLimited is the callback type for rate limiting events
 type OnRateLimited func(req *http.Request, res *http.Response)
 
-// OnRateLimited is the callback type for rate limiting events
+// OnOutgoingRequest is the callback type for outgoing requests
 type OnOutgoingRequest func(req *http.Request)
 
-// A Client allows consuming the itch.io API
+// A Client allows consuming the itch.io API. Create one with NewClient,
+// and derive differently-configured ones with With.
 type Client struct {
-	Key              string
+	// Key is the API key requests are made with, unless Auth is set
+	Key string
+	// Auth decides which credentials requests are made with. If nil,
+	// requests are authenticated with Key, or anonymous if it's empty.
+	Auth Authenticator
+
 	HTTPClient       *http.Client
 	BaseURL          string
-	RetryPatterns    []time.Duration
+	RetryPolicy      RetryPolicy
 	UserAgent        string
 	AcceptedLanguage string
-	Limiter          *rate.Limiter
+	Logger           Logger
 
-	onRateLimited     OnRateLimited
-	onOutgoingRequest OnOutgoingRequest
+	// Limiter paces requests. If it's an ObservingLimiter, it's told about
+	// every response. Defaults to DefaultLimiter(), nil disables rate limiting.
+	Limiter Limiter
 
-	// OAuth state (nil for API key auth)
-	oauth *oauthState
-}
+	// CoalesceRequests makes concurrent identical GET requests (same URL,
+	// same credentials) share a single HTTP call. Callers get copies of the
+	// same decoded response, whose nested values (games, uploads, etc.) are
+	// shared, so they shouldn't be modified. POST requests are never coalesced.
+	CoalesceRequests bool
 
-func defaultRetryPatterns() []time.Duration {
-	return []time.Duration{
-		1 * time.Second,
-		2 * time.Second,
-		4 * time.Second,
-		8 * time.Second,
-		16 * time.Second,
-	}
+	// Cache stores GET responses, to serve them while they're fresh, revalidate
+	// them when they're not, and fall back to them when the API is unreachable.
+	// Responses are cached per set of credentials. Nil disables caching.
+	Cache Cache
+
+	// CacheInvalidator decides which cached responses successful writes
+	// make stale. Nil means DefaultCacheInvalidator, which custom ones
+	// can call for the writes they don't handle.
+	CacheInvalidator OnWrite
+
+	// mu guards middleware, onSchemaDrift, onWrite and refresher
+	mu            sync.RWMutex
+	middleware    []Middleware
+	onSchemaDrift []OnSchemaDrift
+	onWrite       []OnWrite
+	refresher     *tokenRefresher
+
+	flights flightGroup
 }
 
 // ClientWithKey creates a new itch.io API client with a given API key
 func ClientWithKey(key string) *Client {
-	c := &Client{
-		Key:              key,
-		HTTPClient:       timeout.NewDefaultClient(),
-		RetryPatterns:    defaultRetryPatterns(),
-		UserAgent:        "go-itchio",
-		AcceptedLanguage: "*",
-		Limiter:          DefaultRateLimiter(),
-	}
-	c.SetServer("https://api.itch.io")
-	return c
+	return NewClient(WithKey(key))
 }
 
 // OnRateLimited allows registering a function that gets called
-// every time the server responds with 503
+// every time the server responds with 429 or 503. Each call registers
+// an additional callback, see Use.
 func (c *Client) OnRateLimited(cb OnRateLimited) {
-	c.onRateLimited = cb
+	c.Use(onRateLimitedMiddleware(cb))
 }
 
 // OnOutgoingRequest allows registering a function that gets called
-// every time the client makes an HTTP request
+// every time the client makes an HTTP request. Each call registers
+// an additional callback, see Use.
 func (c *Client) OnOutgoingRequest(cb OnOutgoingRequest) {
-	c.onOutgoingRequest = cb
+	c.Use(onOutgoingRequestMiddleware(cb))
 }
 
 // SetServer allows changing the server to which we're making API
@@ -0,0 +1,362 @@
+package itchiotest
+
+import (
+	"time"
+
+	itchio "github.com/itchio/go-itchio"
+)
+
+// Fixtures is a set of objects to seed a server with, see Seed.
+// Objects with a zero ID are assigned one.
+type Fixtures struct {
+	Users []itchio.User
+	// APIKeys maps API keys to the ID of the user they belong to
+	APIKeys  map[string]int64
+	Accounts []Account
+
+	Games        []itchio.Game
+	Uploads      []UploadFixture
+	Builds       []BuildFixture
+	DownloadKeys []itchio.DownloadKey
+	Collections  []CollectionFixture
+	// Targets maps wharf targets (like "user/game") to game IDs
+	Targets map[string]int64
+
+	OAuthCodes []OAuthCode
+}
+
+// An UploadFixture is an upload of a game, with its content
+type UploadFixture struct {
+	GameID  int64
+	Upload  itchio.Upload
+	Content []byte
+}
+
+// A BuildFixture is a completed build of an upload, with the content
+// of its archive
+type BuildFixture struct {
+	UploadID int64
+	Build    itchio.Build
+	Archive  []byte
+}
+
+// A CollectionFixture is a collection, and the IDs of the games in it
+type CollectionFixture struct {
+	Collection itchio.Collection
+	GameIDs    []int64
+}
+
+// An Account lets a user log in with LoginWithPassword
+type Account struct {
+	UserID   int64
+	Username string
+	Password string
+	// TOTPCode, if set, is the two-factor code TOTPVerify expects
+	TOTPCode string
+	// RecaptchaResponse, if set, must be sent along with the password,
+	// otherwise the server asks for a recaptcha.
+	RecaptchaResponse string
+}
+
+// An OAuthCode is an authorization code that can be
+// exchanged with ExchangeOAuthCode, once.
+type OAuthCode struct {
+	Code        string
+	UserID      int64
+	ClientID    string
+	RedirectURI string
+	// CodeChallenge is the PKCE challenge (S256) the code
+	// verifier is checked against, if set.
+	CodeChallenge string
+}
+
+// Seed adds all the objects in f to the server, in dependency order
+func (s *Server) Seed(f Fixtures) {
+	for _, u := range f.Users {
+		s.AddUser(u)
+	}
+	for key, userID := range f.APIKeys {
+		s.AddAPIKey(userID, key)
+	}
+	for _, a := range f.Accounts {
+		s.AddAccount(a)
+	}
+	for _, g := range f.Games {
+		s.AddGame(g)
+	}
+	for _, u := range f.Uploads {
+		s.AddUpload(u.GameID, u.Upload, u.Content)
+	}
+	for _, b := range f.Builds {
+		s.AddBuild(b.UploadID, b.Build, b.Archive)
+	}
+	for _, dk := range f.DownloadKeys {
+		s.AddDownloadKey(dk)
+	}
+	for _, c := range f.Collections {
+		s.AddCollection(c.Collection, c.GameIDs...)
+	}
+	for target, gameID := range f.Targets {
+		s.AddTarget(target, gameID)
+	}
+	for _, code := range f.OAuthCodes {
+		s.AddOAuthCode(code)
+	}
+}
+
+func (s *Server) newID() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+// AddUser adds a user, and returns it with its ID set
+func (s *Server) AddUser(u itchio.User) *itchio.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u.ID == 0 {
+		u.ID = s.newID()
+	}
+	s.users[u.ID] = &u
+	res := u
+	return &res
+}
+
+// AddAPIKey lets key be used to make requests on behalf of a user
+func (s *Server) AddAPIKey(userID int64, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiKeys[key] = userID
+}
+
+// AddAccount lets a user log in with a username and password
+func (s *Server) AddAccount(a Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts[a.Username] = &a
+}
+
+// AddGame adds a game, and returns it with its ID set. Games are listed
+// in ListProfileGames for the user they belong to, and games without an
+// owner belong to the default user.
+func (s *Server) AddGame(g itchio.Game) *itchio.Game {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if g.ID == 0 {
+		g.ID = s.newID()
+	}
+	if g.UserID == 0 {
+		g.UserID = s.defaultUser.ID
+	}
+	s.games[g.ID] = &g
+	res := g
+	return &res
+}
+
+// AddUpload adds an upload to a game, and returns it with its ID set.
+// content is served by the upload's download URL.
+func (s *Server) AddUpload(gameID int64, u itchio.Upload, content []byte) *itchio.Upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u.ID == 0 {
+		u.ID = s.newID()
+	}
+	if u.Size == 0 {
+		u.Size = int64(len(content))
+	}
+	s.uploads[u.ID] = &upload{gameID: gameID, upload: &u, content: content}
+	s.gameUploads[gameID] = append(s.gameUploads[gameID], u.ID)
+	res := u
+	return &res
+}
+
+// AddBuild adds a completed build to an upload, which becomes the
+// upload's current build. archive is served as the build's archive file.
+func (s *Server) AddBuild(uploadID int64, b itchio.Build, archive []byte) *itchio.Build {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b.ID == 0 {
+		b.ID = s.newID()
+	}
+	if b.State == "" {
+		b.State = itchio.BuildStateCompleted
+	}
+	up := s.uploads[uploadID]
+	if up != nil {
+		if b.Version == 0 {
+			b.Version = int64(len(up.buildIDs) + 1)
+		}
+		if b.ParentBuildID == 0 && len(up.buildIDs) > 0 {
+			b.ParentBuildID = up.buildIDs[len(up.buildIDs)-1]
+		}
+	}
+	if archive != nil {
+		fileID := s.newID()
+		b.Files = append(b.Files, &itchio.BuildFile{
+			ID:      fileID,
+			Size:    int64(len(archive)),
+			State:   itchio.BuildFileStateUploaded,
+			Type:    itchio.BuildFileTypeArchive,
+			SubType: itchio.BuildFileSubTypeDefault,
+		})
+		s.storage[fileID] = &storedFile{buildID: b.ID, content: archive}
+	}
+
+	s.builds[b.ID] = &build{uploadID: uploadID, build: &b}
+	if up != nil {
+		up.buildIDs = append(up.buildIDs, b.ID)
+		if b.State == itchio.BuildStateCompleted {
+			up.upload.Storage = itchio.UploadStorageBuild
+			up.upload.Build = &b
+			up.upload.BuildID = b.ID
+		}
+	}
+	res := b
+	return &res
+}
+
+// SetUploadScannedArchive sets what GetUploadScannedArchive returns for an upload
+func (s *Server) SetUploadScannedArchive(uploadID int64, sa itchio.ScannedArchive) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if up := s.uploads[uploadID]; up != nil {
+		sa.ObjectID = uploadID
+		sa.ObjectType = itchio.ScannedArchiveObjectTypeUpload
+		up.archive = &sa
+	}
+}
+
+// SetBuildScannedArchive sets what GetBuildScannedArchive returns for a build
+func (s *Server) SetBuildScannedArchive(buildID int64, sa itchio.ScannedArchive) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b := s.builds[buildID]; b != nil {
+		sa.ObjectID = buildID
+		sa.ObjectType = itchio.ScannedArchiveObjectTypeBuild
+		b.archive = &sa
+	}
+}
+
+// AddDownloadKey adds a download key, and returns it with its ID set.
+// Keys without an owner belong to the default user.
+func (s *Server) AddDownloadKey(dk itchio.DownloadKey) *itchio.DownloadKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if dk.ID == 0 {
+		dk.ID = s.newID()
+	}
+	if dk.OwnerID == 0 {
+		dk.OwnerID = s.defaultUser.ID
+	}
+	if dk.CreatedAt == nil {
+		now := time.Now().UTC()
+		dk.CreatedAt = &now
+	}
+	s.downloadKeys = append(s.downloadKeys, &dk)
+	res := dk
+	return &res
+}
+
+// AddCollection adds a collection with the given games, and returns it
+// with its ID set. Collections without an owner belong to the default user.
+func (s *Server) AddCollection(c itchio.Collection, gameIDs ...int64) *itchio.Collection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c.ID == 0 {
+		c.ID = s.newID()
+	}
+	if c.UserID == 0 {
+		c.UserID = s.defaultUser.ID
+	}
+	c.GamesCount = int64(len(gameIDs))
+
+	col := &collection{collection: &c}
+	for i, gameID := range gameIDs {
+		col.games = append(col.games, &itchio.CollectionGame{
+			CollectionID: c.ID,
+			GameID:       gameID,
+			Position:     int64(i + 1),
+			UserID:       c.UserID,
+		})
+	}
+	s.collections[c.ID] = col
+	res := c
+	return &res
+}
+
+// AddTarget lets builds be pushed to a game with CreateBuild,
+// using target (like "user/game").
+func (s *Server) AddTarget(target string, gameID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.targets[target] = gameID
+}
+
+// AddOAuthCode adds an authorization code for ExchangeOAuthCode
+func (s *Server) AddOAuthCode(code OAuthCode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.oauthCodes[code.Code] = &code
+}
+
+// IssueOAuthCredentials returns fresh OAuth credentials for a user,
+// as if they had gone through the authorization flow.
+func (s *Server) IssueOAuthCredentials(userID int64) *itchio.OAuthCredentials {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	access, refresh, expiresAt := s.issueTokens(userID)
+	return &itchio.OAuthCredentials{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresAt:    expiresAt,
+	}
+}
+
+// ExpireAccessTokens makes all OAuth access tokens issued so far invalid,
+// so clients have to refresh them.
+func (s *Server) ExpireAccessTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.accessTokens {
+		token.expiresAt = time.Time{}
+	}
+}
+
+// RevokeRefreshTokens makes all OAuth refresh tokens issued so far
+// invalid: refreshing fails with "invalid_grant".
+func (s *Server) RevokeRefreshTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshTokens = make(map[string]int64)
+}
+
+func (s *Server) issueTokens(userID int64) (string, string, time.Time) {
+	access := randomToken()
+	refresh := randomToken()
+	expiresAt := time.Now().Add(s.AccessTokenTTL)
+	s.accessTokens[access] = &accessToken{userID: userID, expiresAt: expiresAt}
+	s.refreshTokens[refresh] = userID
+	return access, refresh, expiresAt
+}
+
+func (s *Server) issueAPIKey(userID int64) *itchio.APIKey {
+	now := time.Now().UTC()
+	key := &itchio.APIKey{
+		ID:        s.newID(),
+		UserID:    userID,
+		Key:       randomToken(),
+		CreatedAt: &now,
+		UpdatedAt: &now,
+	}
+	s.apiKeys[key.Key] = userID
+	return key
+}
@@ -0,0 +1,1024 @@
+package itchiotest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	itchio "github.com/itchio/go-itchio"
+)
+
+// maxTOTPAttempts is how many wrong codes can be sent
+// for a login token before it's invalidated
+const maxTOTPAttempts = 5
+
+var routes = []*route{
+	newRoute("GET", "/profile", true, (*Server).getProfile),
+	newRoute("GET", "/profile/games", true, (*Server).listProfileGames),
+	newRoute("GET", "/profile/owned-keys", true, (*Server).listProfileOwnedKeys),
+	newRoute("GET", "/profile/collections", true, (*Server).listProfileCollections),
+	newRoute("POST", "/profile/game-sessions", true, (*Server).createGameSession),
+	newRoute("POST", "/profile/game-sessions/:id", true, (*Server).updateGameSession),
+	newRoute("GET", "/profile/game-sessions/summaries/:id", true, (*Server).getGameSessionsSummary),
+
+	newRoute("GET", "/users/:id", true, (*Server).getUser),
+	newRoute("GET", "/collections/:id", true, (*Server).getCollection),
+	newRoute("GET", "/collections/:id/collection-games", true, (*Server).getCollectionGames),
+	newRoute("GET", "/search/games", true, (*Server).searchGames),
+	newRoute("GET", "/search/users", true, (*Server).searchUsers),
+
+	newRoute("GET", "/games/:id", true, (*Server).getGame),
+	newRoute("GET", "/games/:id/uploads", true, (*Server).listGameUploads),
+	newRoute("POST", "/games/:id/download-sessions", true, (*Server).newDownloadSession),
+	newRoute("GET", "/uploads/:id", true, (*Server).getUpload),
+	newRoute("GET", "/uploads/:id/builds", true, (*Server).listUploadBuilds),
+	newRoute("GET", "/uploads/:id/scanned-archive", true, (*Server).getUploadScannedArchive),
+	newRoute("GET", "/uploads/:id/download", true, (*Server).downloadUpload),
+	newRoute("GET", "/builds/:id", true, (*Server).getBuild),
+	newRoute("GET", "/builds/:id/upgrade-paths/:target", true, (*Server).getBuildUpgradePath),
+	newRoute("GET", "/builds/:id/scanned-archive", true, (*Server).getBuildScannedArchive),
+	newRoute("GET", "/builds/:id/download/:type/:subtype", true, (*Server).downloadBuild),
+
+	newRoute("GET", "/wharf/status", true, (*Server).wharfStatus),
+	newRoute("GET", "/wharf/channels", true, (*Server).listChannels),
+	newRoute("GET", "/wharf/channels/:name", true, (*Server).getChannel),
+	newRoute("POST", "/wharf/builds", true, (*Server).createBuild),
+	newRoute("GET", "/wharf/builds/:id/files", true, (*Server).listBuildFiles),
+	newRoute("POST", "/wharf/builds/:id/files", true, (*Server).createBuildFile),
+	newRoute("POST", "/wharf/builds/:id/files/:file", true, (*Server).finalizeBuildFile),
+	newRoute("GET", "/wharf/builds/:id/files/:file/download", true, (*Server).downloadBuildFile),
+	newRoute("GET", "/wharf/builds/:id/events", true, (*Server).listBuildEvents),
+	newRoute("POST", "/wharf/builds/:id/events", true, (*Server).createBuildEvent),
+	newRoute("POST", "/wharf/builds/:id/failures", true, (*Server).createBuildFailure),
+	newRoute("POST", "/wharf/builds/:id/failures/rediff", true, (*Server).createRediffBuildFailure),
+	// upload URLs are pre-signed, like the real storage's
+	newRoute("PUT", "/storage/:file", false, (*Server).storeBuildFile),
+
+	newRoute("POST", "/login", false, (*Server).login),
+	newRoute("POST", "/totp/verify", false, (*Server).totpVerify),
+	newRoute("GET", "/user/oauth", false, (*Server).oauthAuthorize),
+	newRoute("POST", "/oauth/token", false, (*Server).oauthToken),
+	newRoute("POST", "/credentials/subkey", true, (*Server).subkey),
+}
+
+type object map[string]interface{}
+
+// id parses a numeric path parameter
+func (r *request) id(name string) int64 {
+	id, _ := strconv.ParseInt(r.param(name), 10, 64)
+	return id
+}
+
+// page returns the bounds of the requested page of n items,
+// along with the page number.
+func (s *Server) page(r *request, n int) (int64, int, int) {
+	page, _ := strconv.ParseInt(r.value("page"), 10, 64)
+	if page < 1 {
+		page = 1
+	}
+	start := int((page - 1) * s.PerPage)
+	end := start + int(s.PerPage)
+	if start > n {
+		start = n
+	}
+	if end > n {
+		end = n
+	}
+	return page, start, end
+}
+
+func notFound(w http.ResponseWriter, what string) {
+	writeError(w, http.StatusNotFound, what+" not found")
+}
+
+func badRequest(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusBadRequest, message)
+}
+
+//-------------------------------------------------------
+// Profile & users
+//-------------------------------------------------------
+
+func (s *Server) getProfile(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, object{"user": s.users[r.userID]})
+}
+
+func (s *Server) listProfileGames(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	games := []*itchio.Game{}
+	for _, g := range s.games {
+		if g.UserID == r.userID {
+			games = append(games, g)
+		}
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].ID < games[j].ID })
+	writeJSON(w, http.StatusOK, object{"games": games})
+}
+
+func (s *Server) listProfileOwnedKeys(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []*itchio.DownloadKey
+	for _, dk := range s.downloadKeys {
+		if dk.OwnerID == r.userID {
+			keys = append(keys, dk)
+		}
+	}
+	page, start, end := s.page(r, len(keys))
+	ownedKeys := []*itchio.DownloadKey{}
+	for _, dk := range keys[start:end] {
+		withGame := *dk
+		withGame.Game = s.games[dk.GameID]
+		ownedKeys = append(ownedKeys, &withGame)
+	}
+	writeJSON(w, http.StatusOK, object{
+		"page":       page,
+		"per_page":   s.PerPage,
+		"owned_keys": ownedKeys,
+	})
+}
+
+func (s *Server) listProfileCollections(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collections := []*itchio.Collection{}
+	for _, c := range s.collections {
+		if c.collection.UserID == r.userID {
+			collections = append(collections, c.collection)
+		}
+	}
+	sort.Slice(collections, func(i, j int) bool { return collections[i].ID < collections[j].ID })
+	writeJSON(w, http.StatusOK, object{"collections": collections})
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[r.id("id")]
+	if !ok {
+		notFound(w, "user")
+		return
+	}
+	writeJSON(w, http.StatusOK, object{"user": user})
+}
+
+//-------------------------------------------------------
+// Collections & search
+//-------------------------------------------------------
+
+func (s *Server) getCollection(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.collections[r.id("id")]
+	if !ok {
+		notFound(w, "collection")
+		return
+	}
+	writeJSON(w, http.StatusOK, object{"collection": c.collection})
+}
+
+func (s *Server) getCollectionGames(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.collections[r.id("id")]
+	if !ok {
+		notFound(w, "collection")
+		return
+	}
+	page, start, end := s.page(r, len(c.games))
+	collectionGames := []*itchio.CollectionGame{}
+	for _, cg := range c.games[start:end] {
+		withGame := *cg
+		withGame.Game = s.games[cg.GameID]
+		collectionGames = append(collectionGames, &withGame)
+	}
+	writeJSON(w, http.StatusOK, object{
+		"page":             page,
+		"per_page":         s.PerPage,
+		"collection_games": collectionGames,
+	})
+}
+
+func matches(query string, fields ...string) bool {
+	query = strings.ToLower(query)
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f), query) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) searchGames(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var games []*itchio.Game
+	for _, g := range s.games {
+		if matches(r.value("query"), g.Title) {
+			games = append(games, g)
+		}
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].ID < games[j].ID })
+	page, start, end := s.page(r, len(games))
+	writeJSON(w, http.StatusOK, object{
+		"page":     page,
+		"per_page": s.PerPage,
+		"games":    append([]*itchio.Game{}, games[start:end]...),
+	})
+}
+
+func (s *Server) searchUsers(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var users []*itchio.User
+	for _, u := range s.users {
+		if matches(r.value("query"), u.Username, u.DisplayName) {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	page, start, end := s.page(r, len(users))
+	writeJSON(w, http.StatusOK, object{
+		"page":     page,
+		"per_page": s.PerPage,
+		"users":    append([]*itchio.User{}, users[start:end]...),
+	})
+}
+
+//-------------------------------------------------------
+// Games, uploads & builds
+//-------------------------------------------------------
+
+func (s *Server) getGame(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.games[r.id("id")]
+	if !ok {
+		notFound(w, "game")
+		return
+	}
+	writeJSON(w, http.StatusOK, object{"game": g})
+}
+
+func (s *Server) listGameUploads(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gameID := r.id("id")
+	if _, ok := s.games[gameID]; !ok {
+		notFound(w, "game")
+		return
+	}
+	uploads := []*itchio.Upload{}
+	for _, id := range s.gameUploads[gameID] {
+		uploads = append(uploads, s.uploads[id].upload)
+	}
+	writeJSON(w, http.StatusOK, object{"uploads": uploads})
+}
+
+func (s *Server) newDownloadSession(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.games[r.id("id")]; !ok {
+		notFound(w, "game")
+		return
+	}
+	writeJSON(w, http.StatusOK, object{"uuid": randomToken()})
+}
+
+func (s *Server) getUpload(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	up, ok := s.uploads[r.id("id")]
+	if !ok {
+		notFound(w, "upload")
+		return
+	}
+	writeJSON(w, http.StatusOK, object{"upload": up.upload})
+}
+
+func (s *Server) listUploadBuilds(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	up, ok := s.uploads[r.id("id")]
+	if !ok {
+		notFound(w, "upload")
+		return
+	}
+	// newest first
+	builds := []*itchio.Build{}
+	for i := len(up.buildIDs) - 1; i >= 0; i-- {
+		builds = append(builds, s.builds[up.buildIDs[i]].build)
+	}
+	writeJSON(w, http.StatusOK, object{"builds": builds})
+}
+
+func (s *Server) getUploadScannedArchive(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	up, ok := s.uploads[r.id("id")]
+	if !ok || up.archive == nil {
+		notFound(w, "scanned archive")
+		return
+	}
+	writeJSON(w, http.StatusOK, object{"scanned_archive": up.archive})
+}
+
+func (s *Server) downloadUpload(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	up, ok := s.uploads[r.id("id")]
+	if !ok {
+		notFound(w, "upload")
+		return
+	}
+	content := up.content
+	if up.upload.Build != nil {
+		if f := findBuildFile(up.upload.Build, itchio.BuildFileTypeArchive, itchio.BuildFileSubTypeDefault); f != nil {
+			content = s.storage[f.ID].content
+		}
+	}
+	serveContent(w, content)
+}
+
+func (s *Server) getBuild(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.builds[r.id("id")]
+	if !ok {
+		notFound(w, "build")
+		return
+	}
+	writeJSON(w, http.StatusOK, object{"build": b.build})
+}
+
+func (s *Server) getBuildUpgradePath(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.builds[r.id("id")]
+	if !ok {
+		notFound(w, "build")
+		return
+	}
+	target, ok := s.builds[r.id("target")]
+	if !ok || target.uploadID != current.uploadID || target.build.ID < current.build.ID {
+		notFound(w, "upgrade path")
+		return
+	}
+
+	// from the current build to the target build, inclusive
+	var builds []*itchio.Build
+	for _, id := range s.uploads[current.uploadID].buildIDs {
+		if id >= current.build.ID && id <= target.build.ID {
+			builds = append(builds, s.builds[id].build)
+		}
+	}
+	writeJSON(w, http.StatusOK, object{"upgrade_path": object{"builds": builds}})
+}
+
+func (s *Server) getBuildScannedArchive(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.builds[r.id("id")]
+	if !ok || b.archive == nil {
+		notFound(w, "scanned archive")
+		return
+	}
+	writeJSON(w, http.StatusOK, object{"scanned_archive": b.archive})
+}
+
+func (s *Server) downloadBuild(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.builds[r.id("id")]
+	if !ok {
+		notFound(w, "build")
+		return
+	}
+	f := findBuildFile(b.build, itchio.BuildFileType(r.param("type")), itchio.BuildFileSubType(r.param("subtype")))
+	if f == nil {
+		notFound(w, "build file")
+		return
+	}
+	serveContent(w, s.storage[f.ID].content)
+}
+
+func findBuildFile(b *itchio.Build, fileType itchio.BuildFileType, subType itchio.BuildFileSubType) *itchio.BuildFile {
+	for _, f := range b.Files {
+		if f.Type == fileType && f.SubType == subType && f.State == itchio.BuildFileStateUploaded {
+			return f
+		}
+	}
+	return nil
+}
+
+func serveContent(w http.ResponseWriter, content []byte) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	_, _ = w.Write(content)
+}
+
+//-------------------------------------------------------
+// Wharf
+//-------------------------------------------------------
+
+func (s *Server) wharfStatus(w http.ResponseWriter, r *request) {
+	writeJSON(w, http.StatusOK, object{"success": true})
+}
+
+func (s *Server) listChannels(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	target := r.value("target")
+	if _, ok := s.targets[target]; !ok {
+		notFound(w, "target")
+		return
+	}
+	channels := s.channels[target]
+	if channels == nil {
+		channels = map[string]*itchio.Channel{}
+	}
+	writeJSON(w, http.StatusOK, object{"channels": channels})
+}
+
+func (s *Server) getChannel(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channel, ok := s.channels[r.value("target")][r.param("name")]
+	if !ok {
+		notFound(w, "channel")
+		return
+	}
+	writeJSON(w, http.StatusOK, object{"channel": channel})
+}
+
+func (s *Server) createBuild(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	target := r.value("target")
+	gameID, ok := s.targets[target]
+	if !ok {
+		notFound(w, "target")
+		return
+	}
+	if g := s.games[gameID]; g == nil || g.UserID != r.userID {
+		writeError(w, http.StatusForbidden, "you don't have permission to push to this game")
+		return
+	}
+	name := r.value("channel")
+	if name == "" {
+		badRequest(w, "missing channel")
+		return
+	}
+
+	channel := s.channels[target][name]
+	if channel == nil {
+		now := time.Now().UTC()
+		u := &itchio.Upload{
+			ID:          s.newID(),
+			Storage:     itchio.UploadStorageBuild,
+			Filename:    name,
+			DisplayName: name,
+			ChannelName: name,
+			Type:        itchio.UploadTypeDefault,
+			CreatedAt:   &now,
+			UpdatedAt:   &now,
+		}
+		s.uploads[u.ID] = &upload{gameID: gameID, upload: u}
+		s.gameUploads[gameID] = append(s.gameUploads[gameID], u.ID)
+
+		channel = &itchio.Channel{Name: name, Upload: u}
+		if s.channels[target] == nil {
+			s.channels[target] = make(map[string]*itchio.Channel)
+		}
+		s.channels[target][name] = channel
+	}
+
+	up := s.uploads[channel.Upload.ID]
+	now := time.Now().UTC()
+	b := &itchio.Build{
+		ID:          s.newID(),
+		State:       itchio.BuildStateStarted,
+		Version:     int64(len(up.buildIDs) + 1),
+		UserVersion: r.value("user_version"),
+		User:        s.users[r.userID],
+		CreatedAt:   &now,
+		UpdatedAt:   &now,
+	}
+	if channel.Head != nil {
+		b.ParentBuildID = channel.Head.ID
+	}
+	s.builds[b.ID] = &build{uploadID: up.upload.ID, target: target, channel: name, build: b}
+	up.buildIDs = append(up.buildIDs, b.ID)
+	channel.Pending = b
+
+	writeJSON(w, http.StatusOK, object{
+		"build": object{
+			"id":           b.ID,
+			"upload_id":    up.upload.ID,
+			"parent_build": object{"id": b.ParentBuildID},
+		},
+	})
+}
+
+func (s *Server) listBuildFiles(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.builds[r.id("id")]
+	if !ok {
+		notFound(w, "build")
+		return
+	}
+	files := append([]*itchio.BuildFile{}, b.build.Files...)
+	writeJSON(w, http.StatusOK, object{"files": files})
+}
+
+func (s *Server) createBuildFile(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.builds[r.id("id")]
+	if !ok {
+		notFound(w, "build")
+		return
+	}
+	fileType := itchio.BuildFileType(r.value("type"))
+	if fileType == "" {
+		badRequest(w, "missing type")
+		return
+	}
+	subType := itchio.BuildFileSubType(r.value("sub_type"))
+	if subType == "" {
+		subType = itchio.BuildFileSubTypeDefault
+	}
+
+	now := time.Now().UTC()
+	f := &itchio.BuildFile{
+		ID:        s.newID(),
+		State:     itchio.BuildFileStateCreated,
+		Type:      fileType,
+		SubType:   subType,
+		CreatedAt: &now,
+		UpdatedAt: &now,
+	}
+	b.build.Files = append(b.build.Files, f)
+	s.storage[f.ID] = &storedFile{buildID: b.build.ID}
+
+	writeJSON(w, http.StatusOK, object{
+		"file": &itchio.FileUploadSpec{
+			ID:            f.ID,
+			UploadURL:     s.URL + "/storage/" + strconv.FormatInt(f.ID, 10),
+			UploadParams:  map[string]string{},
+			UploadHeaders: map[string]string{"Content-Type": "application/octet-stream"},
+		},
+	})
+}
+
+// storeBuildFile receives the content of a build file, sent to its upload URL
+func (s *Server) storeBuildFile(w http.ResponseWriter, r *request) {
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.storage[r.id("file")]
+	if !ok {
+		notFound(w, "file")
+		return
+	}
+	stored.content = content
+	if f := s.buildFile(stored.buildID, r.id("file")); f != nil {
+		f.State = itchio.BuildFileStateUploading
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) buildFile(buildID int64, fileID int64) *itchio.BuildFile {
+	b, ok := s.builds[buildID]
+	if !ok {
+		return nil
+	}
+	for _, f := range b.build.Files {
+		if f.ID == fileID {
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *Server) finalizeBuildFile(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.builds[r.id("id")]
+	if !ok {
+		notFound(w, "build")
+		return
+	}
+	f := s.buildFile(b.build.ID, r.id("file"))
+	if f == nil {
+		notFound(w, "build file")
+		return
+	}
+	size, _ := strconv.ParseInt(r.value("size"), 10, 64)
+	if stored := s.storage[f.ID]; int64(len(stored.content)) != size {
+		badRequest(w, "size mismatch: expected "+strconv.Itoa(len(stored.content))+", got "+strconv.FormatInt(size, 10))
+		return
+	}
+	f.Size = size
+	f.State = itchio.BuildFileStateUploaded
+
+	// the real server processes builds asynchronously, we
+	// consider them done as soon as they have a patch or archive.
+	if f.Type == itchio.BuildFileTypePatch || f.Type == itchio.BuildFileTypeArchive {
+		s.completeBuild(b)
+	}
+	writeJSON(w, http.StatusOK, object{})
+}
+
+func (s *Server) completeBuild(b *build) {
+	b.build.State = itchio.BuildStateCompleted
+
+	up := s.uploads[b.uploadID]
+	up.upload.Storage = itchio.UploadStorageBuild
+	up.upload.Build = b.build
+	up.upload.BuildID = b.build.ID
+
+	if channel := s.channels[b.target][b.channel]; channel != nil {
+		channel.Head = b.build
+		if channel.Pending == b.build {
+			channel.Pending = nil
+		}
+	}
+}
+
+func (s *Server) downloadBuildFile(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.buildFile(r.id("id"), r.id("file"))
+	if f == nil || f.State != itchio.BuildFileStateUploaded {
+		notFound(w, "build file")
+		return
+	}
+	serveContent(w, s.storage[f.ID].content)
+}
+
+func (s *Server) listBuildEvents(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.builds[r.id("id")]
+	if !ok {
+		notFound(w, "build")
+		return
+	}
+	events := append([]*itchio.BuildEvent{}, b.events...)
+	writeJSON(w, http.StatusOK, object{"events": events})
+}
+
+func (s *Server) createBuildEvent(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.builds[r.id("id")]
+	if !ok {
+		notFound(w, "build")
+		return
+	}
+	event := &itchio.BuildEvent{
+		Type:    itchio.BuildEventType(r.value("type")),
+		Message: r.value("message"),
+	}
+	if data := r.value("data"); data != "" {
+		if err := json.Unmarshal([]byte(data), &event.Data); err != nil {
+			badRequest(w, "invalid data: "+err.Error())
+			return
+		}
+	}
+	b.events = append(b.events, event)
+	writeJSON(w, http.StatusOK, object{})
+}
+
+func (s *Server) createBuildFailure(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.builds[r.id("id")]
+	if !ok {
+		notFound(w, "build")
+		return
+	}
+	b.build.State = itchio.BuildStateFailed
+	if channel := s.channels[b.target][b.channel]; channel != nil && channel.Pending == b.build {
+		channel.Pending = nil
+	}
+	b.events = append(b.events, &itchio.BuildEvent{
+		Type:    itchio.BuildEventLog,
+		Message: r.value("message"),
+		Data:    itchio.BuildEventData{"fatal": r.has("fatal")},
+	})
+	writeJSON(w, http.StatusOK, object{})
+}
+
+func (s *Server) createRediffBuildFailure(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.builds[r.id("id")]
+	if !ok {
+		notFound(w, "build")
+		return
+	}
+	b.events = append(b.events, &itchio.BuildEvent{
+		Type:    itchio.BuildEventLog,
+		Message: r.value("message"),
+		Data:    itchio.BuildEventData{"rediff": true},
+	})
+	writeJSON(w, http.StatusOK, object{})
+}
+
+//-------------------------------------------------------
+// Game sessions
+//-------------------------------------------------------
+
+func parseTime(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func (s *Server) sessionsSummary(userID int64, gameID int64) *itchio.UserGameInteractionsSummary {
+	summary := &itchio.UserGameInteractionsSummary{}
+	for _, sess := range s.sessions {
+		if sess.userID != userID || sess.gameID != gameID {
+			continue
+		}
+		summary.SecondsRun += sess.session.SecondsRun
+		lastRunAt := sess.session.LastRunAt
+		if lastRunAt != nil && (summary.LastRunAt == nil || lastRunAt.After(*summary.LastRunAt)) {
+			summary.LastRunAt = lastRunAt
+		}
+	}
+	return summary
+}
+
+func (s *Server) createGameSession(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gameID, _ := strconv.ParseInt(r.value("game_id"), 10, 64)
+	if _, ok := s.games[gameID]; !ok {
+		notFound(w, "game")
+		return
+	}
+	secondsRun, _ := strconv.ParseInt(r.value("seconds_run"), 10, 64)
+	sess := &session{
+		userID: r.userID,
+		gameID: gameID,
+		session: &itchio.UserGameSession{
+			ID:         s.newID(),
+			SecondsRun: secondsRun,
+			LastRunAt:  parseTime(r.value("last_run_at")),
+		},
+	}
+	s.sessions[sess.session.ID] = sess
+
+	writeJSON(w, http.StatusOK, object{
+		"summary":           s.sessionsSummary(r.userID, gameID),
+		"user_game_session": sess.session,
+	})
+}
+
+func (s *Server) updateGameSession(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[r.id("id")]
+	if !ok || sess.userID != r.userID {
+		notFound(w, "session")
+		return
+	}
+	if r.has("seconds_run") {
+		sess.session.SecondsRun, _ = strconv.ParseInt(r.value("seconds_run"), 10, 64)
+	}
+	if lastRunAt := parseTime(r.value("last_run_at")); lastRunAt != nil {
+		sess.session.LastRunAt = lastRunAt
+	}
+
+	writeJSON(w, http.StatusOK, object{
+		"summary":           s.sessionsSummary(r.userID, sess.gameID),
+		"user_game_session": sess.session,
+	})
+}
+
+func (s *Server) getGameSessionsSummary(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, object{"summary": s.sessionsSummary(r.userID, r.id("id"))})
+}
+
+//-------------------------------------------------------
+// Login & credentials
+//-------------------------------------------------------
+
+func (s *Server) login(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[r.value("username")]
+	if !ok || account.Password != r.value("password") {
+		badRequest(w, "Incorrect username or password")
+		return
+	}
+
+	recaptchaResponse := r.value("recaptcha_response")
+	if account.RecaptchaResponse != "" && recaptchaResponse != account.RecaptchaResponse ||
+		r.has("force_recaptcha") && recaptchaResponse == "" {
+		writeJSON(w, http.StatusOK, object{
+			"recaptcha_needed": true,
+			"recaptcha_url":    s.URL + "/captcha",
+		})
+		return
+	}
+
+	if account.TOTPCode != "" {
+		token := randomToken()
+		s.loginTokens[token] = &loginToken{account: account}
+		writeJSON(w, http.StatusOK, object{
+			"totp_needed": true,
+			"token":       token,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, object{
+		"key":    s.issueAPIKey(account.UserID),
+		"cookie": newCookie(),
+	})
+}
+
+func (s *Server) totpVerify(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := r.value("token")
+	lt, ok := s.loginTokens[token]
+	if !ok {
+		badRequest(w, "invalid token")
+		return
+	}
+	if r.value("code") != lt.account.TOTPCode {
+		lt.attempts++
+		if lt.attempts >= maxTOTPAttempts {
+			delete(s.loginTokens, token)
+		}
+		badRequest(w, "invalid code")
+		return
+	}
+
+	delete(s.loginTokens, token)
+	writeJSON(w, http.StatusOK, object{
+		"key":    s.issueAPIKey(lt.account.UserID),
+		"cookie": newCookie(),
+	})
+}
+
+func newCookie() map[string]string {
+	return map[string]string{"itchio_token": randomToken()}
+}
+
+// oauthAuthorize stands in for the page users grant OAuth applications
+// access on: it grants access right away, on behalf of the default user.
+func (s *Server) oauthAuthorize(w http.ResponseWriter, r *request) {
+	redirectURI, err := url.Parse(r.value("redirect_uri"))
+	if err != nil || redirectURI.Scheme != "http" || r.value("client_id") == "" {
+		badRequest(w, "invalid redirect_uri or client_id")
+		return
+	}
+
+	query := redirectURI.Query()
+	query.Set("state", r.value("state"))
+	switch {
+	case r.value("response_type") != "code":
+		query.Set("error", "unsupported_response_type")
+	case r.value("code_challenge") == "" || r.value("code_challenge_method") != "S256":
+		query.Set("error", "invalid_request")
+		query.Set("error_description", "PKCE with S256 is required")
+	default:
+		code := OAuthCode{
+			Code:          randomToken(),
+			UserID:        s.defaultUser.ID,
+			ClientID:      r.value("client_id"),
+			RedirectURI:   r.value("redirect_uri"),
+			CodeChallenge: r.value("code_challenge"),
+		}
+		s.AddOAuthCode(code)
+		query.Set("code", code.Code)
+	}
+	redirectURI.RawQuery = query.Encode()
+	http.Redirect(w, r.Request, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) oauthToken(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.value("grant_type") {
+	case "authorization_code":
+		code, ok := s.oauthCodes[r.value("code")]
+		if !ok || code.ClientID != r.value("client_id") || code.RedirectURI != r.value("redirect_uri") {
+			badRequest(w, "invalid_grant")
+			return
+		}
+		if code.CodeChallenge != "" {
+			sum := sha256.Sum256([]byte(r.value("code_verifier")))
+			if base64.RawURLEncoding.EncodeToString(sum[:]) != code.CodeChallenge {
+				badRequest(w, "invalid_grant")
+				return
+			}
+		}
+		// codes can only be used once
+		delete(s.oauthCodes, code.Code)
+
+		access, refresh, _ := s.issueTokens(code.UserID)
+		writeJSON(w, http.StatusOK, object{
+			"key":           s.issueAPIKey(code.UserID),
+			"cookie":        newCookie(),
+			"access_token":  access,
+			"refresh_token": refresh,
+			"expires_in":    int64(s.AccessTokenTTL / time.Second),
+		})
+	case "refresh_token":
+		userID, ok := s.refreshTokens[r.value("refresh_token")]
+		if !ok {
+			badRequest(w, "invalid_grant")
+			return
+		}
+		// refresh tokens are rotated
+		delete(s.refreshTokens, r.value("refresh_token"))
+
+		access, refresh, _ := s.issueTokens(userID)
+		writeJSON(w, http.StatusOK, object{
+			"access_token":  access,
+			"refresh_token": refresh,
+			"expires_in":    int64(s.AccessTokenTTL / time.Second),
+		})
+	default:
+		badRequest(w, "unsupported_grant_type")
+	}
+}
+
+func (s *Server) subkey(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gameID, _ := strconv.ParseInt(r.value("game_id"), 10, 64)
+	if _, ok := s.games[gameID]; !ok {
+		notFound(w, "game")
+		return
+	}
+	key := s.issueAPIKey(r.userID)
+	writeJSON(w, http.StatusOK, object{
+		"key":        key.Key,
+		"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	})
+}
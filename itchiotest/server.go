@@ -0,0 +1,551 @@
+// Package itchiotest provides an in-memory fake of the itch.io API, for
+// testing code that uses go-itchio without hitting the network.
+//
+// The fake is stateful: builds created with CreateBuild show up in
+// ListChannels, game sessions add up in GetGameSessionsSummary, OAuth
+// refresh tokens rotate, etc. It responds with snake_case JSON, like
+// the real API does.
+//
+//	srv := itchiotest.NewServer()
+//	defer srv.Close()
+//
+//	game := srv.AddGame(itchio.Game{Title: "Overland", UserID: srv.DefaultUser().ID})
+//	res, err := srv.Client().GetGame(ctx, itchio.GetGameParams{GameID: game.ID})
+package itchiotest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	itchio "github.com/itchio/go-itchio"
+	"golang.org/x/time/rate"
+)
+
+// DefaultAPIKey is the API key of the default user, which
+// clients returned by Server.Client authenticate with.
+const DefaultAPIKey = "itchiotest-api-key"
+
+// DefaultPerPage is how many items paginated endpoints return per page
+const DefaultPerPage = 20
+
+// A Server is a fake itch.io API server. All its methods are safe
+// for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	nextID int64
+
+	// PerPage is how many items paginated endpoints return per page.
+	// It should be set before making requests.
+	PerPage int64
+	// AccessTokenTTL is how long OAuth access tokens are valid for.
+	// It should be set before making requests.
+	AccessTokenTTL time.Duration
+
+	latency  time.Duration
+	faults   []*Fault
+	requests []Request
+
+	defaultUser *itchio.User
+
+	users         map[int64]*itchio.User
+	apiKeys       map[string]int64
+	accounts      map[string]*Account
+	loginTokens   map[string]*loginToken
+	oauthCodes    map[string]*OAuthCode
+	accessTokens  map[string]*accessToken
+	refreshTokens map[string]int64
+
+	games        map[int64]*itchio.Game
+	gameUploads  map[int64][]int64
+	uploads      map[int64]*upload
+	builds       map[int64]*build
+	downloadKeys []*itchio.DownloadKey
+	collections  map[int64]*collection
+	targets      map[string]int64
+	channels     map[string]map[string]*itchio.Channel
+	storage      map[int64]*storedFile
+	sessions     map[int64]*session
+}
+
+type upload struct {
+	gameID   int64
+	upload   *itchio.Upload
+	content  []byte
+	archive  *itchio.ScannedArchive
+	buildIDs []int64
+}
+
+type build struct {
+	uploadID int64
+	// target and channel are set for builds pushed with CreateBuild
+	target  string
+	channel string
+	build   *itchio.Build
+	events  []*itchio.BuildEvent
+	archive *itchio.ScannedArchive
+}
+
+type collection struct {
+	collection *itchio.Collection
+	games      []*itchio.CollectionGame
+}
+
+type storedFile struct {
+	buildID int64
+	content []byte
+}
+
+type session struct {
+	userID  int64
+	gameID  int64
+	session *itchio.UserGameSession
+}
+
+type loginToken struct {
+	account  *Account
+	attempts int
+}
+
+type accessToken struct {
+	userID    int64
+	expiresAt time.Time
+}
+
+// NewServer starts a fake itch.io API server, with a default user
+// whose API key is DefaultAPIKey. It should be closed when done.
+func NewServer() *Server {
+	s := &Server{
+		nextID:         1000,
+		PerPage:        DefaultPerPage,
+		AccessTokenTTL: time.Hour,
+
+		users:         make(map[int64]*itchio.User),
+		apiKeys:       make(map[string]int64),
+		accounts:      make(map[string]*Account),
+		loginTokens:   make(map[string]*loginToken),
+		oauthCodes:    make(map[string]*OAuthCode),
+		accessTokens:  make(map[string]*accessToken),
+		refreshTokens: make(map[string]int64),
+
+		games:       make(map[int64]*itchio.Game),
+		gameUploads: make(map[int64][]int64),
+		uploads:     make(map[int64]*upload),
+		builds:      make(map[int64]*build),
+		collections: make(map[int64]*collection),
+		targets:     make(map[string]int64),
+		channels:    make(map[string]map[string]*itchio.Channel),
+		storage:     make(map[int64]*storedFile),
+		sessions:    make(map[int64]*session),
+	}
+
+	s.defaultUser = s.AddUser(itchio.User{
+		ID:          1,
+		Username:    "itchiotest",
+		DisplayName: "itchiotest",
+		Developer:   true,
+		URL:         "https://itchiotest.itch.io",
+	})
+	s.AddAPIKey(s.defaultUser.ID, DefaultAPIKey)
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// DefaultUser returns the user that DefaultAPIKey belongs to
+func (s *Server) DefaultUser() *itchio.User {
+	return s.defaultUser
+}
+
+// Client returns a client that talks to the fake server, authenticated
+// as the default user. It doesn't rate-limit, and retries quickly.
+func (s *Server) Client() *itchio.Client {
+	return s.ClientWithKey(DefaultAPIKey)
+}
+
+// ClientWithKey returns a client that talks to the fake server with the
+// given API key. It doesn't rate-limit, and retries quickly.
+func (s *Server) ClientWithKey(key string) *itchio.Client {
+	c := itchio.ClientWithKey(key)
+	s.configure(c)
+	return c
+}
+
+// OAuthClient returns an OAuth client that talks to the fake server.
+// Credentials can be obtained with IssueOAuthCredentials.
+func (s *Server) OAuthClient(creds *itchio.OAuthCredentials, config itchio.OAuthConfig) *itchio.Client {
+	c := itchio.NewOAuthClient(creds, config)
+	s.configure(c)
+	return c
+}
+
+// AuthorizeURL returns the URL of the fake's OAuth authorization page,
+// for OAuthFlow. It grants access right away, on behalf of the default
+// user, and redirects to the flow's loopback server.
+func (s *Server) AuthorizeURL() string {
+	return s.URL + "/user/oauth"
+}
+
+func (s *Server) configure(c *itchio.Client) {
+	c.SetServer(s.URL)
+	c.HTTPClient = s.Server.Client()
+	c.Limiter = rate.NewLimiter(rate.Inf, 1)
+	c.RetryPolicy = &itchio.BackoffRetryPolicy{
+		Delays: []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond},
+	}
+}
+
+//-------------------------------------------------------
+// Fault injection
+//-------------------------------------------------------
+
+// A Fault makes the server respond with an error status
+// instead of serving requests.
+type Fault struct {
+	// Path restricts the fault to requests for this path (like "/profile").
+	// All requests are affected if it's empty.
+	Path string
+	// Status is the HTTP status to respond with, like 503 or 401
+	Status int
+	// Times is how many requests the fault affects. 0 means one.
+	Times int
+	// RetryAfter is the value of the Retry-After header, if non-empty
+	RetryAfter string
+}
+
+// InjectFault makes the next matching requests fail with f.Status.
+// Faults are consumed in the order they were injected.
+func (s *Server) InjectFault(f Fault) {
+	if f.Times == 0 {
+		f.Times = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// FailNext makes the next n requests fail with the given status
+func (s *Server) FailNext(n int, status int) {
+	s.InjectFault(Fault{Status: status, Times: n})
+}
+
+// SetLatency makes the server wait before serving each request.
+// Waiting stops early if the client gives up on the request.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+func (s *Server) takeFault(path string) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.faults {
+		if f.Path != "" && f.Path != path {
+			continue
+		}
+		f.Times--
+		if f.Times <= 0 {
+			s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+		}
+		return f
+	}
+	return nil
+}
+
+//-------------------------------------------------------
+// Request log
+//-------------------------------------------------------
+
+// A Request is a request received by the server
+type Request struct {
+	Method string
+	Path   string
+	// Query holds the URL's query parameters
+	Query url.Values
+	// Form holds the parameters of url-encoded POST bodies
+	Form url.Values
+	// Authorization is the value of the Authorization header
+	Authorization string
+}
+
+// Requests returns all requests received so far, in order
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestCount returns how many requests were received for a path
+func (s *Server) RequestCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, r := range s.requests {
+		if r.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+//-------------------------------------------------------
+// Serving
+//-------------------------------------------------------
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		_ = r.ParseForm()
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		Query:         r.URL.Query(),
+		Form:          r.PostForm,
+		Authorization: r.Header.Get("Authorization"),
+	})
+	latency := s.latency
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if f := s.takeFault(r.URL.Path); f != nil {
+		if f.RetryAfter != "" {
+			w.Header().Set("Retry-After", f.RetryAfter)
+		}
+		writeError(w, f.Status, http.StatusText(f.Status))
+		return
+	}
+
+	for _, rt := range routes {
+		params, ok := rt.match(r.Method, r.URL.Path)
+		if !ok {
+			continue
+		}
+
+		req := &request{Request: r, params: params}
+		if rt.auth {
+			userID, ok := s.authenticate(r)
+			if !ok {
+				writeError(w, http.StatusUnauthorized, "invalid key")
+				return
+			}
+			req.userID = userID
+		}
+		rt.handler(s, w, req)
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "invalid path")
+}
+
+// authenticate returns the ID of the user a request is made on behalf of
+func (s *Server) authenticate(r *http.Request) (int64, bool) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		auth = r.URL.Query().Get("api_key")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.HasPrefix(auth, "Bearer ") {
+		token, ok := s.accessTokens[strings.TrimPrefix(auth, "Bearer ")]
+		if !ok || time.Now().After(token.expiresAt) {
+			return 0, false
+		}
+		return token.userID, true
+	}
+
+	userID, ok := s.apiKeys[auth]
+	return userID, ok
+}
+
+// request is an incoming request, with its path parameters and user
+type request struct {
+	*http.Request
+	params map[string]string
+	userID int64
+}
+
+func (r *request) param(name string) string {
+	return r.params[name]
+}
+
+// value returns a query parameter or form field
+func (r *request) value(name string) string {
+	return r.FormValue(name)
+}
+
+// has returns true if a query parameter or form field is present
+func (r *request) has(name string) bool {
+	if _, ok := r.URL.Query()[name]; ok {
+		return true
+	}
+	_, ok := r.PostForm[name]
+	return ok
+}
+
+type route struct {
+	method   string
+	segments []string
+	auth     bool
+	handler  func(s *Server, w http.ResponseWriter, r *request)
+}
+
+// match checks a request against the route's pattern, where
+// segments starting with ':' are parameters.
+func (rt *route) match(method string, path string) (map[string]string, bool) {
+	if method != rt.method {
+		return nil, false
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) != len(rt.segments) {
+		return nil, false
+	}
+
+	var params map[string]string
+	for i, seg := range rt.segments {
+		if strings.HasPrefix(seg, ":") {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg[1:]] = segments[i]
+			continue
+		}
+		if seg != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func newRoute(method string, pattern string, auth bool, handler func(s *Server, w http.ResponseWriter, r *request)) *route {
+	return &route{
+		method:   method,
+		segments: strings.Split(strings.Trim(pattern, "/"), "/"),
+		auth:     auth,
+		handler:  handler,
+	}
+}
+
+//-------------------------------------------------------
+// Responses
+//-------------------------------------------------------
+
+// writeJSON responds with payload encoded as snake_case JSON,
+// the way the itch.io API does.
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	body, err = json.Marshal(snakeify(doc))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, status int, messages ...string) {
+	body, _ := json.Marshal(map[string]interface{}{"errors": messages})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// snakeify converts camelCase object keys to snake_case. Values of
+// upload headers are left as-is, since they're sent verbatim to storage.
+func snakeify(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			if k == "uploadHeaders" {
+				res[snakeCase(k)] = child
+			} else {
+				res[snakeCase(k)] = snakeify(child)
+			}
+		}
+		return res
+	case []interface{}:
+		for i, child := range v {
+			v[i] = snakeify(child)
+		}
+		return v
+	}
+	return v
+}
+
+// snakeCase converts identifiers like "stillCoverUrl" or "ObjectID" to "still_cover_url"
+// and "object_id". Anything that isn't a plain identifier (channel names, header names)
+// is left as-is.
+func snakeCase(s string) string {
+	for i := 0; i < len(s); i++ {
+		if !isLower(s[i]) && !isUpper(s[i]) && !(s[i] >= '0' && s[i] <= '9') {
+			return s
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isUpper(c) {
+			// "fooBar" and "IDToken" both start a new word at the uppercase letter
+			if i > 0 && (!isUpper(s[i-1]) || i+1 < len(s) && isLower(s[i+1])) {
+				sb.WriteByte('_')
+			}
+			c += 'a' - 'A'
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+func isLower(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func isUpper(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+func randomToken() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
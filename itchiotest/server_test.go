@@ -0,0 +1,464 @@
+package itchiotest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	itchio "github.com/itchio/go-itchio"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileAndGames(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+	client := srv.Client()
+
+	profile, err := client.GetProfile(ctx)
+	assert.NoError(t, err)
+	assert.EqualValues(t, srv.DefaultUser(), profile.User)
+
+	game := srv.AddGame(itchio.Game{Title: "Overland", Platforms: itchio.Platforms{Linux: itchio.ArchitecturesAll}})
+	srv.AddGame(itchio.Game{Title: "Someone else's", UserID: 42})
+
+	games, err := client.ListProfileGames(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, games.Games, 1) {
+		assert.EqualValues(t, game, games.Games[0])
+	}
+
+	res, err := client.GetGame(ctx, itchio.GetGameParams{GameID: game.ID})
+	assert.NoError(t, err)
+	assert.EqualValues(t, "Overland", res.Game.Title)
+	assert.EqualValues(t, itchio.ArchitecturesAll, res.Game.Platforms.Linux)
+
+	_, err = client.GetGame(ctx, itchio.GetGameParams{GameID: 999999})
+	assert.True(t, errors.Is(err, itchio.ErrNotFound))
+
+	_, err = srv.ClientWithKey("wrong").GetProfile(ctx)
+	assert.True(t, errors.Is(err, itchio.ErrUnauthorized))
+}
+
+func TestSnakeCaseResponses(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	game := srv.AddGame(itchio.Game{Title: "Overland", StillCoverURL: "https://example.org/cover.png"})
+	res, err := http.Get(srv.URL + "/games/" + strconv.FormatInt(game.ID, 10) + "?api_key=" + DefaultAPIKey)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"still_cover_url":"https://example.org/cover.png"`)
+
+	assert.Equal(t, "object_id", snakeCase("ObjectID"))
+	assert.Equal(t, "id_token", snakeCase("IDToken"))
+	assert.Equal(t, "windows-64-beta", snakeCase("windows-64-beta"))
+}
+
+func TestPagination(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.PerPage = 2
+	ctx := context.Background()
+	client := srv.Client()
+
+	game := srv.AddGame(itchio.Game{Title: "Owned"})
+	for i := 0; i < 5; i++ {
+		srv.AddDownloadKey(itchio.DownloadKey{GameID: game.ID})
+	}
+
+	var lengths []int
+	for page := int64(1); page <= 3; page++ {
+		res, err := client.ListProfileOwnedKeys(ctx, itchio.ListProfileOwnedKeysParams{Page: page})
+		assert.NoError(t, err)
+		assert.EqualValues(t, page, res.Page)
+		assert.EqualValues(t, 2, res.PerPage)
+		lengths = append(lengths, len(res.OwnedKeys))
+		for _, dk := range res.OwnedKeys {
+			assert.EqualValues(t, "Owned", dk.Game.Title)
+		}
+	}
+	assert.Equal(t, []int{2, 2, 1}, lengths)
+
+	srv.AddGame(itchio.Game{Title: "Ownership"})
+	search, err := client.SearchGames(ctx, itchio.SearchGamesParams{Query: "owned"})
+	assert.NoError(t, err)
+	assert.Len(t, search.Games, 1)
+}
+
+func TestWharf(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+	client := srv.Client()
+
+	game := srv.AddGame(itchio.Game{Title: "Pushed"})
+	srv.AddTarget("itchiotest/pushed", game.ID)
+
+	push := func(content []byte) int64 {
+		build, err := client.CreateBuild(ctx, itchio.CreateBuildParams{
+			Target:      "itchiotest/pushed",
+			Channel:     "linux",
+			UserVersion: "1.0",
+		})
+		assert.NoError(t, err)
+		buildID := build.Build.ID
+
+		file, err := client.CreateBuildFile(ctx, itchio.CreateBuildFileParams{
+			BuildID: buildID,
+			Type:    itchio.BuildFileTypeArchive,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "application/octet-stream", file.File.UploadHeaders["Content-Type"])
+
+		req, err := http.NewRequest("PUT", file.File.UploadURL, bytes.NewReader(content))
+		assert.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		res.Body.Close()
+
+		_, err = client.FinalizeBuildFile(ctx, itchio.FinalizeBuildFileParams{
+			BuildID: buildID,
+			FileID:  file.File.ID,
+			Size:    int64(len(content)) + 1,
+		})
+		assert.Error(t, err, "size must match")
+
+		_, err = client.FinalizeBuildFile(ctx, itchio.FinalizeBuildFileParams{
+			BuildID: buildID,
+			FileID:  file.File.ID,
+			Size:    int64(len(content)),
+		})
+		assert.NoError(t, err)
+		return buildID
+	}
+
+	first := push([]byte("first"))
+	second := push([]byte("second build"))
+
+	channels, err := client.ListChannels(ctx, "itchiotest/pushed")
+	assert.NoError(t, err)
+	channel := channels.Channels["linux"]
+	if assert.NotNil(t, channel) {
+		assert.EqualValues(t, second, channel.Head.ID)
+		assert.EqualValues(t, first, channel.Head.ParentBuildID)
+		assert.Nil(t, channel.Pending)
+	}
+
+	uploads, err := client.ListGameUploads(ctx, itchio.ListGameUploadsParams{GameID: game.ID})
+	assert.NoError(t, err)
+	if assert.Len(t, uploads.Uploads, 1) {
+		assert.EqualValues(t, second, uploads.Uploads[0].BuildID)
+	}
+
+	res, err := http.Get(client.MakeBuildDownloadURL(itchio.MakeBuildDownloadURLParams{
+		BuildID: second,
+		Type:    itchio.BuildFileTypeArchive,
+	}))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	content, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "second build", string(content))
+
+	_, err = client.CreateBuildEvent(ctx, itchio.CreateBuildEventParams{
+		BuildID: second,
+		Type:    itchio.BuildEventLog,
+		Message: "hello",
+		Data:    itchio.BuildEventData{"level": "info"},
+	})
+	assert.NoError(t, err)
+	events, err := client.ListBuildEvents(ctx, second)
+	assert.NoError(t, err)
+	if assert.Len(t, events.Events, 1) {
+		assert.Equal(t, "hello", events.Events[0].Message)
+		assert.Equal(t, "info", events.Events[0].Data["level"])
+	}
+}
+
+func TestGameSessions(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+	client := srv.Client()
+
+	game := srv.AddGame(itchio.Game{Title: "Played"})
+	lastRunAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	res, err := client.CreateUserGameSession(ctx, itchio.CreateUserGameSessionParams{
+		GameID:     game.ID,
+		SecondsRun: 30,
+		LastRunAt:  &lastRunAt,
+	})
+	assert.NoError(t, err)
+
+	_, err = client.UpdateUserGameSession(ctx, itchio.UpdateUserGameSessionParams{
+		SessionID:  res.UserGameSession.ID,
+		SecondsRun: 60,
+	})
+	assert.NoError(t, err)
+
+	_, err = client.CreateUserGameSession(ctx, itchio.CreateUserGameSessionParams{
+		GameID:     game.ID,
+		SecondsRun: 10,
+	})
+	assert.NoError(t, err)
+
+	summary, err := client.GetGameSessionsSummary(ctx, game.ID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 70, summary.Summary.SecondsRun)
+	assert.True(t, lastRunAt.Equal(*summary.Summary.LastRunAt))
+}
+
+func TestFaults(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+	client := srv.Client()
+
+	srv.FailNext(2, http.StatusServiceUnavailable)
+	_, err := client.GetProfile(ctx)
+	assert.NoError(t, err, "503s are retried")
+	assert.Equal(t, 3, srv.RequestCount("/profile"))
+
+	srv.InjectFault(Fault{Path: "/profile/games", Status: http.StatusUnauthorized})
+	_, err = client.GetProfile(ctx)
+	assert.NoError(t, err, "faults only affect their path")
+	_, err = client.ListProfileGames(ctx)
+	assert.True(t, errors.Is(err, itchio.ErrUnauthorized))
+
+	srv.SetLatency(time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = client.GetProfile(ctx)
+	assert.Error(t, err)
+}
+
+func TestLogin(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	user := srv.AddUser(itchio.User{Username: "fasterthanlime"})
+	srv.AddAccount(Account{
+		UserID:            user.ID,
+		Username:          "fasterthanlime",
+		Password:          "hunter2",
+		TOTPCode:          "123456",
+		RecaptchaResponse: "not-a-robot",
+	})
+	client := srv.ClientWithKey("")
+
+	_, err := client.LoginWithPassword(ctx, itchio.LoginWithPasswordParams{Username: "fasterthanlime", Password: "wrong"})
+	assert.Error(t, err)
+
+	res, err := client.LoginWithPassword(ctx, itchio.LoginWithPasswordParams{Username: "fasterthanlime", Password: "hunter2"})
+	assert.NoError(t, err)
+	assert.True(t, res.RecaptchaNeeded)
+	assert.NotEmpty(t, res.RecaptchaURL)
+
+	res, err = client.LoginWithPassword(ctx, itchio.LoginWithPasswordParams{
+		Username:          "fasterthanlime",
+		Password:          "hunter2",
+		RecaptchaResponse: "not-a-robot",
+	})
+	assert.NoError(t, err)
+	assert.True(t, res.TOTPNeeded)
+
+	_, err = client.TOTPVerify(ctx, itchio.TOTPVerifyParams{Token: res.Token, Code: "000000"})
+	assert.Error(t, err)
+
+	verified, err := client.TOTPVerify(ctx, itchio.TOTPVerifyParams{Token: res.Token, Code: "123456"})
+	assert.NoError(t, err, "wrong codes can be retried")
+	assert.NotEmpty(t, verified.Cookie)
+
+	profile, err := srv.ClientWithKey(verified.Key.Key).GetProfile(ctx)
+	assert.NoError(t, err)
+	assert.EqualValues(t, user.ID, profile.User.ID)
+}
+
+func TestOAuth(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	verifier := "a-very-long-and-random-code-verifier"
+	sum := sha256.Sum256([]byte(verifier))
+	srv.AddOAuthCode(OAuthCode{
+		Code:          "code",
+		UserID:        srv.DefaultUser().ID,
+		ClientID:      "client",
+		RedirectURI:   "http://127.0.0.1/callback",
+		CodeChallenge: base64.RawURLEncoding.EncodeToString(sum[:]),
+	})
+
+	params := itchio.ExchangeOAuthCodeParams{
+		Code:         "code",
+		CodeVerifier: "wrong",
+		RedirectURI:  "http://127.0.0.1/callback",
+		ClientID:     "client",
+	}
+	_, err := srv.ClientWithKey("").ExchangeOAuthCode(ctx, params)
+	assert.Error(t, err)
+
+	params.CodeVerifier = verifier
+	exchanged, err := srv.ClientWithKey("").ExchangeOAuthCode(ctx, params)
+	assert.NoError(t, err)
+	creds := exchanged.OAuthCredentials()
+	assert.NotNil(t, creds)
+
+	_, err = srv.ClientWithKey("").ExchangeOAuthCode(ctx, params)
+	assert.Error(t, err, "codes can only be used once")
+
+	var refreshed []*itchio.OAuthCredentials
+	client := srv.OAuthClient(creds, itchio.OAuthConfig{
+		ClientID: "client",
+		OnRefresh: func(creds *itchio.OAuthCredentials) error {
+			refreshed = append(refreshed, creds)
+			return nil
+		},
+	})
+
+	_, err = client.GetProfile(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, refreshed)
+
+	srv.ExpireAccessTokens()
+	_, err = client.GetProfile(ctx)
+	assert.NoError(t, err, "expired access tokens are refreshed")
+	if assert.Len(t, refreshed, 1) {
+		assert.NotEqual(t, creds.RefreshToken, refreshed[0].RefreshToken, "refresh tokens are rotated")
+	}
+
+	srv.ExpireAccessTokens()
+	srv.RevokeRefreshTokens()
+	_, err = client.GetProfile(ctx)
+	assert.True(t, errors.Is(err, itchio.ErrReauthRequired))
+}
+
+func TestOAuthFlow(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	flow := &itchio.OAuthFlow{
+		ClientID:     "client",
+		Scopes:       []string{"profile:me"},
+		AuthorizeURL: srv.AuthorizeURL(),
+		SuccessPage:  "all done",
+	}
+
+	pages := make(chan string, 1)
+	creds, err := flow.Run(ctx, srv.ClientWithKey(""), func(authorizeURL string) error {
+		// the "browser" follows the redirect to the loopback server
+		go func() {
+			res, err := http.Get(authorizeURL)
+			if !assert.NoError(t, err) {
+				pages <- ""
+				return
+			}
+			defer res.Body.Close()
+			page, _ := ioutil.ReadAll(res.Body)
+			pages <- string(page)
+		}()
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "all done", <-pages)
+	if assert.NotNil(t, creds) {
+		profile, err := srv.OAuthClient(creds, itchio.OAuthConfig{ClientID: "client"}).GetProfile(ctx)
+		assert.NoError(t, err)
+		assert.EqualValues(t, srv.DefaultUser().ID, profile.User.ID)
+	}
+}
+
+func TestLoginFlow(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	user := srv.AddUser(itchio.User{Username: "fasterthanlime"})
+	srv.AddAccount(Account{
+		UserID:            user.ID,
+		Username:          "fasterthanlime",
+		Password:          "hunter2",
+		TOTPCode:          "123456",
+		RecaptchaResponse: "not-a-robot",
+	})
+
+	var transitions []string
+	var recaptchaURLs []string
+	flow := &itchio.LoginFlow{
+		Username: "fasterthanlime",
+		Password: "hunter2",
+		Recaptcha: func(ctx context.Context, recaptchaURL string) (string, error) {
+			recaptchaURLs = append(recaptchaURLs, recaptchaURL)
+			if len(recaptchaURLs) == 1 {
+				return "a-robot", nil
+			}
+			return "not-a-robot", nil
+		},
+		TOTP: func(ctx context.Context, attempt int) (string, error) {
+			if attempt == 1 {
+				return "000000", nil
+			}
+			return "123456", nil
+		},
+		OnStateChange: func(from itchio.LoginState, to itchio.LoginState) {
+			transitions = append(transitions, from.String()+">"+to.String())
+		},
+	}
+
+	res, err := flow.Run(ctx, srv.ClientWithKey(""))
+	assert.NoError(t, err)
+	if assert.NotNil(t, res) {
+		assert.EqualValues(t, user.ID, res.User.ID)
+		assert.NotEmpty(t, res.Key.Key)
+		assert.NotEmpty(t, res.Cookie)
+	}
+	assert.Len(t, recaptchaURLs, 2, "wrong recaptcha responses are retried")
+	assert.Equal(t, []string{
+		"password>recaptcha",
+		"recaptcha>password",
+		"password>recaptcha",
+		"recaptcha>password",
+		"password>totp",
+		"totp>totp",
+		"totp>profile",
+		"profile>done",
+	}, transitions)
+
+	transitions = nil
+	flow.Password = "wrong"
+	_, err = flow.Run(ctx, srv.ClientWithKey(""))
+	assert.True(t, itchio.IsAPIError(err))
+	assert.Equal(t, []string{"password>failed"}, transitions)
+
+	transitions = nil
+	flow.Password = "hunter2"
+	flow.TOTP = func(ctx context.Context, attempt int) (string, error) {
+		return "000000", nil
+	}
+	_, err = flow.Run(ctx, srv.ClientWithKey(""))
+	assert.Error(t, err)
+	assert.Equal(t, []string{
+		"password>totp",
+		"totp>totp",
+		"totp>totp",
+		"totp>failed",
+	}, transitions[len(transitions)-4:], "wrong codes are retried up to MaxAttempts times")
+
+	flow.TOTP = nil
+	_, err = flow.Run(ctx, srv.ClientWithKey(""))
+	assert.Error(t, err, "TOTP codes can't be asked for without a callback")
+}
@@ -0,0 +1,172 @@
+package itchio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogLevel is the importance of a log message. Its values
+// match those of log/slog, so they can be converted directly.
+type LogLevel int
+
+const (
+	// LogLevelDebug is for verbose diagnostics: request headers, response bodies
+	LogLevelDebug LogLevel = -4
+	// LogLevelInfo is for one line per request, response, retry or token refresh
+	LogLevelInfo LogLevel = 0
+	// LogLevelWarn is for things that went wrong but didn't fail the call
+	LogLevelWarn LogLevel = 4
+	// LogLevelError is for things that failed the call
+	LogLevelError LogLevel = 8
+)
+
+func (l LogLevel) String() string {
+	switch {
+	case l < LogLevelInfo:
+		return "DEBUG"
+	case l < LogLevelWarn:
+		return "INFO"
+	case l < LogLevelError:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+// A Logger receives diagnostics from a Client. keyvals is a list of
+// alternating keys (strings) and values, like log/slog.
+type Logger interface {
+	// Enabled returns true if messages of the given level are logged.
+	// It lets callers skip building expensive messages.
+	Enabled(ctx context.Context, level LogLevel) bool
+	// Log logs a message, along with key/value pairs.
+	Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Enabled(ctx context.Context, level LogLevel) bool { return false }
+
+func (nopLogger) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {}
+
+// NopLogger is a Logger that discards everything
+var NopLogger Logger = nopLogger{}
+
+// WriterLogger is a Logger that writes one line per message to an
+// io.Writer. Its level can be changed at any time with SetLevel.
+type WriterLogger struct {
+	level int64
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+var _ Logger = (*WriterLogger)(nil)
+
+// NewWriterLogger returns a logger that writes messages of the given
+// level (or more important) to w.
+func NewWriterLogger(w io.Writer, level LogLevel) *WriterLogger {
+	return &WriterLogger{w: w, level: int64(level)}
+}
+
+// DefaultLogger returns the logger new clients use: it writes to stderr,
+// at a level that depends on the GO_ITCHIO_DEBUG environment variable.
+// By default, only warnings and errors are logged. GO_ITCHIO_DEBUG=1 also logs
+// requests, responses, retries and token refreshes, and GO_ITCHIO_DEBUG=2 also
+// logs request headers and response bodies.
+//
+// Each call returns a new logger, so changing the level of one client's logger
+// doesn't affect other clients.
+func DefaultLogger() *WriterLogger {
+	return NewWriterLogger(os.Stderr, envLogLevel())
+}
+
+func envLogLevel() LogLevel {
+	debugLevel, _ := strconv.ParseInt(os.Getenv("GO_ITCHIO_DEBUG"), 10, 64)
+	switch {
+	case debugLevel >= 2:
+		return LogLevelDebug
+	case debugLevel >= 1:
+		return LogLevelInfo
+	default:
+		return LogLevelWarn
+	}
+}
+
+// Level returns the current level of the logger
+func (wl *WriterLogger) Level() LogLevel {
+	return LogLevel(atomic.LoadInt64(&wl.level))
+}
+
+// SetLevel changes which messages get logged from now on
+func (wl *WriterLogger) SetLevel(level LogLevel) {
+	atomic.StoreInt64(&wl.level, int64(level))
+}
+
+// Enabled implements Logger
+func (wl *WriterLogger) Enabled(ctx context.Context, level LogLevel) bool {
+	return level >= wl.Level()
+}
+
+// Log implements Logger
+func (wl *WriterLogger) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	if !wl.Enabled(ctx, level) {
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("go-itchio: ")
+	sb.WriteString(level.String())
+	sb.WriteString(" ")
+	sb.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		sb.WriteString(" ")
+		sb.WriteString(fmt.Sprint(keyvals[i]))
+		sb.WriteString("=")
+		if i+1 < len(keyvals) {
+			sb.WriteString(formatLogValue(keyvals[i+1]))
+		} else {
+			sb.WriteString("<missing>")
+		}
+	}
+	sb.WriteString("\n")
+
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	_, _ = io.WriteString(wl.w, sb.String())
+}
+
+func formatLogValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case time.Duration:
+		s = v.String()
+	case time.Time:
+		s = v.Format(time.RFC3339Nano)
+	case error:
+		s = v.Error()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// logger returns the client's logger, never nil
+func (c *Client) logger() Logger {
+	if c.Logger == nil {
+		return NopLogger
+	}
+	return c.Logger
+}
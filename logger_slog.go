@@ -0,0 +1,27 @@
+//go:build go1.21
+// +build go1.21
+
+package itchio
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger returns a Logger that forwards everything to
+// a log/slog logger. LogLevel values map directly to slog.Level.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return &slogLogger{l: l}
+}
+
+func (sl *slogLogger) Enabled(ctx context.Context, level LogLevel) bool {
+	return sl.l.Enabled(ctx, slog.Level(level))
+}
+
+func (sl *slogLogger) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	sl.l.Log(ctx, slog.Level(level), msg, keyvals...)
+}
@@ -0,0 +1,26 @@
+//go:build go1.21
+// +build go1.21
+
+package itchio
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	ctx := context.Background()
+
+	assert.False(t, logger.Enabled(ctx, LogLevelDebug))
+	assert.True(t, logger.Enabled(ctx, LogLevelWarn))
+
+	logger.Log(ctx, LogLevelWarn, "rate limited", "status", 503)
+	assert.Contains(t, buf.String(), "level=WARN")
+	assert.Contains(t, buf.String(), `msg="rate limited" status=503`)
+}
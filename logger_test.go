@@ -0,0 +1,90 @@
+package itchio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedLog struct {
+	level   LogLevel
+	msg     string
+	keyvals []interface{}
+}
+
+type recordingLogger struct {
+	mu   sync.Mutex
+	logs []recordedLog
+}
+
+func (rl *recordingLogger) Enabled(ctx context.Context, level LogLevel) bool { return true }
+
+func (rl *recordingLogger) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.logs = append(rl.logs, recordedLog{level: level, msg: msg, keyvals: keyvals})
+}
+
+func (rl *recordingLogger) messages() []string {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	var msgs []string
+	for _, l := range rl.logs {
+		msgs = append(msgs, l.msg)
+	}
+	return msgs
+}
+
+func TestWriterLogger(t *testing.T) {
+	var buf bytes.Buffer
+	wl := NewWriterLogger(&buf, LogLevelInfo)
+	ctx := context.Background()
+
+	wl.Log(ctx, LogLevelDebug, "hidden")
+	wl.Log(ctx, LogLevelInfo, "request", "method", "GET", "wait", 2*time.Second, "error", errors.New("oh no"))
+	assert.Equal(t, "go-itchio: INFO request method=GET wait=2s error=\"oh no\"\n", buf.String())
+
+	buf.Reset()
+	wl.SetLevel(LogLevelDebug)
+	wl.Log(ctx, LogLevelDebug, "shown", "dangling")
+	assert.Equal(t, "go-itchio: DEBUG shown dangling=<missing>\n", buf.String())
+}
+
+func TestClientLogsThroughLogger(t *testing.T) {
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"user":{"id":1}}`))
+	}))
+	defer server.Close()
+
+	logger := &recordingLogger{}
+	client := newTestKeyClient(server)
+	client.Logger = logger
+
+	_, err := client.GetProfile(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"request",
+		"request headers",
+		"response",
+		"rate limited",
+		"retrying",
+		"response",
+		"response body",
+	}, logger.messages())
+}
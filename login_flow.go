@@ -0,0 +1,275 @@
+package itchio
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultLoginAttempts is how many recaptcha responses, or TOTP codes,
+// a LoginFlow asks for before giving up, unless told otherwise
+const DefaultLoginAttempts = 3
+
+// Messages /totp/verify rejects codes with. The API has no error codes,
+// only English messages, so these are matched exactly. Rejections with
+// other messages aren't retried, and are logged, so that changes to the
+// API show up instead of making LoginFlow ask for codes that can't work.
+const (
+	totpWrongCode    = "invalid code"
+	totpInvalidToken = "invalid token"
+)
+
+// A LoginState is a step of a LoginFlow
+type LoginState int
+
+const (
+	// LoginStatePassword is when the username and password are sent,
+	// along with the recaptcha response, if there's one
+	LoginStatePassword LoginState = iota
+	// LoginStateRecaptcha is when a recaptcha has to be solved
+	LoginStateRecaptcha
+	// LoginStateTOTP is when a two-factor code has to be entered
+	LoginStateTOTP
+	// LoginStateProfile is when the profile of the user is fetched
+	LoginStateProfile
+	// LoginStateDone is when the user is logged in
+	LoginStateDone
+	// LoginStateFailed is when logging in failed
+	LoginStateFailed
+)
+
+func (s LoginState) String() string {
+	switch s {
+	case LoginStatePassword:
+		return "password"
+	case LoginStateRecaptcha:
+		return "recaptcha"
+	case LoginStateTOTP:
+		return "totp"
+	case LoginStateProfile:
+		return "profile"
+	case LoginStateDone:
+		return "done"
+	case LoginStateFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// A LoginFlow logs a user in with their password, going through
+// recaptchas and two-factor authentication as needed, by asking
+// the UI for what it needs with callbacks.
+//
+//	flow := &itchio.LoginFlow{
+//		Username: username,
+//		Password: password,
+//		TOTP: func(ctx context.Context, attempt int) (string, error) {
+//			return ui.AskForCode(attempt > 1)
+//		},
+//	}
+//	res, err := flow.Run(ctx, itchio.ClientWithKey(""))
+type LoginFlow struct {
+	// Username (or e-mail address) of the user
+	Username string
+	Password string
+
+	// Recaptcha is called when the server wants a recaptcha solved, with
+	// the URL of the challenge. It returns the recaptcha response. If it's
+	// nil, logging in fails when a recaptcha is needed.
+	Recaptcha func(ctx context.Context, recaptchaURL string) (string, error)
+	// TOTP is called when the user has two-factor authentication enabled.
+	// It returns the code they entered. attempt starts at 1, and goes up
+	// when the previous code was wrong. If it's nil, logging in fails for
+	// users with two-factor authentication.
+	TOTP func(ctx context.Context, attempt int) (string, error)
+
+	// MaxAttempts is how many recaptcha responses, and how many TOTP codes,
+	// are asked for before giving up. It also caps how many times the flow
+	// logs in again when the server rejects its TOTP token, because it
+	// expired. Defaults to DefaultLoginAttempts.
+	MaxAttempts int
+
+	// OnStateChange, if set, is called on every transition
+	OnStateChange func(from LoginState, to LoginState)
+}
+
+// LoginResult holds the credentials of a user who logged in
+// with a LoginFlow, and their profile
+type LoginResult struct {
+	Key    *APIKey
+	Cookie Cookie
+	User   *User
+}
+
+// loginRun is the state of a LoginFlow being run
+type loginRun struct {
+	flow  *LoginFlow
+	state LoginState
+
+	params       LoginWithPasswordParams
+	recaptchaURL string
+	totpToken    string
+
+	recaptchaAttempts int
+	wrongTOTPCodes    int
+	totpTokenRenewals int
+
+	result LoginResult
+}
+
+// Run logs the user in with c, which doesn't need credentials.
+// Errors returned by the API (like a wrong password) can be
+// inspected with errors.As.
+func (f *LoginFlow) Run(ctx context.Context, c *Client) (*LoginResult, error) {
+	r := &loginRun{
+		flow:  f,
+		state: LoginStatePassword,
+		params: LoginWithPasswordParams{
+			Username: f.Username,
+			Password: f.Password,
+		},
+	}
+
+	for r.state != LoginStateDone {
+		next, err := r.step(ctx, c)
+		if err != nil {
+			err = errors.Wrapf(err, "logging in (%s)", r.state)
+			r.transition(LoginStateFailed)
+			return nil, err
+		}
+		r.transition(next)
+	}
+	return &r.result, nil
+}
+
+func (r *loginRun) transition(to LoginState) {
+	from := r.state
+	r.state = to
+	if r.flow.OnStateChange != nil {
+		r.flow.OnStateChange(from, to)
+	}
+}
+
+func (r *loginRun) maxAttempts() int {
+	if r.flow.MaxAttempts > 0 {
+		return r.flow.MaxAttempts
+	}
+	return DefaultLoginAttempts
+}
+
+// step performs the current state's work, and returns the next state
+func (r *loginRun) step(ctx context.Context, c *Client) (LoginState, error) {
+	// logging in doesn't need credentials
+	anonymousCtx := withAuthenticator(ctx, Anonymous)
+
+	switch r.state {
+	case LoginStatePassword:
+		res, err := c.LoginWithPassword(anonymousCtx, r.params)
+		// recaptcha responses can only be used once
+		r.params.RecaptchaResponse = ""
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case res.RecaptchaNeeded:
+			r.recaptchaURL = res.RecaptchaURL
+			return LoginStateRecaptcha, nil
+		case res.TOTPNeeded:
+			r.totpToken = res.Token
+			return LoginStateTOTP, nil
+		case res.Key != nil:
+			r.result.Key = res.Key
+			r.result.Cookie = res.Cookie
+			return LoginStateProfile, nil
+		}
+		return 0, errors.New("itchio: login response has no key, and asks for nothing")
+
+	case LoginStateRecaptcha:
+		if r.flow.Recaptcha == nil {
+			return 0, errors.New("itchio: login needs a recaptcha, but LoginFlow.Recaptcha is nil")
+		}
+		if r.recaptchaAttempts >= r.maxAttempts() {
+			return 0, errors.Errorf("itchio: recaptcha failed %d times", r.recaptchaAttempts)
+		}
+		r.recaptchaAttempts++
+		response, err := r.flow.Recaptcha(ctx, r.recaptchaURL)
+		if err != nil {
+			return 0, err
+		}
+		r.params.RecaptchaResponse = response
+		// the server asks for another recaptcha if the response is wrong
+		return LoginStatePassword, nil
+
+	case LoginStateTOTP:
+		if r.flow.TOTP == nil {
+			return 0, errors.New("itchio: login needs a TOTP code, but LoginFlow.TOTP is nil")
+		}
+		code, err := r.flow.TOTP(ctx, r.wrongTOTPCodes+1)
+		if err != nil {
+			return 0, err
+		}
+		res, err := c.TOTPVerify(anonymousCtx, TOTPVerifyParams{Token: r.totpToken, Code: code})
+		if err != nil {
+			apiErr, rejected := asTOTPRejection(err)
+			switch {
+			case !rejected:
+				// network errors, outages, etc.
+			case hasAPIErrorMessage(apiErr, totpWrongCode):
+				r.wrongTOTPCodes++
+				if r.wrongTOTPCodes < r.maxAttempts() {
+					c.logger().Log(ctx, LogLevelInfo, "wrong TOTP code", "attempt", r.wrongTOTPCodes)
+					return LoginStateTOTP, nil
+				}
+			case hasAPIErrorMessage(apiErr, totpInvalidToken):
+				// the token expired, or was invalidated after too many
+				// wrong codes: no code will work with it, log in again
+				// for a new one
+				r.totpTokenRenewals++
+				if r.totpTokenRenewals < r.maxAttempts() {
+					c.logger().Log(ctx, LogLevelInfo, "TOTP token rejected, logging in again")
+					return LoginStatePassword, nil
+				}
+			default:
+				c.logger().Log(ctx, LogLevelWarn, "unrecognized TOTP error, not retrying", "messages", apiErr.Messages)
+			}
+			return 0, err
+		}
+		r.result.Key = res.Key
+		r.result.Cookie = res.Cookie
+		return LoginStateProfile, nil
+
+	case LoginStateProfile:
+		if r.result.Key == nil {
+			return 0, errors.New("itchio: login response has no key")
+		}
+		res, err := c.With(WithKey(r.result.Key.Key)).GetProfile(ctx)
+		if err != nil {
+			return 0, err
+		}
+		r.result.User = res.User
+		return LoginStateDone, nil
+	}
+	return 0, errors.Errorf("itchio: invalid login state %d", r.state)
+}
+
+// asTOTPRejection returns the API error a TOTP verification was
+// rejected with, as opposed to network errors, outages, etc. Some API
+// errors come with a 200 status.
+func asTOTPRejection(err error) (*APIError, bool) {
+	apiErr, ok := AsAPIError(err)
+	if !ok || (apiErr.StatusCode != http.StatusBadRequest && apiErr.StatusCode != http.StatusOK) {
+		return nil, false
+	}
+	return apiErr, true
+}
+
+// hasAPIErrorMessage returns true if apiErr comes with message
+func hasAPIErrorMessage(apiErr *APIError, message string) bool {
+	for _, m := range apiErr.Messages {
+		if m == message {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package itchio
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginFlowRecaptchaAttempts(t *testing.T) {
+	var logins int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&logins, 1)
+		assert.Empty(t, r.Header.Get("Authorization"), "logging in doesn't need credentials")
+		_, _ = w.Write([]byte(`{"recaptchaNeeded":true,"recaptchaUrl":"https://example.com/captcha"}`))
+	}))
+	defer server.Close()
+
+	var states []LoginState
+	flow := &LoginFlow{
+		Username:    "user",
+		Password:    "password",
+		MaxAttempts: 2,
+		Recaptcha: func(ctx context.Context, recaptchaURL string) (string, error) {
+			assert.Equal(t, "https://example.com/captcha", recaptchaURL)
+			return "wrong", nil
+		},
+		OnStateChange: func(from LoginState, to LoginState) {
+			states = append(states, to)
+		},
+	}
+
+	_, err := flow.Run(context.Background(), newTestKeyClient(server))
+	assert.Error(t, err)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&logins))
+	assert.Equal(t, []LoginState{
+		LoginStateRecaptcha, LoginStatePassword,
+		LoginStateRecaptcha, LoginStatePassword,
+		LoginStateRecaptcha, LoginStateFailed,
+	}, states)
+
+	flow.Recaptcha = nil
+	_, err = flow.Run(context.Background(), newTestKeyClient(server))
+	assert.Error(t, err, "recaptchas can't be asked for without a callback")
+}
+
+func TestLoginFlowExpiredTOTPToken(t *testing.T) {
+	var logins, expiredTokens int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			n := atomic.AddInt32(&logins, 1)
+			_, _ = fmt.Fprintf(w, `{"totpNeeded":true,"token":"token-%d"}`, n)
+		case "/totp/verify":
+			// the first expiredTokens tokens issued are rejected
+			assert.NoError(t, r.ParseForm())
+			var n int32
+			_, _ = fmt.Sscanf(r.Form.Get("token"), "token-%d", &n)
+			if n <= atomic.LoadInt32(&expiredTokens) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors":["invalid token"]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"key":{"id":1,"key":"KEY"},"cookie":{}}`))
+		case "/profile":
+			_, _ = w.Write([]byte(`{"user":{"id":1}}`))
+		}
+	}))
+	defer server.Close()
+
+	var attempts []int
+	var states []string
+	flow := &LoginFlow{
+		Username: "user",
+		Password: "password",
+		TOTP: func(ctx context.Context, attempt int) (string, error) {
+			attempts = append(attempts, attempt)
+			return "123456", nil
+		},
+		OnStateChange: func(from LoginState, to LoginState) {
+			states = append(states, from.String()+">"+to.String())
+		},
+	}
+
+	// the first token expires before the code is entered
+	atomic.StoreInt32(&expiredTokens, 1)
+	res, err := flow.Run(context.Background(), newTestKeyClient(server))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, res.User.ID)
+	assert.Equal(t, []int{1, 1}, attempts, "codes sent with expired tokens weren't wrong")
+	assert.Equal(t, []string{
+		"password>totp", "totp>password",
+		"password>totp", "totp>profile", "profile>done",
+	}, states)
+
+	// tokens keep expiring
+	atomic.StoreInt32(&logins, 0)
+	atomic.StoreInt32(&expiredTokens, 100)
+	_, err = flow.Run(context.Background(), newTestKeyClient(server))
+	assert.Error(t, err)
+	assert.EqualValues(t, DefaultLoginAttempts, atomic.LoadInt32(&logins), "logging in again is capped")
+}
+
+func TestLoginFlowSpendsRecaptchaResponsesOnce(t *testing.T) {
+	var mu sync.Mutex
+	var recaptchaResponses []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		switch r.URL.Path {
+		case "/login":
+			mu.Lock()
+			recaptchaResponses = append(recaptchaResponses, r.Form.Get("recaptcha_response"))
+			n := len(recaptchaResponses)
+			mu.Unlock()
+			if n == 1 {
+				_, _ = w.Write([]byte(`{"recaptchaNeeded":true,"recaptchaUrl":"https://example.com/captcha"}`))
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"totpNeeded":true,"token":"token-%d"}`, n)
+		case "/totp/verify":
+			// the first token expires before the code is entered
+			if r.Form.Get("token") == "token-2" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors":["invalid token"]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"key":{"id":1,"key":"KEY"},"cookie":{}}`))
+		case "/profile":
+			_, _ = w.Write([]byte(`{"user":{"id":1}}`))
+		}
+	}))
+	defer server.Close()
+
+	flow := &LoginFlow{
+		Username: "user",
+		Password: "password",
+		Recaptcha: func(ctx context.Context, recaptchaURL string) (string, error) {
+			return "solved", nil
+		},
+		TOTP: func(ctx context.Context, attempt int) (string, error) {
+			return "123456", nil
+		},
+	}
+	_, err := flow.Run(context.Background(), newTestKeyClient(server))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", "solved", ""}, recaptchaResponses, "recaptcha responses are only sent once")
+}
+
+func TestLoginFlowUnrecognizedTOTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			_, _ = w.Write([]byte(`{"totpNeeded":true,"token":"token"}`))
+		case "/totp/verify":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["code already used"]}`))
+		}
+	}))
+	defer server.Close()
+
+	var codes int32
+	flow := &LoginFlow{
+		Username: "user",
+		Password: "password",
+		TOTP: func(ctx context.Context, attempt int) (string, error) {
+			atomic.AddInt32(&codes, 1)
+			return "123456", nil
+		},
+	}
+
+	logger := &recordingLogger{}
+	client := newTestKeyClient(server)
+	client.Logger = logger
+	_, err := flow.Run(context.Background(), client)
+	assert.Error(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&codes), "errors that aren't understood aren't retried")
+	assert.Contains(t, logger.messages(), "unrecognized TOTP error, not retrying")
+}
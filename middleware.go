@@ -0,0 +1,74 @@
+package itchio
+
+import "net/http"
+
+// RoundTripFunc performs a single HTTP request and returns its response.
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// A Middleware wraps a RoundTripFunc with additional behavior: setting headers,
+// logging, collecting metrics, serving responses from a cache, injecting faults, etc.
+//
+// Middleware wrap every attempt made by Client.Do, so a request that gets
+// retried goes through the chain once per attempt. OAuth token refresh
+// requests go through the chain too.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// Use appends middleware to the client's chain. Middleware run in the
+// order they were added: the first one registered sees the request first,
+// and the response last. The innermost step is always c.HTTPClient.
+//
+// It is safe to call Use while requests are in flight: they keep using
+// the chain as it was when they started.
+func (c *Client) Use(mws ...Middleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// never append to the shared backing array, in-flight requests
+	// may be holding a slice of it.
+	middleware := make([]Middleware, 0, len(c.middleware)+len(mws))
+	middleware = append(middleware, c.middleware...)
+	middleware = append(middleware, mws...)
+	c.middleware = middleware
+}
+
+// roundTripper returns the client's middleware chain,
+// wrapped around c.HTTPClient
+func (c *Client) roundTripper() RoundTripFunc {
+	c.mu.RLock()
+	middleware := c.middleware
+	c.mu.RUnlock()
+
+	httpClient := c.HTTPClient
+	rt := RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return httpClient.Do(req)
+	})
+	for i := len(middleware) - 1; i >= 0; i-- {
+		rt = middleware[i](rt)
+	}
+	return rt
+}
+
+// onRateLimitedMiddleware calls cb every time the server responds
+// with a rate-limiting status code.
+func onRateLimitedMiddleware(cb OnRateLimited) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			res, err := next(req)
+			if err == nil && isRateLimitedStatus(res.StatusCode) {
+				cb(req, res)
+			}
+			return res, err
+		}
+	}
+}
+
+// onOutgoingRequestMiddleware calls cb before every request
+// is sent.
+func onOutgoingRequestMiddleware(cb OnOutgoingRequest) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			cb(req)
+			return next(req)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package itchio
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "outer,inner", r.Header.Get("X-Layers"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"user":{"id":1}}`))
+	}))
+	defer server.Close()
+
+	var trail []string
+	layer := func(name string) Middleware {
+		return func(next RoundTripFunc) RoundTripFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				trail = append(trail, name+" in")
+				if prev := req.Header.Get("X-Layers"); prev != "" {
+					req.Header.Set("X-Layers", prev+","+name)
+				} else {
+					req.Header.Set("X-Layers", name)
+				}
+				res, err := next(req)
+				trail = append(trail, name+" out")
+				return res, err
+			}
+		}
+	}
+
+	client := newTestKeyClient(server)
+	client.Use(layer("outer"), layer("inner"))
+
+	_, err := client.GetProfile(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outer in", "inner in", "inner out", "outer out"}, trail)
+}
+
+func TestMiddlewareFaultInjectionIsRetried(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"user":{"id":1}}`))
+	}))
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+	client.RetryPolicy = &BackoffRetryPolicy{Delays: []time.Duration{0}}
+
+	var injected int32
+	client.Use(func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			if atomic.AddInt32(&injected, 1) == 1 {
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Header:     http.Header{},
+					Body:       http.NoBody,
+					Request:    req,
+				}, nil
+			}
+			return next(req)
+		}
+	})
+
+	var rateLimited []int32
+	for i := int32(0); i < 2; i++ {
+		i := i
+		client.OnRateLimited(func(req *http.Request, res *http.Response) {
+			rateLimited = append(rateLimited, i)
+		})
+	}
+
+	_, err := client.GetProfile(context.Background())
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&injected))
+	// the fault was injected outside of the rate limiting hooks, so they never saw it
+	assert.Empty(t, rateLimited)
+}
+
+func TestMiddlewareSeesOAuthRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/oauth/token":
+			_, _ = w.Write([]byte(`{"accessToken":"new-access","expiresIn":300}`))
+		default:
+			_, _ = w.Write([]byte(`{"user":{"id":1}}`))
+		}
+	}))
+	defer server.Close()
+
+	client := newTestOAuthClient(t, server, &OAuthCredentials{
+		AccessToken:  "old-access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(-1 * time.Minute),
+	}, OAuthConfig{
+		ClientID: "client-123",
+	})
+
+	var paths []string
+	client.OnOutgoingRequest(func(req *http.Request) {
+		paths = append(paths, req.URL.Path)
+	})
+
+	_, err := client.GetProfile(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/oauth/token", "/profile"}, paths)
+}
+
+func TestMiddlewareErrorsPropagate(t *testing.T) {
+	client := ClientWithKey("APIKEY")
+	client.RetryPolicy = NoRetry
+
+	boom := errors.New("boom")
+	client.Use(func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			return nil, boom
+		}
+	})
+
+	_, err := client.GetProfile(context.Background())
+	assert.True(t, errors.Is(err, boom))
+}
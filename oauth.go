@@ -2,20 +2,17 @@ package itchio
 
 import (
 	"context"
-	"log"
+	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
-	"github.com/itchio/httpkit/timeout"
+	"github.com/pkg/errors"
 )
 
 // contextKey is used for context values to avoid collisions
 type contextKey string
 
-// skipOAuthRefreshKey marks a context as being part of a token refresh operation.
-// Requests with this context skip OAuth refresh logic to avoid deadlocks.
-const skipOAuthRefreshKey contextKey = "skipOAuthRefresh"
-
 // OAuthCredentials holds the current OAuth token state
 type OAuthCredentials struct {
 	AccessToken  string
@@ -64,19 +61,37 @@ type OAuthConfig struct {
 	// RefreshBuffer is how early before expiry to proactively refresh.
 	// Defaults to 60 seconds if zero.
 	RefreshBuffer time.Duration
-}
 
-// oauthState holds the internal OAuth state for a Client
-type oauthState struct {
-	creds     *OAuthCredentials
-	config    OAuthConfig
-	credsMu   sync.RWMutex
-	refreshMu sync.Mutex
+	// OnReauthRequired is called when the refresh token is rejected,
+	// because it has expired or was revoked: users need to log in again.
+	// Until Client.SetOAuthCredentials is called, requests fail with
+	// ErrReauthRequired. It's called once per lost session, with the
+	// refresh error.
+	OnReauthRequired func(err error)
+
+	// Store, if set, is where refreshed credentials are saved, before
+	// OnRefresh is called. If it's a CredentialUpdater, refreshes happen
+	// under its lock, and credentials another process refreshed in the
+	// meantime are used instead. Since other processes wait for that lock,
+	// refreshes made under it aren't retried, and give up after
+	// StoreRefreshTimeout. See NewOAuthClientFromStore.
+	Store CredentialStore
+
+	// Identity, if set, identifies whose credentials these are, like the
+	// user's ID, so that responses cached by a persistent Cache are found
+	// again after restarts. It's used as-is, and mustn't be a secret. By
+	// default, it's derived from ClientID and the refresh token the client
+	// starts with, which only survives restarts until that token is rotated.
+	Identity string
 }
 
 // DefaultRefreshBuffer is the default duration before expiry to refresh tokens
 const DefaultRefreshBuffer = 60 * time.Second
 
+// StoreRefreshTimeout bounds how long token refreshes hold the lock of
+// a CredentialUpdater, see OAuthConfig.Store
+const StoreRefreshTimeout = 15 * time.Second
+
 // NewOAuthClient creates a client using OAuth credentials and configuration.
 // The client will automatically refresh tokens when they are near expiry or
 // when a 401 response is received.
@@ -89,23 +104,8 @@ func NewOAuthClient(creds *OAuthCredentials, config OAuthConfig) *Client {
 	if config.ClientID == "" {
 		panic("itchio: NewOAuthClient called with empty ClientID")
 	}
-	if config.RefreshBuffer == 0 {
-		config.RefreshBuffer = DefaultRefreshBuffer
-	}
 
-	c := &Client{
-		HTTPClient:       timeout.NewDefaultClient(),
-		RetryPatterns:    defaultRetryPatterns(),
-		UserAgent:        "go-itchio",
-		AcceptedLanguage: "*",
-		Limiter:          DefaultRateLimiter(),
-		oauth: &oauthState{
-			creds:  creds.Copy(),
-			config: config,
-		},
-	}
-	c.SetServer("https://api.itch.io")
-	return c
+	return NewClient(WithOAuth(creds, config))
 }
 
 // expiresAtFromExpiresIn converts an expiresIn value to a time.Time.
@@ -117,77 +117,310 @@ func expiresAtFromExpiresIn(expiresIn int64) time.Time {
 	return time.Now().Add(time.Duration(expiresIn) * time.Second)
 }
 
-// tokenNeedsRefresh checks if the token needs to be refreshed
-func (c *Client) tokenNeedsRefresh() bool {
-	if c.oauth == nil {
-		return false
+// An OAuthAuthenticator is an Authenticator for OAuth credentials. It
+// refreshes the access token when it's about to expire, or when the API
+// rejects it.
+type OAuthAuthenticator struct {
+	config OAuthConfig
+
+	creds *OAuthCredentials
+	// identity stays the same across refreshes
+	identity string
+	// reauthRequired is set once the refresh token is rejected
+	reauthRequired bool
+	credsMu        sync.RWMutex
+	refreshMu      sync.Mutex
+}
+
+var _ Authenticator = (*OAuthAuthenticator)(nil)
+
+// NewOAuthAuthenticator returns an authenticator for OAuth credentials,
+// see NewOAuthClient.
+//
+// Panics if creds is nil or config.ClientID is empty.
+func NewOAuthAuthenticator(creds *OAuthCredentials, config OAuthConfig) *OAuthAuthenticator {
+	if creds == nil {
+		panic("itchio: NewOAuthAuthenticator called with nil credentials")
+	}
+	if config.ClientID == "" {
+		panic("itchio: NewOAuthAuthenticator called with empty ClientID")
+	}
+	if config.RefreshBuffer == 0 {
+		config.RefreshBuffer = DefaultRefreshBuffer
 	}
 
-	c.oauth.credsMu.RLock()
-	defer c.oauth.credsMu.RUnlock()
+	return &OAuthAuthenticator{
+		config:   config,
+		identity: oauthIdentity(config, creds),
+		creds:    creds.Copy(),
+	}
+}
 
-	if c.oauth.creds == nil {
-		return false
+// oauthIdentity returns the identity of an OAuth session
+// starting with creds, see OAuthConfig.Identity
+func oauthIdentity(config OAuthConfig, creds *OAuthCredentials) string {
+	if config.Identity != "" {
+		return "oauth:" + config.Identity
 	}
+	return hashIdentity("oauth", config.ClientID+" "+creds.RefreshToken)
+}
 
-	return c.oauth.creds.ExpiresWithin(c.oauth.config.RefreshBuffer)
+// Authenticate refreshes the access token if it's about to expire,
+// then sets it as the request's bearer token.
+func (a *OAuthAuthenticator) Authenticate(ctx context.Context, c *Client, req *http.Request) error {
+	if a.ReauthRequired() {
+		return errors.WithStack(ErrReauthRequired)
+	}
+	if err := a.refreshIfNeeded(ctx, c); err != nil {
+		return errors.Wrap(err, "failed to refresh token")
+	}
+	req.Header.Set("Authorization", "Bearer "+a.accessToken())
+	return nil
 }
 
-// refreshTokenIfNeeded refreshes the token if it's near expiry.
-// Uses double-check pattern to prevent thundering herd.
-func (c *Client) refreshTokenIfNeeded(ctx context.Context) error {
-	if c.oauth == nil {
-		return nil
+// Unauthorized refreshes the access token, which the API may
+// have revoked before it expired.
+func (a *OAuthAuthenticator) Unauthorized(ctx context.Context, c *Client, res *http.Response) (bool, error) {
+	if a.ReauthRequired() {
+		return false, errors.WithStack(ErrReauthRequired)
 	}
+	c.logger().Log(ctx, LogLevelInfo, "unauthorized, refreshing token")
+	if err := a.forceRefresh(ctx, c); err != nil {
+		return false, errors.Wrap(err, "failed to refresh token after 401")
+	}
+	return true, nil
+}
+
+// QueryCredentials refreshes the access token if it's about to expire,
+// then returns it as the api_key parameter. URLs built with it stop
+// working once it expires.
+func (a *OAuthAuthenticator) QueryCredentials(ctx context.Context, c *Client) (url.Values, error) {
+	if a.ReauthRequired() {
+		return nil, errors.WithStack(ErrReauthRequired)
+	}
+	if err := a.refreshIfNeeded(ctx, c); err != nil {
+		return nil, errors.Wrap(err, "failed to refresh token")
+	}
+	return url.Values{"api_key": []string{a.accessToken()}}, nil
+}
+
+// Identity identifies the OAuth session, see OAuthConfig.Identity.
+// It doesn't change when tokens are refreshed, only when they're
+// replaced with SetCredentials.
+func (a *OAuthAuthenticator) Identity() string {
+	a.credsMu.RLock()
+	defer a.credsMu.RUnlock()
+	return a.identity
+}
+
+// Credentials returns a copy of the current credentials
+func (a *OAuthAuthenticator) Credentials() *OAuthCredentials {
+	a.credsMu.RLock()
+	defer a.credsMu.RUnlock()
+	return a.creds.Copy()
+}
+
+// ReauthRequired returns true once the refresh token has been rejected,
+// until SetCredentials is called
+func (a *OAuthAuthenticator) ReauthRequired() bool {
+	a.credsMu.RLock()
+	defer a.credsMu.RUnlock()
+	return a.reauthRequired
+}
+
+// SetCredentials replaces the credentials, for example after users logged
+// in again, which ends the ErrReauthRequired state. They're saved to the
+// store, if there's one. It waits for refreshes in progress.
+func (a *OAuthAuthenticator) SetCredentials(creds *OAuthCredentials) error {
+	if creds == nil {
+		return errors.New("itchio: SetCredentials called with nil credentials")
+	}
+
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+
+	if a.config.Store != nil {
+		if err := a.config.Store.Save(creds); err != nil {
+			return errors.Wrap(err, "saving credentials")
+		}
+	}
+
+	a.credsMu.Lock()
+	a.creds = creds.Copy()
+	// users may have logged in with another account
+	a.identity = oauthIdentity(a.config, creds)
+	a.reauthRequired = false
+	a.credsMu.Unlock()
+	return nil
+}
+
+func (a *OAuthAuthenticator) accessToken() string {
+	a.credsMu.RLock()
+	defer a.credsMu.RUnlock()
+	return a.creds.AccessToken
+}
+
+// tokenNeedsRefresh checks if the token needs to be refreshed
+func (a *OAuthAuthenticator) tokenNeedsRefresh() bool {
+	a.credsMu.RLock()
+	defer a.credsMu.RUnlock()
+
+	return a.creds.ExpiresWithin(a.config.RefreshBuffer)
+}
 
+// refreshIfNeeded refreshes the token if it's near expiry.
+// Uses double-check pattern to prevent thundering herd.
+func (a *OAuthAuthenticator) refreshIfNeeded(ctx context.Context, c *Client) error {
 	// Quick check without lock
-	if !c.tokenNeedsRefresh() {
+	if !a.tokenNeedsRefresh() {
 		return nil
 	}
+	return a.lockedRefresh(ctx, c, a.tokenNeedsRefresh)
+}
+
+// forceRefresh forces a token refresh regardless of expiry.
+// Used for reactive refresh on 401 responses.
+func (a *OAuthAuthenticator) forceRefresh(ctx context.Context, c *Client) error {
+	return a.lockedRefresh(ctx, c, nil)
+}
 
-	// Acquire refresh lock - only one goroutine refreshes at a time
-	c.oauth.refreshMu.Lock()
-	defer c.oauth.refreshMu.Unlock()
+// lockedRefresh refreshes the token with refreshMu held, so only one
+// goroutine refreshes at a time, if needsRefresh still returns true once
+// it's held (nil forces a refresh). If the refresh token is rejected, it
+// switches to the ErrReauthRequired state, and calls OnReauthRequired.
+func (a *OAuthAuthenticator) lockedRefresh(ctx context.Context, c *Client, needsRefresh func() bool) error {
+	a.refreshMu.Lock()
+	ended, err := a.refreshLocked(ctx, c, needsRefresh)
+	a.refreshMu.Unlock()
+
+	// outside of the lock, so the callback can call SetCredentials
+	if ended && a.config.OnReauthRequired != nil {
+		a.config.OnReauthRequired(err)
+	}
+	return err
+}
 
+// refreshLocked returns whether the refresh ended the session, and the
+// refresh error, if any. Must be called with refreshMu held.
+func (a *OAuthAuthenticator) refreshLocked(ctx context.Context, c *Client, needsRefresh func() bool) (bool, error) {
+	// another goroutine may have found out the session was over
+	if a.ReauthRequired() {
+		return false, errors.WithStack(ErrReauthRequired)
+	}
 	// Re-check after acquiring lock (another goroutine may have refreshed)
-	if !c.tokenNeedsRefresh() {
-		return nil
+	if needsRefresh != nil && !needsRefresh() {
+		return false, nil
 	}
 
-	return c.doTokenRefresh(ctx)
+	err := a.doRefresh(ctx, c)
+	if err == nil || !isRefreshTokenRejected(err) {
+		return false, err
+	}
+
+	a.credsMu.Lock()
+	a.reauthRequired = true
+	a.credsMu.Unlock()
+	c.logger().Log(ctx, LogLevelWarn, "oauth refresh token rejected, users need to log in again", "error", err)
+	return true, &reauthRequiredError{err: err}
 }
 
-// forceTokenRefresh forces a token refresh regardless of expiry.
-// Used for reactive refresh on 401 responses.
-func (c *Client) forceTokenRefresh(ctx context.Context) error {
-	if c.oauth == nil {
+// isRefreshTokenRejected returns true if a refresh failed because
+// the refresh token has expired or was revoked, as opposed to
+// network errors, outages, etc.
+func isRefreshTokenRejected(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	if !ok || apiErr.StatusCode < 400 || apiErr.StatusCode >= 500 {
+		return false
+	}
+	for _, message := range apiErr.Messages {
+		if message == "invalid_grant" {
+			return true
+		}
+	}
+	return false
+}
+
+// doRefresh refreshes the token, or picks up credentials another process
+// sharing the store has refreshed. Must be called with refreshMu held.
+func (a *OAuthAuthenticator) doRefresh(ctx context.Context, c *Client) error {
+	store := a.config.Store
+	if store == nil {
+		newCreds, err := a.refresh(ctx, c)
+		if err != nil {
+			return err
+		}
+		a.notifyRefresh(ctx, c, newCreds)
 		return nil
 	}
 
-	c.oauth.refreshMu.Lock()
-	defer c.oauth.refreshMu.Unlock()
+	logger := c.logger()
+	var refreshed *OAuthCredentials
+	err := updateStoredCredentials(store, func(stored *OAuthCredentials) (*OAuthCredentials, error) {
+		// other processes may be waiting for the store's lock
+		ctx, cancel := context.WithTimeout(ctx, StoreRefreshTimeout)
+		defer cancel()
+
+		if stored != nil && stored.RefreshToken != a.Credentials().RefreshToken {
+			// another process has refreshed since we last did: our
+			// refresh token has been rotated, theirs is the valid one.
+			a.setCredentials(stored)
+			if !stored.ExpiresWithin(a.config.RefreshBuffer) {
+				logger.Log(ctx, LogLevelInfo, "using oauth token refreshed by another process", "expiresAt", stored.ExpiresAt)
+				return nil, nil
+			}
+		}
 
-	return c.doTokenRefresh(ctx)
+		newCreds, err := a.refresh(ctx, c, CallNoRetry())
+		if err != nil {
+			return nil, err
+		}
+		refreshed = newCreds
+		return newCreds, nil
+	})
+	if refreshed == nil {
+		return err
+	}
+	if err != nil {
+		// the credentials are still good for this process, they'll just
+		// have to be refreshed again after a restart
+		logger.Log(ctx, LogLevelWarn, "failed to save refreshed oauth credentials", "error", err)
+	}
+
+	a.notifyRefresh(ctx, c, refreshed)
+	return nil
+}
+
+// setCredentials replaces the current credentials
+func (a *OAuthAuthenticator) setCredentials(creds *OAuthCredentials) {
+	a.credsMu.Lock()
+	a.creds = creds.Copy()
+	a.credsMu.Unlock()
 }
 
-// doTokenRefresh performs the actual token refresh.
-// Must be called with refreshMu held.
-func (c *Client) doTokenRefresh(ctx context.Context) error {
-	c.oauth.credsMu.RLock()
-	refreshToken := c.oauth.creds.RefreshToken
-	c.oauth.credsMu.RUnlock()
+// refresh exchanges the refresh token for new credentials, which it
+// returns. Must be called with refreshMu held.
+func (a *OAuthAuthenticator) refresh(ctx context.Context, c *Client, opts ...CallOption) (*OAuthCredentials, error) {
+	a.credsMu.RLock()
+	refreshToken := a.creds.RefreshToken
+	a.credsMu.RUnlock()
+
+	// The refresh request itself is made anonymously (the refresh token
+	// is in its body). This prevents deadlock (we're holding refreshMu)
+	// and ensures the refresh endpoint doesn't use the expired bearer token.
+	// It also doesn't count towards the response metadata of the request
+	// that triggered the refresh.
+	refreshCtx := withAuthenticator(withoutResponseMeta(ctx), Anonymous)
 
-	// Use a context that skips OAuth refresh logic for the refresh request itself.
-	// This prevents deadlock (we're holding refreshMu) and ensures the refresh
-	// endpoint doesn't use the expired bearer token.
-	refreshCtx := context.WithValue(ctx, skipOAuthRefreshKey, true)
+	logger := c.logger()
+	logger.Log(ctx, LogLevelInfo, "refreshing oauth token")
 
 	resp, err := c.RefreshOAuthToken(refreshCtx, RefreshOAuthTokenParams{
 		RefreshToken: refreshToken,
-		ClientID:     c.oauth.config.ClientID,
-	})
+		ClientID:     a.config.ClientID,
+	}, opts...)
 	if err != nil {
-		return err
+		logger.Log(ctx, LogLevelWarn, "oauth token refresh failed", "error", err)
+		return nil, err
 	}
 
 	newRefreshToken := resp.RefreshToken
@@ -202,38 +435,45 @@ func (c *Client) doTokenRefresh(ctx context.Context) error {
 	}
 
 	// Update internal state
-	c.oauth.credsMu.Lock()
-	c.oauth.creds = newCreds
-	c.oauth.credsMu.Unlock()
-
-	// Notify callback (errors logged, not propagated)
-	if c.oauth.config.OnRefresh != nil {
-		if err := c.oauth.config.OnRefresh(newCreds.Copy()); err != nil {
-			log.Printf("go-itchio: token refresh callback error: %v", err)
-		}
-	}
+	a.setCredentials(newCreds)
 
-	return nil
+	logger.Log(ctx, LogLevelInfo, "oauth token refreshed", "expiresAt", newCreds.ExpiresAt)
+	return newCreds, nil
 }
 
-// getAuthHeader returns the appropriate Authorization header value
-func (c *Client) getAuthHeader() string {
-	if c.oauth != nil {
-		c.oauth.credsMu.RLock()
-		defer c.oauth.credsMu.RUnlock()
-		if c.oauth.creds != nil {
-			return "Bearer " + c.oauth.creds.AccessToken
-		}
+// notifyRefresh calls the OnRefresh callback (errors logged, not propagated)
+func (a *OAuthAuthenticator) notifyRefresh(ctx context.Context, c *Client, creds *OAuthCredentials) {
+	if a.config.OnRefresh == nil {
+		return
+	}
+	if err := a.config.OnRefresh(creds.Copy()); err != nil {
+		c.logger().Log(ctx, LogLevelWarn, "token refresh callback error", "error", err)
 	}
-	return c.Key
 }
 
-// isOAuthClient returns true if this client uses OAuth authentication
-func (c *Client) isOAuthClient() bool {
-	return c.oauth != nil
+// oauthAuthenticator returns the client's OAuth authenticator,
+// or nil if it doesn't use one
+func (c *Client) oauthAuthenticator() *OAuthAuthenticator {
+	a, _ := c.Auth.(*OAuthAuthenticator)
+	return a
 }
 
-// shouldSkipOAuthRefresh returns true if the context indicates we're in a refresh operation
-func shouldSkipOAuthRefresh(ctx context.Context) bool {
-	return ctx.Value(skipOAuthRefreshKey) != nil
+// SetOAuthCredentials replaces the credentials of an OAuth client, and of
+// the clients derived from it with With. Use it when users log in again
+// after ErrReauthRequired, to resume normal operation.
+func (c *Client) SetOAuthCredentials(creds *OAuthCredentials) error {
+	a := c.oauthAuthenticator()
+	if a == nil {
+		return errors.New("itchio: SetOAuthCredentials called on a client that doesn't use OAuth")
+	}
+	return a.SetCredentials(creds)
+}
+
+// refreshTokenIfNeeded refreshes the client's OAuth token if it's near
+// expiry. It does nothing for clients that don't use OAuth.
+func (c *Client) refreshTokenIfNeeded(ctx context.Context) error {
+	if a := c.oauthAuthenticator(); a != nil {
+		return a.refreshIfNeeded(ctx, c)
+	}
+	return nil
 }
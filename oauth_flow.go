@@ -0,0 +1,296 @@
+package itchio
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultAuthorizeURL is the page users grant OAuth applications access on
+const DefaultAuthorizeURL = "https://itch.io/user/oauth"
+
+// DefaultOAuthFlowTimeout is how long an OAuthFlow waits for the user
+// to grant access, unless told otherwise
+const DefaultOAuthFlowTimeout = 5 * time.Minute
+
+const defaultSuccessPage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Logged in</title></head>
+<body><p>You're logged in! You can close this window.</p></body></html>`
+
+// An OAuthFlow logs users in with the OAuth authorization code flow, with
+// PKCE: users grant access in their browser, which gets redirected to a
+// loopback server, and the code it receives is exchanged for credentials.
+//
+//	flow := &itchio.OAuthFlow{ClientID: "my-app", Scopes: []string{"profile:me"}}
+//	session, err := flow.Start()
+//	// ...
+//	defer session.Close()
+//	openBrowser(session.URL())
+//	creds, err := session.Wait(ctx, itchio.ClientWithKey(""))
+type OAuthFlow struct {
+	// ClientID of the OAuth application
+	ClientID string
+	// Scopes to request, like "profile:me"
+	Scopes []string
+
+	// AuthorizeURL is the page users grant access on.
+	// Defaults to DefaultAuthorizeURL.
+	AuthorizeURL string
+	// RedirectPath is the path the loopback server expects the
+	// redirect on. Defaults to "/oauth/callback".
+	RedirectPath string
+
+	// Timeout bounds how long Wait waits for the user to grant access.
+	// Defaults to DefaultOAuthFlowTimeout.
+	Timeout time.Duration
+
+	// SuccessPage is the HTML page the browser shows once the user is
+	// logged in. Defaults to a short note saying the window can be closed.
+	SuccessPage string
+	// ErrorPage returns the HTML page the browser shows when logging
+	// in fails. Defaults to a page with the error message.
+	ErrorPage func(err error) string
+}
+
+// An OAuthError is returned by OAuthSession.Wait when the authorization
+// server redirects with an error, for example when users deny access.
+type OAuthError struct {
+	// Code is the error code, like "access_denied"
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oauth: %s: %s", e.Code, e.Description)
+	}
+	return fmt.Sprintf("oauth: %s", e.Code)
+}
+
+// An OAuthSession is a login in progress, see OAuthFlow.Start
+type OAuthSession struct {
+	flow         *OAuthFlow
+	state        string
+	codeVerifier string
+	redirectURI  string
+	authorizeURL string
+
+	server    *http.Server
+	callbacks chan *oauthCallback
+	closeOnce sync.Once
+}
+
+// oauthCallback is a redirect caught by the loopback server,
+// waiting for the outcome of the exchange
+type oauthCallback struct {
+	code   string
+	err    error
+	result chan error
+}
+
+// Start generates a PKCE verifier and state, and starts a loopback server
+// on an ephemeral port to catch the redirect. The session must be closed.
+func (f *OAuthFlow) Start() (*OAuthSession, error) {
+	if f.ClientID == "" {
+		return nil, errors.New("itchio: OAuthFlow needs a ClientID")
+	}
+
+	authorizeURL := f.AuthorizeURL
+	if authorizeURL == "" {
+		authorizeURL = DefaultAuthorizeURL
+	}
+	redirectPath := f.RedirectPath
+	if redirectPath == "" {
+		redirectPath = "/oauth/callback"
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	codeVerifier, codeChallenge := newPKCEPair()
+	s := &OAuthSession{
+		flow:         f,
+		state:        randomHex(16),
+		codeVerifier: codeVerifier,
+		redirectURI:  fmt.Sprintf("http://%s%s", listener.Addr().String(), redirectPath),
+		callbacks:    make(chan *oauthCallback),
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", f.ClientID)
+	params.Set("redirect_uri", s.redirectURI)
+	params.Set("state", s.state)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+	if len(f.Scopes) > 0 {
+		params.Set("scope", strings.Join(f.Scopes, " "))
+	}
+	sep := "?"
+	if strings.Contains(authorizeURL, "?") {
+		sep = "&"
+	}
+	s.authorizeURL = authorizeURL + sep + params.Encode()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(redirectPath, s.handleRedirect)
+	s.server = &http.Server{Handler: mux}
+	go s.server.Serve(listener)
+
+	return s, nil
+}
+
+// newPKCEPair returns a random code verifier, and its S256 challenge
+func newPKCEPair() (string, string) {
+	// 64 hex characters, well within the 43 to 128 characters RFC 7636 allows
+	verifier := randomHex(32)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// URL returns the authorization page users should be sent to,
+// typically by opening it in their browser
+func (s *OAuthSession) URL() string {
+	return s.authorizeURL
+}
+
+// RedirectURI returns the URL of the loopback server
+func (s *OAuthSession) RedirectURI() string {
+	return s.redirectURI
+}
+
+// Wait waits for the browser to be redirected to the loopback server, then
+// exchanges the code it got with c. It gives up after the flow's Timeout,
+// or when ctx is done.
+func (s *OAuthSession) Wait(ctx context.Context, c *Client) (*OAuthCredentials, error) {
+	timeout := s.flow.Timeout
+	if timeout <= 0 {
+		timeout = DefaultOAuthFlowTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var cb *oauthCallback
+	select {
+	case cb = <-s.callbacks:
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "waiting for OAuth redirect")
+	}
+
+	creds, err := s.exchange(ctx, c, cb)
+	// let the browser know how it went
+	cb.result <- err
+	return creds, err
+}
+
+func (s *OAuthSession) exchange(ctx context.Context, c *Client, cb *oauthCallback) (*OAuthCredentials, error) {
+	if cb.err != nil {
+		return nil, cb.err
+	}
+
+	res, err := c.ExchangeOAuthCode(withAuthenticator(ctx, Anonymous), ExchangeOAuthCodeParams{
+		Code:         cb.code,
+		CodeVerifier: s.codeVerifier,
+		RedirectURI:  s.redirectURI,
+		ClientID:     s.flow.ClientID,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "exchanging OAuth code")
+	}
+	creds := res.OAuthCredentials()
+	if creds == nil {
+		return nil, errors.New("itchio: OAuth exchange returned no access token")
+	}
+	return creds, nil
+}
+
+// handleRedirect catches the redirect from the authorization page
+func (s *OAuthSession) handleRedirect(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("state") != s.state {
+		// not the redirect we're waiting for, maybe a forged one:
+		// ignore it, and keep waiting.
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+
+	cb := &oauthCallback{code: query.Get("code"), result: make(chan error, 1)}
+	if code := query.Get("error"); code != "" {
+		cb.err = &OAuthError{Code: code, Description: query.Get("error_description")}
+	} else if cb.code == "" {
+		cb.err = errors.New("itchio: OAuth redirect without a code")
+	}
+
+	select {
+	case s.callbacks <- cb:
+	case <-r.Context().Done():
+		return
+	}
+
+	var err error
+	select {
+	case err = <-cb.result:
+	case <-r.Context().Done():
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, s.errorPage(err))
+		return
+	}
+	successPage := s.flow.SuccessPage
+	if successPage == "" {
+		successPage = defaultSuccessPage
+	}
+	fmt.Fprint(w, successPage)
+}
+
+func (s *OAuthSession) errorPage(err error) string {
+	if s.flow.ErrorPage != nil {
+		return s.flow.ErrorPage(err)
+	}
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Login failed</title></head>
+<body><p>Login failed: %s</p></body></html>`, html.EscapeString(err.Error()))
+}
+
+// Close stops the loopback server
+func (s *OAuthSession) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err = s.server.Shutdown(ctx)
+	})
+	return errors.WithStack(err)
+}
+
+// Run logs a user in: it starts a session, passes its URL to open (which
+// typically opens it in a browser, and shouldn't wait for the page to load),
+// then waits for the redirect, and exchanges the code with c.
+func (f *OAuthFlow) Run(ctx context.Context, c *Client, open func(url string) error) (*OAuthCredentials, error) {
+	s, err := f.Start()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	if err := open(s.URL()); err != nil {
+		return nil, errors.Wrap(err, "opening authorization page")
+	}
+	return s.Wait(ctx, c)
+}
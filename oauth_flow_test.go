@@ -0,0 +1,131 @@
+package itchio
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// visit makes the request a browser would, and returns the
+// status and page it got
+func visit(t *testing.T, u string) (int, string) {
+	res, err := http.Get(u)
+	if !assert.NoError(t, err) {
+		return 0, ""
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	return res.StatusCode, string(body)
+}
+
+func TestOAuthFlowExchange(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		form = r.PostForm
+		_, _ = w.Write([]byte(`{"access_token":"access","refresh_token":"refresh","expires_in":3600}`))
+	}))
+	defer server.Close()
+
+	flow := &OAuthFlow{
+		ClientID:     "client",
+		Scopes:       []string{"profile:me", "profile:games"},
+		AuthorizeURL: "https://example.com/authorize?lang=fr",
+		SuccessPage:  "<p>welcome</p>",
+	}
+	session, err := flow.Start()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer session.Close()
+
+	authorizeURL, err := url.Parse(session.URL())
+	assert.NoError(t, err)
+	query := authorizeURL.Query()
+	assert.Equal(t, "fr", query.Get("lang"))
+	assert.Equal(t, "client", query.Get("client_id"))
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, "profile:me profile:games", query.Get("scope"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, session.RedirectURI(), query.Get("redirect_uri"))
+	assert.Contains(t, session.RedirectURI(), "http://127.0.0.1:")
+
+	pages := make(chan string, 1)
+	go func() {
+		status, _ := visit(t, session.RedirectURI()+"?code=forged&state=wrong")
+		assert.Equal(t, http.StatusBadRequest, status, "redirects with the wrong state are rejected")
+
+		_, page := visit(t, session.RedirectURI()+"?code=good&state="+query.Get("state"))
+		pages <- page
+	}()
+
+	creds, err := session.Wait(context.Background(), newTestKeyClient(server))
+	assert.NoError(t, err)
+	if assert.NotNil(t, creds) {
+		assert.Equal(t, "access", creds.AccessToken)
+		assert.Equal(t, "refresh", creds.RefreshToken)
+	}
+	assert.Equal(t, "<p>welcome</p>", <-pages)
+
+	assert.Equal(t, "good", form.Get("code"))
+	assert.Equal(t, session.RedirectURI(), form.Get("redirect_uri"))
+	assert.NotEmpty(t, form.Get("code_verifier"))
+	assert.NotEqual(t, query.Get("code_challenge"), form.Get("code_verifier"))
+}
+
+func TestOAuthFlowDenied(t *testing.T) {
+	flow := &OAuthFlow{
+		ClientID:  "client",
+		ErrorPage: func(err error) string { return "failed: " + err.Error() },
+	}
+	session, err := flow.Start()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer session.Close()
+
+	state := func() string {
+		u, _ := url.Parse(session.URL())
+		return u.Query().Get("state")
+	}()
+
+	pages := make(chan string, 1)
+	go func() {
+		_, page := visit(t, session.RedirectURI()+"?error=access_denied&state="+state)
+		pages <- page
+	}()
+
+	_, err = session.Wait(context.Background(), ClientWithKey(""))
+	var oerr *OAuthError
+	if assert.True(t, errors.As(err, &oerr)) {
+		assert.Equal(t, "access_denied", oerr.Code)
+	}
+	assert.Equal(t, "failed: oauth: access_denied", <-pages)
+}
+
+func TestOAuthFlowTimeout(t *testing.T) {
+	flow := &OAuthFlow{ClientID: "client", Timeout: 10 * time.Millisecond}
+	session, err := flow.Start()
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = session.Wait(context.Background(), ClientWithKey(""))
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.NoError(t, session.Close())
+
+	_, err = http.Get(session.RedirectURI())
+	assert.Error(t, err, "the loopback server is stopped")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = flow.Run(ctx, ClientWithKey(""), func(string) error { return nil })
+	assert.True(t, errors.Is(err, context.Canceled))
+}
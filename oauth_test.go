@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -58,12 +59,12 @@ func TestRefreshRetainsRefreshTokenWhenOmitted(t *testing.T) {
 	assert.NoError(t, err)
 	assert.EqualValues(t, 1, atomic.LoadInt32(&refreshCalls))
 
-	client.oauth.credsMu.RLock()
-	defer client.oauth.credsMu.RUnlock()
-	assert.Equal(t, "new-access", client.oauth.creds.AccessToken)
+	client.oauthAuthenticator().credsMu.RLock()
+	defer client.oauthAuthenticator().credsMu.RUnlock()
+	assert.Equal(t, "new-access", client.oauthAuthenticator().creds.AccessToken)
 	// Should retain previous refresh token when server omits it
-	assert.Equal(t, "old-refresh", client.oauth.creds.RefreshToken)
-	assert.False(t, client.oauth.creds.ExpiresAt.IsZero())
+	assert.Equal(t, "old-refresh", client.oauthAuthenticator().creds.RefreshToken)
+	assert.False(t, client.oauthAuthenticator().creds.ExpiresAt.IsZero())
 }
 
 func TestNonPositiveExpiryDoesNotTriggerRefresh(t *testing.T) {
@@ -116,11 +117,11 @@ func TestProactiveRefreshWithinBuffer(t *testing.T) {
 	assert.NoError(t, err)
 	assert.EqualValues(t, 1, atomic.LoadInt32(&refreshCalls))
 
-	client.oauth.credsMu.RLock()
-	defer client.oauth.credsMu.RUnlock()
-	assert.Equal(t, "refreshed", client.oauth.creds.AccessToken)
-	assert.Equal(t, "rotated", client.oauth.creds.RefreshToken)
-	assert.False(t, client.oauth.creds.ExpiresAt.IsZero())
+	client.oauthAuthenticator().credsMu.RLock()
+	defer client.oauthAuthenticator().credsMu.RUnlock()
+	assert.Equal(t, "refreshed", client.oauthAuthenticator().creds.AccessToken)
+	assert.Equal(t, "rotated", client.oauthAuthenticator().creds.RefreshToken)
+	assert.False(t, client.oauthAuthenticator().creds.ExpiresAt.IsZero())
 }
 
 func TestRetryOn401WithTokenRefresh(t *testing.T) {
@@ -180,10 +181,10 @@ func TestRetryOn401WithTokenRefresh(t *testing.T) {
 	assert.Equal(t, "Bearer refreshed-token", authHeaders[1])
 
 	// Verify credentials were updated
-	client.oauth.credsMu.RLock()
-	defer client.oauth.credsMu.RUnlock()
-	assert.Equal(t, "refreshed-token", client.oauth.creds.AccessToken)
-	assert.Equal(t, "new-refresh", client.oauth.creds.RefreshToken)
+	client.oauthAuthenticator().credsMu.RLock()
+	defer client.oauthAuthenticator().credsMu.RUnlock()
+	assert.Equal(t, "refreshed-token", client.oauthAuthenticator().creds.AccessToken)
+	assert.Equal(t, "new-refresh", client.oauthAuthenticator().creds.RefreshToken)
 }
 
 func TestRetryOn401WithPOSTBody(t *testing.T) {
@@ -283,3 +284,97 @@ func TestNo401RetryLoopOnPersistentFailure(t *testing.T) {
 	assert.EqualValues(t, 2, atomic.LoadInt32(&apiCalls), "expected exactly 2 API calls")
 	assert.EqualValues(t, 1, atomic.LoadInt32(&refreshCalls), "expected exactly 1 refresh attempt")
 }
+
+func TestReauthRequired(t *testing.T) {
+	var refreshCalls int32
+	var status int32 = http.StatusBadRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth/token" {
+			atomic.AddInt32(&refreshCalls, 1)
+			w.WriteHeader(int(atomic.LoadInt32(&status)))
+			_, _ = w.Write([]byte(`{"errors":["invalid_grant"]}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer new-access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"user":{"id":1}}`))
+	}))
+	defer server.Close()
+
+	var reauthCalls int32
+	var reauthErr error
+	expired := &OAuthCredentials{
+		AccessToken:  "old-access",
+		RefreshToken: "revoked-refresh",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	}
+	client := newTestOAuthClient(t, server, expired, OAuthConfig{
+		ClientID: "client",
+		OnReauthRequired: func(err error) {
+			atomic.AddInt32(&reauthCalls, 1)
+			reauthErr = err
+		},
+	})
+	client.RetryPolicy = NoRetry
+	ctx := context.Background()
+
+	// outages aren't mistaken for a lost session
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	_, err := client.GetProfile(ctx)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrReauthRequired))
+	assert.False(t, client.oauthAuthenticator().ReauthRequired())
+
+	atomic.StoreInt32(&status, http.StatusBadRequest)
+	atomic.StoreInt32(&refreshCalls, 0)
+	concurrently(4, func(i int) {
+		_, err := client.GetProfile(ctx)
+		assert.True(t, errors.Is(err, ErrReauthRequired), "got %v", err)
+	})
+	_, err = client.GetProfile(ctx)
+	assert.True(t, errors.Is(err, ErrReauthRequired))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&refreshCalls), "calls fail fast once the session is over")
+	assert.EqualValues(t, 1, atomic.LoadInt32(&reauthCalls))
+	assert.True(t, errors.Is(reauthErr, ErrReauthRequired))
+	assert.Contains(t, reauthErr.Error(), "invalid_grant")
+
+	assert.NoError(t, client.SetOAuthCredentials(&OAuthCredentials{
+		AccessToken:  "new-access",
+		RefreshToken: "new-refresh",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}))
+	_, err = client.GetProfile(ctx)
+	assert.NoError(t, err, "logging in again resumes normal operation")
+
+	assert.Error(t, ClientWithKey("key").SetOAuthCredentials(expired))
+}
+
+func TestOAuthQueryCredentialsRefresh(t *testing.T) {
+	var refreshCalls int32
+	server := newTokenServer(&refreshCalls, 0)
+	defer server.Close()
+
+	client := newTestOAuthClient(t, server, &OAuthCredentials{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(30 * time.Second),
+	}, OAuthConfig{ClientID: "client"})
+
+	downloadURL, err := client.MakeUploadDownloadURLContext(context.Background(), MakeUploadDownloadURLParams{UploadID: 3})
+	assert.NoError(t, err)
+	assert.Contains(t, downloadURL, "api_key=access-1", "tokens about to expire are refreshed first")
+	assert.EqualValues(t, 1, atomic.LoadInt32(&refreshCalls))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client.oauthAuthenticator().setCredentials(&OAuthCredentials{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(30 * time.Second),
+	})
+	_, err = client.MakeBuildFileDownloadURLContext(ctx, MakeBuildFileDownloadURLParams{BuildID: 1, FileID: 2})
+	assert.Error(t, err, "the caller's context is used for refreshing")
+}
@@ -0,0 +1,231 @@
+package itchio
+
+import "context"
+
+// pageFetcher fetches a single page of results. perPage is
+// what the server reports, or 0 if it doesn't say.
+type pageFetcher func(ctx context.Context, page int64) (items []interface{}, perPage int64, err error)
+
+type pageResult struct {
+	page    int64
+	items   []interface{}
+	perPage int64
+	err     error
+}
+
+// pager iterates over the results of a page-based endpoint. Pages are
+// fetched lazily, and the next page is fetched while the current one is
+// being consumed. Requests go through the client, so they respect its Limiter.
+//
+// Iteration stops on the first error, on an empty page, or on a page with
+// fewer items than the server's page size (a short page).
+type pager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	fetch  pageFetcher
+
+	startPage int64
+	page      int64
+	items     []interface{}
+	index     int
+
+	pending  chan pageResult
+	started  bool
+	finished bool
+	err      error
+}
+
+func newPager(ctx context.Context, startPage int64, fetch pageFetcher) *pager {
+	if startPage < 1 {
+		startPage = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &pager{
+		ctx:       ctx,
+		cancel:    cancel,
+		fetch:     fetch,
+		startPage: startPage,
+		index:     -1,
+	}
+}
+
+func (p *pager) request(page int64) {
+	pending := make(chan pageResult, 1)
+	go func() {
+		items, perPage, err := p.fetch(p.ctx, page)
+		pending <- pageResult{page: page, items: items, perPage: perPage, err: err}
+	}()
+	p.pending = pending
+}
+
+func (p *pager) next() bool {
+	for {
+		if p.index+1 < len(p.items) {
+			p.index++
+			return true
+		}
+		if p.err != nil || p.finished {
+			return false
+		}
+
+		if !p.started {
+			p.started = true
+			p.request(p.startPage)
+		}
+		res := <-p.pending
+		p.pending = nil
+		if res.err != nil {
+			p.err = res.err
+			p.close()
+			return false
+		}
+
+		p.page = res.page
+		p.items = res.items
+		p.index = -1
+		if len(res.items) == 0 || res.perPage > 0 && int64(len(res.items)) < res.perPage {
+			p.finished = true
+			p.cancel()
+		} else {
+			// prefetch while the caller consumes this page
+			p.request(res.page + 1)
+		}
+	}
+}
+
+func (p *pager) value() interface{} {
+	if p.index < 0 || p.index >= len(p.items) {
+		return nil
+	}
+	return p.items[p.index]
+}
+
+func (p *pager) close() {
+	p.finished = true
+	p.items = nil
+	p.cancel()
+}
+
+//-------------------------------------------------------
+
+// A DownloadKeyPager iterates over download keys, fetching pages as needed:
+//
+//	keys := client.AllOwnedKeys(ctx, itchio.ListProfileOwnedKeysParams{})
+//	defer keys.Close()
+//	for keys.Next() {
+//		log.Printf("owns %d", keys.Value().GameID)
+//	}
+//	if err := keys.Err(); err != nil {
+//		// ...
+//	}
+//
+// It isn't safe for concurrent use.
+type DownloadKeyPager struct {
+	p *pager
+}
+
+// Next advances to the next key, fetching a page if needed. It returns
+// false when there are no more keys, or when a page couldn't be fetched.
+func (kp *DownloadKeyPager) Next() bool { return kp.p.next() }
+
+// Value returns the current key
+func (kp *DownloadKeyPager) Value() *DownloadKey {
+	v, _ := kp.p.value().(*DownloadKey)
+	return v
+}
+
+// Page returns the page the current key is on
+func (kp *DownloadKeyPager) Page() int64 { return kp.p.page }
+
+// Err returns the error that stopped iteration, if any
+func (kp *DownloadKeyPager) Err() error { return kp.p.err }
+
+// Close stops iteration, and cancels any page being prefetched
+func (kp *DownloadKeyPager) Close() { kp.p.close() }
+
+//-------------------------------------------------------
+
+// A CollectionGamePager iterates over the games of a collection,
+// fetching pages as needed. See DownloadKeyPager for usage.
+//
+// It isn't safe for concurrent use.
+type CollectionGamePager struct {
+	p *pager
+}
+
+// Next advances to the next collection game, fetching a page if needed. It
+// returns false when there are no more games, or when a page couldn't be fetched.
+func (cp *CollectionGamePager) Next() bool { return cp.p.next() }
+
+// Value returns the current collection game
+func (cp *CollectionGamePager) Value() *CollectionGame {
+	v, _ := cp.p.value().(*CollectionGame)
+	return v
+}
+
+// Page returns the page the current collection game is on
+func (cp *CollectionGamePager) Page() int64 { return cp.p.page }
+
+// Err returns the error that stopped iteration, if any
+func (cp *CollectionGamePager) Err() error { return cp.p.err }
+
+// Close stops iteration, and cancels any page being prefetched
+func (cp *CollectionGamePager) Close() { cp.p.close() }
+
+//-------------------------------------------------------
+
+// A GamePager iterates over games, fetching pages as needed.
+// See DownloadKeyPager for usage.
+//
+// It isn't safe for concurrent use.
+type GamePager struct {
+	p *pager
+}
+
+// Next advances to the next game, fetching a page if needed. It returns
+// false when there are no more games, or when a page couldn't be fetched.
+func (gp *GamePager) Next() bool { return gp.p.next() }
+
+// Value returns the current game
+func (gp *GamePager) Value() *Game {
+	v, _ := gp.p.value().(*Game)
+	return v
+}
+
+// Page returns the page the current game is on
+func (gp *GamePager) Page() int64 { return gp.p.page }
+
+// Err returns the error that stopped iteration, if any
+func (gp *GamePager) Err() error { return gp.p.err }
+
+// Close stops iteration, and cancels any page being prefetched
+func (gp *GamePager) Close() { gp.p.close() }
+
+//-------------------------------------------------------
+
+// A UserPager iterates over users, fetching pages as needed.
+// See DownloadKeyPager for usage.
+//
+// It isn't safe for concurrent use.
+type UserPager struct {
+	p *pager
+}
+
+// Next advances to the next user, fetching a page if needed. It returns
+// false when there are no more users, or when a page couldn't be fetched.
+func (up *UserPager) Next() bool { return up.p.next() }
+
+// Value returns the current user
+func (up *UserPager) Value() *User {
+	v, _ := up.p.value().(*User)
+	return v
+}
+
+// Page returns the page the current user is on
+func (up *UserPager) Page() int64 { return up.p.page }
+
+// Err returns the error that stopped iteration, if any
+func (up *UserPager) Err() error { return up.p.err }
+
+// Close stops iteration, and cancels any page being prefetched
+func (up *UserPager) Close() { up.p.close() }
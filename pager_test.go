@@ -0,0 +1,178 @@
+package itchio
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// newPagedServer serves total owned keys (with IDs 1 to total), perPage at a
+// time, and counts requests. Pages listed in failing respond with a 500.
+func newPagedServer(total int, perPage int, requests *int32, failing ...int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		for _, f := range failing {
+			if f == page {
+				w.WriteHeader(500)
+				_, _ = w.Write([]byte(`{"errors":["oh no"]}`))
+				return
+			}
+		}
+
+		var keys []string
+		for id := (page-1)*perPage + 1; id <= page*perPage && id <= total; id++ {
+			keys = append(keys, fmt.Sprintf(`{"id":%d,"game_id":%d}`, id, id*10))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"page":%d,"per_page":%d,"owned_keys":[%s]}`, page, perPage, strings.Join(keys, ","))
+	}))
+}
+
+func collectKeys(kp *DownloadKeyPager) []int64 {
+	var ids []int64
+	for kp.Next() {
+		ids = append(ids, kp.Value().ID)
+	}
+	return ids
+}
+
+func TestPagerStopsOnShortPages(t *testing.T) {
+	var requests int32
+	server := newPagedServer(5, 2, &requests)
+	defer server.Close()
+	client := newTestKeyClient(server)
+
+	keys := client.AllOwnedKeys(context.Background(), ListProfileOwnedKeysParams{})
+	time.Sleep(20 * time.Millisecond)
+	assert.EqualValues(t, 0, atomic.LoadInt32(&requests), "pages are fetched lazily")
+
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, collectKeys(keys))
+	assert.NoError(t, keys.Err())
+	assert.EqualValues(t, 3, atomic.LoadInt32(&requests), "the third page is short, so there's no fourth request")
+	assert.False(t, keys.Next())
+}
+
+func TestPagerStopsOnEmptyPages(t *testing.T) {
+	var requests int32
+	server := newPagedServer(4, 2, &requests)
+	defer server.Close()
+	client := newTestKeyClient(server)
+
+	keys := client.AllOwnedKeys(context.Background(), ListProfileOwnedKeysParams{})
+	assert.Equal(t, []int64{1, 2, 3, 4}, collectKeys(keys))
+	assert.NoError(t, keys.Err())
+	assert.EqualValues(t, 3, atomic.LoadInt32(&requests))
+}
+
+func TestPagerStartPage(t *testing.T) {
+	var requests int32
+	server := newPagedServer(5, 2, &requests)
+	defer server.Close()
+	client := newTestKeyClient(server)
+
+	keys := client.AllOwnedKeys(context.Background(), ListProfileOwnedKeysParams{Page: 2})
+	assert.True(t, keys.Next())
+	assert.EqualValues(t, 2, keys.Page())
+	assert.EqualValues(t, 3, keys.Value().ID)
+	assert.EqualValues(t, 30, keys.Value().GameID)
+	keys.Close()
+	assert.False(t, keys.Next())
+}
+
+func TestPagerPrefetches(t *testing.T) {
+	var requests int32
+	server := newPagedServer(10, 2, &requests)
+	defer server.Close()
+	client := newTestKeyClient(server)
+
+	keys := client.AllOwnedKeys(context.Background(), ListProfileOwnedKeysParams{})
+	defer keys.Close()
+	assert.True(t, keys.Next())
+
+	// the second page is fetched while we look at the first
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&requests) == 2
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestPagerErrors(t *testing.T) {
+	var requests int32
+	server := newPagedServer(10, 2, &requests, 2)
+	defer server.Close()
+	client := newTestKeyClient(server)
+
+	keys := client.AllOwnedKeys(context.Background(), ListProfileOwnedKeysParams{})
+	assert.Equal(t, []int64{1, 2}, collectKeys(keys))
+
+	var apiErr *APIError
+	if assert.True(t, errors.As(keys.Err(), &apiErr)) {
+		assert.Equal(t, 500, apiErr.StatusCode)
+	}
+}
+
+func TestPagerRespectsLimiter(t *testing.T) {
+	var requests int32
+	server := newPagedServer(6, 2, &requests)
+	defer server.Close()
+	client := newTestKeyClient(server)
+	client.Limiter = rate.NewLimiter(rate.Every(50*time.Millisecond), 1)
+
+	start := time.Now()
+	keys := client.AllOwnedKeys(context.Background(), ListProfileOwnedKeysParams{})
+	assert.Len(t, collectKeys(keys), 6)
+	assert.EqualValues(t, 4, atomic.LoadInt32(&requests))
+	assert.True(t, time.Since(start) >= 150*time.Millisecond, "4 requests take at least 3 limiter intervals")
+}
+
+func TestSearchPagers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		page := r.URL.Query().Get("page")
+		switch r.URL.Path {
+		case "/search/games":
+			if page == "1" {
+				_, _ = w.Write([]byte(`{"page":1,"per_page":2,"games":[{"id":1},{"id":2}]}`))
+			} else {
+				_, _ = w.Write([]byte(`{"page":2,"per_page":2,"games":[{"id":3}]}`))
+			}
+		case "/search/users":
+			_, _ = w.Write([]byte(`{"page":1,"per_page":2,"users":[{"id":7}]}`))
+		case "/collections/4/collection-games":
+			_, _ = w.Write([]byte(`{"page":1,"per_page":2,"collection_games":[]}`))
+		}
+	}))
+	defer server.Close()
+	client := newTestKeyClient(server)
+	ctx := context.Background()
+
+	var gameIDs []int64
+	games := client.SearchAllGames(ctx, SearchGamesParams{Query: "x"})
+	for games.Next() {
+		gameIDs = append(gameIDs, games.Value().ID)
+	}
+	assert.NoError(t, games.Err())
+	assert.Equal(t, []int64{1, 2, 3}, gameIDs)
+
+	users := client.SearchAllUsers(ctx, SearchUsersParams{Query: "x"})
+	assert.True(t, users.Next())
+	assert.EqualValues(t, 7, users.Value().ID)
+	assert.False(t, users.Next())
+
+	collectionGames := client.AllCollectionGames(ctx, GetCollectionGamesParams{CollectionID: 4})
+	assert.False(t, collectionGames.Next())
+	assert.NoError(t, collectionGames.Err())
+}
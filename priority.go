@@ -0,0 +1,182 @@
+package itchio
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Priority orders requests waiting on a PriorityLimiter: higher
+// priorities go first.
+type Priority int
+
+const (
+	// PriorityLow is for background work, like syncing a library
+	PriorityLow Priority = -1
+	// PriorityNormal is the priority of requests that don't specify one
+	PriorityNormal Priority = 0
+	// PriorityHigh is for requests a user is waiting on
+	PriorityHigh Priority = 1
+)
+
+type priorityKeyType struct{}
+
+var priorityKey = priorityKeyType{}
+
+// WithPriority returns a context which gives API calls made with it
+// the given priority. Priorities only matter to clients whose Limiter
+// is a PriorityLimiter.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey, priority)
+}
+
+// PriorityFromContext returns the priority set by WithPriority,
+// or PriorityNormal.
+func PriorityFromContext(ctx context.Context) Priority {
+	if priority, ok := ctx.Value(priorityKey).(Priority); ok {
+		return priority
+	}
+	return PriorityNormal
+}
+
+//-------------------------------------------------------
+
+// DefaultStarvationTimeout is how long requests wait on a PriorityLimiter
+// before going first regardless of their priority, unless told otherwise
+const DefaultStarvationTimeout = 10 * time.Second
+
+// PriorityConfig configures a PriorityLimiter
+type PriorityConfig struct {
+	// StarvationTimeout is how long a request may wait before it's let
+	// through ahead of higher-priority ones, so background work still
+	// progresses when interactive requests keep coming. Zero means
+	// DefaultStarvationTimeout, negative values disable it.
+	StarvationTimeout time.Duration
+}
+
+// A PriorityLimiter is a Limiter that schedules requests waiting on another
+// Limiter by priority (see WithPriority): when a request may be sent, the
+// highest-priority one waiting goes first. Requests of the same priority go
+// in the order they arrived.
+//
+// Like the Limiter it wraps, it can be shared by several clients.
+type PriorityLimiter struct {
+	inner             Limiter
+	starvationTimeout time.Duration
+
+	mu sync.Mutex
+	// queue holds the requests waiting for their turn, in arrival order
+	queue *list.List
+	// busy is true while a request has its turn: it's the only one
+	// waiting on inner.
+	busy bool
+}
+
+type priorityTicket struct {
+	priority Priority
+	enqueued time.Time
+	// turn is closed when the ticket gets its turn
+	turn chan struct{}
+}
+
+var _ ObservingLimiter = (*PriorityLimiter)(nil)
+
+// NewPriorityLimiter returns a limiter that schedules requests by priority
+// in front of inner. A nil inner only orders requests, without pacing them.
+func NewPriorityLimiter(inner Limiter, config PriorityConfig) *PriorityLimiter {
+	if config.StarvationTimeout == 0 {
+		config.StarvationTimeout = DefaultStarvationTimeout
+	}
+	return &PriorityLimiter{
+		inner:             inner,
+		starvationTimeout: config.StarvationTimeout,
+		queue:             list.New(),
+	}
+}
+
+// Wait blocks until it's the request's turn, and the wrapped
+// limiter lets it through, or ctx is done.
+func (pl *PriorityLimiter) Wait(ctx context.Context) error {
+	pl.mu.Lock()
+	if !pl.busy && pl.queue.Len() == 0 {
+		pl.busy = true
+		pl.mu.Unlock()
+	} else {
+		t := &priorityTicket{
+			priority: PriorityFromContext(ctx),
+			enqueued: time.Now(),
+			turn:     make(chan struct{}),
+		}
+		el := pl.queue.PushBack(t)
+		pl.mu.Unlock()
+
+		select {
+		case <-t.turn:
+		case <-ctx.Done():
+			pl.mu.Lock()
+			select {
+			case <-t.turn:
+				// got our turn while giving up: pass it on
+				pl.mu.Unlock()
+				pl.release()
+			default:
+				pl.queue.Remove(el)
+				pl.mu.Unlock()
+			}
+			return ctx.Err()
+		}
+	}
+	defer pl.release()
+
+	if pl.inner == nil {
+		return nil
+	}
+	return pl.inner.Wait(ctx)
+}
+
+// release gives the turn to the next request, if any
+func (pl *PriorityLimiter) release() {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	el := pl.next(time.Now())
+	if el == nil {
+		pl.busy = false
+		return
+	}
+	pl.queue.Remove(el)
+	close(el.Value.(*priorityTicket).turn)
+}
+
+// next returns the request that should go next: the oldest one that's
+// been waiting for too long, or the oldest one with the highest priority.
+func (pl *PriorityLimiter) next(now time.Time) *list.Element {
+	var best *list.Element
+	for el := pl.queue.Front(); el != nil; el = el.Next() {
+		t := el.Value.(*priorityTicket)
+		if pl.starvationTimeout > 0 && now.Sub(t.enqueued) >= pl.starvationTimeout {
+			return el
+		}
+		if best == nil || t.priority > best.Value.(*priorityTicket).priority {
+			best = el
+		}
+	}
+	return best
+}
+
+// Observe passes responses on to the wrapped limiter,
+// if it's an ObservingLimiter
+func (pl *PriorityLimiter) Observe(res *http.Response, err error) {
+	if observer, ok := pl.inner.(ObservingLimiter); ok {
+		observer.Observe(res, err)
+	}
+}
+
+// Waiting returns how many requests are waiting for their turn
+func (pl *PriorityLimiter) Waiting() int {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return pl.queue.Len()
+}
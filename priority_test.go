@@ -0,0 +1,131 @@
+package itchio
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gateLimiter lets one request through for every value sent on its gate
+type gateLimiter struct {
+	gate chan struct{}
+}
+
+func (gl *gateLimiter) Wait(ctx context.Context) error {
+	select {
+	case <-gl.gate:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type priorityRecorder struct {
+	mu    sync.Mutex
+	order []string
+	wg    sync.WaitGroup
+}
+
+// wait calls pl.Wait in the background, with the given priority, and
+// returns once the call is queued
+func (pr *priorityRecorder) wait(t *testing.T, ctx context.Context, pl *PriorityLimiter, name string, priority Priority, queued int) {
+	pr.wg.Add(1)
+	go func() {
+		defer pr.wg.Done()
+		if err := pl.Wait(WithPriority(ctx, priority)); err != nil {
+			return
+		}
+		pr.mu.Lock()
+		pr.order = append(pr.order, name)
+		pr.mu.Unlock()
+	}()
+	for {
+		pl.mu.Lock()
+		ready := pl.busy && pl.queue.Len() == queued
+		pl.mu.Unlock()
+		if ready {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// open lets n requests through inner, one at a time, and waits for them to return
+func (pr *priorityRecorder) open(inner *gateLimiter, n int) {
+	for i := 0; i < n; i++ {
+		inner.gate <- struct{}{}
+		for {
+			pr.mu.Lock()
+			done := len(pr.order) > i
+			pr.mu.Unlock()
+			if done {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	pr.wg.Wait()
+}
+
+func TestPriorityLimiter(t *testing.T) {
+	inner := &gateLimiter{gate: make(chan struct{})}
+	pl := NewPriorityLimiter(inner, PriorityConfig{StarvationTimeout: -1})
+	ctx := context.Background()
+
+	pr := &priorityRecorder{}
+	pr.wait(t, ctx, pl, "first", PriorityLow, 0)
+	pr.wait(t, ctx, pl, "low1", PriorityLow, 1)
+	pr.wait(t, ctx, pl, "low2", PriorityLow, 2)
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	pr.wait(t, canceledCtx, pl, "canceled", PriorityHigh, 3)
+	cancel()
+	for pl.Waiting() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	pr.wait(t, ctx, pl, "normal", PriorityNormal, 3)
+	pr.wait(t, ctx, pl, "high1", PriorityHigh, 4)
+	pr.wait(t, ctx, pl, "high2", PriorityHigh, 5)
+
+	pr.open(inner, 6)
+	assert.Equal(t, []string{"first", "high1", "high2", "normal", "low1", "low2"}, pr.order)
+	assert.Equal(t, 0, pl.Waiting())
+}
+
+func TestPriorityLimiterStarvation(t *testing.T) {
+	inner := &gateLimiter{gate: make(chan struct{})}
+	pl := NewPriorityLimiter(inner, PriorityConfig{StarvationTimeout: 30 * time.Millisecond})
+	ctx := context.Background()
+
+	pr := &priorityRecorder{}
+	pr.wait(t, ctx, pl, "first", PriorityHigh, 0)
+	pr.wait(t, ctx, pl, "low", PriorityLow, 1)
+	time.Sleep(40 * time.Millisecond)
+	pr.wait(t, ctx, pl, "high", PriorityHigh, 2)
+
+	pr.open(inner, 3)
+	assert.Equal(t, []string{"first", "low", "high"}, pr.order, "requests that waited too long go first")
+}
+
+func TestPriorityLimiterClient(t *testing.T) {
+	server := newSlowGameServer(0, new(int32))
+	defer server.Close()
+
+	aimd := NewAIMDLimiter(AIMDConfig{MaxRate: 100})
+	client := newTestKeyClient(server)
+	client.Limiter = NewPriorityLimiter(aimd, PriorityConfig{})
+
+	concurrently(4, func(i int) {
+		_, err := client.GetGame(WithPriority(context.Background(), Priority(i%3-1)), GetGameParams{GameID: 3})
+		assert.NoError(t, err)
+	})
+
+	aimd.Observe(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil)
+	client.Limiter.(ObservingLimiter).Observe(&http.Response{StatusCode: http.StatusOK}, nil)
+	assert.EqualValues(t, 52, aimd.Rate(), "responses are passed on to the wrapped limiter")
+}
@@ -78,9 +78,23 @@ func (q *Query) AddInt64IfNonZero(key string, value int64) {
 	}
 }
 
-// AddAPICredentials adds the api_key= parameter from the client's key
+// AddAPICredentials adds the parameters that authenticate the query
+// on behalf of the client, like AddAPICredentialsContext. If credentials
+// can't be renewed, the query is left without them.
 func (q *Query) AddAPICredentials() {
-	q.Values.Add("api_key", q.Client.Key)
+	_ = q.AddAPICredentialsContext(context.Background())
+}
+
+// AddAPICredentialsContext adds the parameters that authenticate the
+// query on behalf of the client (usually api_key=), renewing credentials
+// first if needed, see Authenticator.QueryCredentials
+func (q *Query) AddAPICredentialsContext(ctx context.Context) error {
+	values, err := q.Client.authenticator(ctx).QueryCredentials(ctx, q.Client)
+	if err != nil {
+		return err
+	}
+	q.AddValues(values)
+	return nil
 }
 
 // AddGameCredentials adds the download_key_id, password, and secret
@@ -99,13 +113,17 @@ func (q *Query) URL() string {
 
 // Get performs this query as an HTTP GET request with the tied client.
 // Params are URL-encoded and added to the path, see URL().
-func (q *Query) Get(ctx context.Context, r interface{}) error {
+func (q *Query) Get(ctx context.Context, r interface{}, opts ...CallOption) error {
+	ctx, cancel := withCallOptions(ctx, opts)
+	defer cancel()
 	return q.Client.GetResponse(ctx, q.URL(), r)
 }
 
 // Post performs this query as an HTTP POST request with the tied client.
 // Parameters are URL-encoded and passed as the body of the POST request.
-func (q *Query) Post(ctx context.Context, r interface{}) error {
+func (q *Query) Post(ctx context.Context, r interface{}, opts ...CallOption) error {
+	ctx, cancel := withCallOptions(ctx, opts)
+	defer cancel()
 	url := q.Client.MakePath(q.Path)
 	return q.Client.PostFormResponse(ctx, url, q.Values, r)
 }
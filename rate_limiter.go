@@ -1,22 +1,184 @@
 package itchio
 
-import "golang.org/x/time/rate"
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
 
-var defaultRateLimiter *rate.Limiter
+	"golang.org/x/time/rate"
+)
 
-// DefaultRateLimiter returns a rate.Limiter suitable
-// for consuming the itch.io API. It is shared across all
-// instances of Client, unless a custom limiter is set.
+// A Limiter paces the requests made by a Client: Wait is called before
+// every attempt, and blocks until the request may be sent, or ctx is done.
+// A *rate.Limiter is a valid Limiter.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// An ObservingLimiter is a Limiter that adapts to the responses
+// of the requests it let through.
+type ObservingLimiter interface {
+	Limiter
+	// Observe is called after every attempt, with its response
+	// or error (exactly one of which is non-nil).
+	Observe(res *http.Response, err error)
+}
+
+var (
+	defaultLimiter     *AIMDLimiter
+	defaultLimiterOnce sync.Once
+
+	defaultRateLimiter     *rate.Limiter
+	defaultRateLimiterOnce sync.Once
+)
+
+// DefaultLimiter returns an adaptive limiter suitable for consuming
+// the itch.io API. It is shared across all instances of Client, unless
+// a custom limiter is set.
+func DefaultLimiter() *AIMDLimiter {
+	defaultLimiterOnce.Do(func() {
+		defaultLimiter = NewAIMDLimiter(AIMDConfig{
+			MaxRate: defaultRateLimit,
+			Burst:   defaultRateBurst,
+		})
+	})
+	return defaultLimiter
+}
+
+// Although - at the time of this writing - the server-side settings allow for
+// 8 reqs/s and a burst of 20, in practice, anything above a 15 burst fails
+// with more than 2 concurrent workers (which is not unusual).
+// If you know more than me about this (ie. how Nginx actually enforces
+// rate limits), have a thread: https://twitter.com/fasterthanlime/status/1150751037352865797
+const (
+	defaultRateLimit = 8.0
+	defaultRateBurst = 15
+)
+
+// DefaultRateLimiter returns a fixed-rate rate.Limiter suitable
+// for consuming the itch.io API. It is shared by all its callers.
+//
+// Deprecated: clients use DefaultLimiter, which slows down when
+// the API is overloaded.
 func DefaultRateLimiter() *rate.Limiter {
-	// Although - at the time of this writing - the server-side settings allow for
-	// 8 reqs/s and a burst of 20, in practice, anything above a 15 burst fails
-	// with more than 2 concurrent workers (which is not unusual).
-	// If you know more than me about this (ie. how Nginx actually enforces
-	// rate limits), have a thread: https://twitter.com/fasterthanlime/status/1150751037352865797
-	if defaultRateLimiter == nil {
-		limit := rate.Limit(8.0)
-		burst := 15
-		defaultRateLimiter = rate.NewLimiter(limit, burst)
-	}
+	defaultRateLimiterOnce.Do(func() {
+		defaultRateLimiter = rate.NewLimiter(rate.Limit(defaultRateLimit), defaultRateBurst)
+	})
 	return defaultRateLimiter
 }
+
+//-------------------------------------------------------
+
+// AIMDConfig configures an AIMDLimiter. Zero fields take default values.
+type AIMDConfig struct {
+	// MaxRate is the rate (in requests per second) the limiter
+	// starts at, and never exceeds. Defaults to 8.
+	MaxRate float64
+	// MinRate is the rate the limiter never goes below. Defaults to
+	// a tenth of MaxRate.
+	MinRate float64
+	// Burst is how many requests may be sent at once. Defaults to 15.
+	Burst int
+	// Increase is how much the rate grows after each successful
+	// request. Defaults to a fiftieth of MaxRate.
+	Increase float64
+	// Decrease is the factor the rate is multiplied by when the API is
+	// overloaded. Must be between 0 and 1. Defaults to 0.5.
+	Decrease float64
+	// Cooldown is the minimum time between two decreases, so that
+	// concurrent requests failing at once only count once. Defaults to
+	// a second.
+	Cooldown time.Duration
+}
+
+// An AIMDLimiter is a Limiter that adjusts its rate with additive
+// increase, multiplicative decrease: it slows down sharply when the API
+// responds with 429 or 503, then speeds up slowly as requests succeed.
+//
+// It's safe for concurrent use, and can be shared by several clients.
+type AIMDLimiter struct {
+	config  AIMDConfig
+	limiter *rate.Limiter
+
+	mu           sync.Mutex
+	rate         float64
+	lastDecrease time.Time
+}
+
+var _ ObservingLimiter = (*AIMDLimiter)(nil)
+
+// NewAIMDLimiter returns a limiter that starts at config.MaxRate
+func NewAIMDLimiter(config AIMDConfig) *AIMDLimiter {
+	if config.MaxRate <= 0 {
+		config.MaxRate = defaultRateLimit
+	}
+	if config.MinRate <= 0 || config.MinRate > config.MaxRate {
+		config.MinRate = config.MaxRate / 10
+	}
+	if config.Burst <= 0 {
+		config.Burst = defaultRateBurst
+	}
+	if config.Increase <= 0 {
+		config.Increase = config.MaxRate / 50
+	}
+	if config.Decrease <= 0 || config.Decrease >= 1 {
+		config.Decrease = 0.5
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = time.Second
+	}
+
+	return &AIMDLimiter{
+		config:  config,
+		limiter: rate.NewLimiter(rate.Limit(config.MaxRate), config.Burst),
+		rate:    config.MaxRate,
+	}
+}
+
+// Wait blocks until a request may be sent, or ctx is done
+func (l *AIMDLimiter) Wait(ctx context.Context) error {
+	return l.limiter.Wait(ctx)
+}
+
+// Observe adjusts the rate according to a response. Errors
+// (network failures, timeouts) don't affect it.
+func (l *AIMDLimiter) Observe(res *http.Response, err error) {
+	if res == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	newRate := l.rate
+	switch {
+	case isRateLimitedStatus(res.StatusCode):
+		now := time.Now()
+		if now.Sub(l.lastDecrease) < l.config.Cooldown {
+			return
+		}
+		l.lastDecrease = now
+		newRate *= l.config.Decrease
+		if newRate < l.config.MinRate {
+			newRate = l.config.MinRate
+		}
+	case res.StatusCode < 500:
+		newRate += l.config.Increase
+		if newRate > l.config.MaxRate {
+			newRate = l.config.MaxRate
+		}
+	}
+
+	if newRate != l.rate {
+		l.rate = newRate
+		l.limiter.SetLimit(rate.Limit(newRate))
+	}
+}
+
+// Rate returns the current rate, in requests per second
+func (l *AIMDLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
@@ -0,0 +1,78 @@
+package itchio
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAIMDLimiter(t *testing.T) {
+	l := NewAIMDLimiter(AIMDConfig{MaxRate: 10, MinRate: 2, Increase: 1, Cooldown: time.Hour})
+	assert.EqualValues(t, 10, l.Rate())
+
+	unavailable := &http.Response{StatusCode: http.StatusServiceUnavailable}
+	ok := &http.Response{StatusCode: http.StatusOK}
+
+	l.Observe(unavailable, nil)
+	assert.EqualValues(t, 5, l.Rate(), "503s halve the rate")
+	l.Observe(unavailable, nil)
+	assert.EqualValues(t, 5, l.Rate(), "decreases are spaced by the cooldown")
+
+	l.Observe(ok, nil)
+	l.Observe(ok, nil)
+	assert.EqualValues(t, 7, l.Rate(), "successes increase the rate additively")
+	l.Observe(nil, context.DeadlineExceeded)
+	l.Observe(&http.Response{StatusCode: http.StatusInternalServerError}, nil)
+	assert.EqualValues(t, 7, l.Rate(), "errors don't affect the rate")
+
+	for i := 0; i < 10; i++ {
+		l.Observe(ok, nil)
+	}
+	assert.EqualValues(t, 10, l.Rate(), "the rate never exceeds MaxRate")
+
+	l = NewAIMDLimiter(AIMDConfig{MaxRate: 10, MinRate: 2, Cooldown: time.Nanosecond})
+	for i := 0; i < 5; i++ {
+		time.Sleep(time.Millisecond)
+		l.Observe(&http.Response{StatusCode: http.StatusTooManyRequests}, nil)
+	}
+	assert.EqualValues(t, 2, l.Rate(), "the rate never goes below MinRate")
+}
+
+func TestAIMDLimiterClient(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"game":{"id":3}}`))
+	}))
+	defer server.Close()
+
+	limiter := NewAIMDLimiter(AIMDConfig{MaxRate: 1000, Cooldown: time.Nanosecond})
+	client := newTestKeyClient(server)
+	client.RetryPolicy = &BackoffRetryPolicy{Delays: []time.Duration{time.Millisecond, time.Millisecond}}
+	client.Limiter = limiter
+
+	_, err := client.GetGame(context.Background(), GetGameParams{GameID: 3})
+	assert.NoError(t, err)
+	assert.InDelta(t, 1000*0.5*0.5+1000.0/50, limiter.Rate(), 0.001, "every attempt is observed")
+}
+
+func TestDefaultLimiters(t *testing.T) {
+	limiters := make(chan *AIMDLimiter, 4)
+	concurrently(4, func(i int) {
+		limiters <- DefaultLimiter()
+	})
+	close(limiters)
+	for l := range limiters {
+		assert.True(t, l == DefaultLimiter(), "the default limiter is shared")
+	}
+	assert.True(t, DefaultRateLimiter() == DefaultRateLimiter())
+	assert.True(t, ClientWithKey("").Limiter == Limiter(DefaultLimiter()))
+}
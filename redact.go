@@ -0,0 +1,208 @@
+package itchio
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces secrets in everything the client emits for diagnostics
+const Redacted = "[REDACTED]"
+
+// sensitiveHeaders hold credentials, and are masked by RedactHeader
+var sensitiveHeaders = map[string]struct{}{
+	"Authorization":       {},
+	"Proxy-Authorization": {},
+	"Cookie":              {},
+	"Set-Cookie":          {},
+}
+
+// sensitiveFields are the names of query parameters, form fields and
+// JSON properties that hold secrets: API keys, passwords, TOTP codes,
+// OAuth codes and tokens, etc. Names are normalized with normalizeFieldName
+// so that both `refresh_token` and `refreshToken` match.
+var sensitiveFields = map[string]struct{}{
+	"apikey":            {},
+	"key":               {},
+	"password":          {},
+	"secret":            {},
+	"token":             {},
+	"code":              {},
+	"codeverifier":      {},
+	"accesstoken":       {},
+	"refreshtoken":      {},
+	"recaptcharesponse": {},
+	"cookie":            {},
+}
+
+func normalizeFieldName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "", -1))
+}
+
+// IsSensitiveField returns true if a query parameter, form field or JSON
+// property with the given name holds a secret.
+func IsSensitiveField(name string) bool {
+	_, ok := sensitiveFields[normalizeFieldName(name)]
+	return ok
+}
+
+// RedactHeader returns a copy of header where credentials are masked.
+// The scheme of Authorization headers (Bearer, etc.) is kept.
+func RedactHeader(header http.Header) http.Header {
+	res := make(http.Header, len(header))
+	for k, vv := range header {
+		if _, ok := sensitiveHeaders[http.CanonicalHeaderKey(k)]; !ok {
+			res[k] = append([]string(nil), vv...)
+			continue
+		}
+
+		redacted := make([]string, len(vv))
+		for i, v := range vv {
+			redacted[i] = redactHeaderValue(v)
+		}
+		res[k] = redacted
+	}
+	return res
+}
+
+func redactHeaderValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	if i := strings.IndexByte(value, ' '); i > 0 {
+		return value[:i] + " " + Redacted
+	}
+	return Redacted
+}
+
+// RedactValues returns a copy of values (a query string or form body)
+// where secrets are masked.
+func RedactValues(values url.Values) url.Values {
+	res := make(url.Values, len(values))
+	for k, vv := range values {
+		if !IsSensitiveField(k) {
+			res[k] = append([]string(nil), vv...)
+			continue
+		}
+
+		redacted := make([]string, len(vv))
+		for i := range vv {
+			redacted[i] = Redacted
+		}
+		res[k] = redacted
+	}
+	return res
+}
+
+// RedactURL returns u as a string, with secrets masked from
+// its query string and user info.
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	redacted := *u
+	if u.User != nil {
+		redacted.User = url.User(u.User.Username())
+		if _, ok := u.User.Password(); ok {
+			redacted.User = url.UserPassword(u.User.Username(), Redacted)
+		}
+	}
+	if u.RawQuery != "" {
+		if values, err := url.ParseQuery(u.RawQuery); err == nil {
+			redacted.RawQuery = encodeRedactedValues(RedactValues(values))
+		} else {
+			redacted.RawQuery = Redacted
+		}
+	}
+	return redacted.String()
+}
+
+// encodeRedactedValues is like url.Values.Encode, except it doesn't escape
+// the Redacted marker, to keep logs readable.
+func encodeRedactedValues(values url.Values) string {
+	return strings.Replace(values.Encode(), url.QueryEscape(Redacted), Redacted, -1)
+}
+
+// RedactJSON returns a copy of a JSON document where the values of
+// sensitive properties are masked. If body isn't valid JSON, it's
+// returned as-is.
+func RedactJSON(body []byte) []byte {
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return body
+	}
+
+	res, err := json.Marshal(redactJSONValue(doc))
+	if err != nil {
+		return body
+	}
+	return res
+}
+
+func redactJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if IsSensitiveField(k) && child != nil {
+				v[k] = redactJSONSecret(child)
+			} else {
+				v[k] = redactJSONValue(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactJSONValue(child)
+		}
+	}
+	return v
+}
+
+// redactJSONSecret masks a sensitive JSON value. Objects (like the API key
+// or cookie returned on login) keep their shape, but all their strings are masked.
+func redactJSONSecret(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = redactJSONSecret(child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactJSONSecret(child)
+		}
+		return v
+	case string:
+		return Redacted
+	default:
+		return v
+	}
+}
+
+// RedactBody masks secrets from a request or response body, depending
+// on its content type: url-encoded forms and JSON are supported, anything
+// else is returned as-is.
+func RedactBody(contentType string, body []byte) []byte {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return []byte(Redacted)
+		}
+		return []byte(encodeRedactedValues(RedactValues(values)))
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return RedactJSON(body)
+	default:
+		// the itch.io API doesn't always send a JSON content type
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			return RedactJSON(body)
+		}
+		return body
+	}
+}
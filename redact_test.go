@@ -0,0 +1,43 @@
+package itchio
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactHeader(t *testing.T) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer secret-token")
+	header.Set("User-Agent", "go-itchio")
+	header.Add("Cookie", "itchio_token=abc")
+
+	redacted := RedactHeader(header)
+	assert.Equal(t, "Bearer [REDACTED]", redacted.Get("Authorization"))
+	assert.Equal(t, "[REDACTED]", redacted.Get("Cookie"))
+	assert.Equal(t, "go-itchio", redacted.Get("User-Agent"))
+	// original is left untouched
+	assert.Equal(t, "Bearer secret-token", header.Get("Authorization"))
+}
+
+func TestRedactURL(t *testing.T) {
+	u, err := url.Parse("https://api.itch.io/uploads/12/download?api_key=hunter2&uuid=abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.itch.io/uploads/12/download?api_key=[REDACTED]&uuid=abc", RedactURL(u))
+}
+
+func TestRedactBody(t *testing.T) {
+	form := RedactBody("application/x-www-form-urlencoded", []byte("username=amos&password=hunter2&code=123456"))
+	values, err := url.ParseQuery(string(form))
+	assert.NoError(t, err)
+	assert.Equal(t, "amos", values.Get("username"))
+	assert.Equal(t, Redacted, values.Get("password"))
+	assert.Equal(t, Redacted, values.Get("code"))
+
+	json := RedactBody("", []byte(`{"key":{"id":12,"key":"abcdef"},"cookie":{"itchio_token":"xyz"},"refresh_token":"r","user":{"username":"amos"}}`))
+	assert.JSONEq(t, `{"key":{"id":12,"key":"[REDACTED]"},"cookie":{"itchio_token":"[REDACTED]"},"refresh_token":"[REDACTED]","user":{"username":"amos"}}`, string(json))
+
+	assert.Equal(t, "not json", string(RedactBody("text/plain", []byte("not json"))))
+}
@@ -0,0 +1,72 @@
+package itchio
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// responseMetaKey marks a context as wanting response metadata recorded
+const responseMetaKey contextKey = "responseMeta"
+
+// ResponseMeta describes what happened over the wire during an API call.
+// To capture it for a call, pass a context returned by WithResponseMeta.
+type ResponseMeta struct {
+	// StatusCode of the last response, or 0 if no response was received
+	StatusCode int
+	// Header of the last response
+	Header http.Header
+	// RequestID identifies the request server-side, if the server sent one
+	RequestID string
+
+	// Attempts is how many times the request was sent, including retries,
+	// and the retry after an OAuth token refresh.
+	Attempts int
+	// Latency is the total time spent in the call, from the first attempt
+	// to the last response.
+	Latency time.Duration
+	// RateLimitWait is how much of Latency was spent waiting on the
+	// client's rate limiter.
+	RateLimitWait time.Duration
+	// RetryWait is how much of Latency was spent waiting between retries.
+	RetryWait time.Duration
+
+	// FromCache is true if the response was served from the client's Cache,
+	// with or without revalidating it.
+	FromCache bool
+	// Stale is true if the response was served from the client's Cache
+	// because the API couldn't be reached.
+	Stale bool
+}
+
+// WithResponseMeta returns a context which makes API calls record their
+// metadata into meta. meta is reset at the start of every call, so it
+// should only be used for one call at a time.
+func WithResponseMeta(ctx context.Context, meta *ResponseMeta) context.Context {
+	return context.WithValue(ctx, responseMetaKey, meta)
+}
+
+// responseMetaFromContext returns the ResponseMeta to record into, or nil
+func responseMetaFromContext(ctx context.Context) *ResponseMeta {
+	meta, _ := ctx.Value(responseMetaKey).(*ResponseMeta)
+	return meta
+}
+
+// withoutResponseMeta returns a context that doesn't record response
+// metadata, for requests made on behalf of another one (token refresh).
+func withoutResponseMeta(ctx context.Context) context.Context {
+	if responseMetaFromContext(ctx) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, responseMetaKey, (*ResponseMeta)(nil))
+}
+
+// recordResponse fills in the last response's details
+func (meta *ResponseMeta) recordResponse(res *http.Response) {
+	if res == nil {
+		return
+	}
+	meta.StatusCode = res.StatusCode
+	meta.Header = res.Header
+	meta.RequestID = requestID(res.Header)
+}
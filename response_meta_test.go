@@ -0,0 +1,77 @@
+package itchio
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseMeta(t *testing.T) {
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "req-456")
+		_, _ = w.Write([]byte(`{"game":{"id":3}}`))
+	}))
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+	client.RetryPolicy = &BackoffRetryPolicy{Delays: []time.Duration{10 * time.Millisecond}}
+
+	var meta ResponseMeta
+	ctx := WithResponseMeta(context.Background(), &meta)
+
+	_, err := client.GetGame(ctx, GetGameParams{GameID: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 200, meta.StatusCode)
+	assert.Equal(t, "req-456", meta.RequestID)
+	assert.Equal(t, "application/json", meta.Header.Get("Content-Type"))
+	assert.Equal(t, 2, meta.Attempts)
+	assert.True(t, meta.RetryWait >= 10*time.Millisecond)
+	assert.True(t, meta.Latency >= meta.RetryWait+meta.RateLimitWait)
+
+	// the same meta is reset for the next call
+	_, err = client.GetGame(ctx, GetGameParams{GameID: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, meta.Attempts)
+	assert.Equal(t, time.Duration(0), meta.RetryWait)
+}
+
+func TestResponseMetaIgnoresTokenRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/oauth/token":
+			w.Header().Set("X-Request-Id", "refresh")
+			_, _ = w.Write([]byte(`{"accessToken":"new-access","expiresIn":300}`))
+		default:
+			w.Header().Set("X-Request-Id", "profile")
+			_, _ = w.Write([]byte(`{"user":{"id":1}}`))
+		}
+	}))
+	defer server.Close()
+
+	client := newTestOAuthClient(t, server, &OAuthCredentials{
+		AccessToken:  "old-access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(-1 * time.Minute),
+	}, OAuthConfig{
+		ClientID: "client-123",
+	})
+
+	var meta ResponseMeta
+	_, err := client.GetProfile(WithResponseMeta(context.Background(), &meta))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, meta.Attempts)
+	assert.Equal(t, "profile", meta.RequestID)
+}
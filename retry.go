@@ -0,0 +1,220 @@
+package itchio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A RetryPolicy decides, after each attempt at performing a request,
+// whether the request should be attempted again, and how long to wait
+// before doing so.
+//
+// attempt is the number of attempts made so far (starting at 1). res and
+// err are what the last attempt returned: res is nil whenever err is not.
+type RetryPolicy interface {
+	Retry(attempt int, req *http.Request, res *http.Response, err error) (wait time.Duration, retry bool)
+}
+
+// RetryPolicyFunc allows using an ordinary function as a RetryPolicy
+type RetryPolicyFunc func(attempt int, req *http.Request, res *http.Response, err error) (time.Duration, bool)
+
+// Retry implements RetryPolicy
+func (f RetryPolicyFunc) Retry(attempt int, req *http.Request, res *http.Response, err error) (time.Duration, bool) {
+	return f(attempt, req, res, err)
+}
+
+// NoRetry is a RetryPolicy that never retries anything.
+var NoRetry RetryPolicy = RetryPolicyFunc(func(attempt int, req *http.Request, res *http.Response, err error) (time.Duration, bool) {
+	return 0, false
+})
+
+// BackoffRetryPolicy retries requests that were rate limited (HTTP 429 and 503)
+// or that failed because of a transient network error, following
+// https://cloud.google.com/storage/docs/json_api/v1/how-tos/upload#exp-backoff
+// to the letter.
+//
+// Requests that aren't idempotent (see IsIdempotent) are only retried when the
+// server can't have acted on them: on 429, on 503 with a Retry-After header (which
+// the rate limiter in front of the API sends), and on network errors that happened
+// before the request was sent. The application itself may answer 503 after
+// handling a request, so a plain 503 is only retried for idempotent requests.
+type BackoffRetryPolicy struct {
+	// Delays lists how long to wait before each retry. Its length is the
+	// maximum number of retries.
+	Delays []time.Duration
+
+	// Jitter is the upper bound of a random duration added to each delay.
+	Jitter time.Duration
+
+	// MaxRetryAfter caps how long we're willing to wait when the server
+	// sends a Retry-After header. If the server asks us to wait longer than
+	// that, the request is not retried. Zero means no cap.
+	MaxRetryAfter time.Duration
+}
+
+var _ RetryPolicy = (*BackoffRetryPolicy)(nil)
+
+// DefaultRetryPolicy returns the policy used by new clients: up to 5 retries,
+// sleeping 1, 2, 4, 8, then 16 seconds (plus up to a second of jitter), unless
+// the server specifies a Retry-After of a minute or less.
+func DefaultRetryPolicy() *BackoffRetryPolicy {
+	return &BackoffRetryPolicy{
+		Delays: []time.Duration{
+			1 * time.Second,
+			2 * time.Second,
+			4 * time.Second,
+			8 * time.Second,
+			16 * time.Second,
+		},
+		Jitter:        1 * time.Second,
+		MaxRetryAfter: 1 * time.Minute,
+	}
+}
+
+// Retry implements RetryPolicy
+func (p *BackoffRetryPolicy) Retry(attempt int, req *http.Request, res *http.Response, err error) (time.Duration, bool) {
+	if attempt > len(p.Delays) {
+		return 0, false
+	}
+
+	if err != nil {
+		if !retryableError(req, err) {
+			return 0, false
+		}
+		return p.backoff(attempt), true
+	}
+
+	if !isRateLimitedStatus(res.StatusCode) {
+		return 0, false
+	}
+
+	if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); ok {
+		if p.MaxRetryAfter > 0 && retryAfter > p.MaxRetryAfter {
+			return 0, false
+		}
+		return retryAfter, true
+	}
+	if res.StatusCode != http.StatusTooManyRequests && !IsIdempotent(req) {
+		return 0, false
+	}
+	return p.backoff(attempt), true
+}
+
+func (p *BackoffRetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.Delays[attempt-1]
+	if p.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(p.Jitter)))
+	}
+	return delay
+}
+
+// IsIdempotent returns true if performing req several times has the same
+// effect as performing it once. Like net/http, it considers GET, HEAD, OPTIONS,
+// TRACE, PUT and DELETE to be idempotent, along with any request that carries
+// an Idempotency-Key or X-Idempotency-Key header.
+func IsIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if _, ok := req.Header["Idempotency-Key"]; ok {
+		return true
+	}
+	if _, ok := req.Header["X-Idempotency-Key"]; ok {
+		return true
+	}
+	return false
+}
+
+// retryableError returns true if err is worth retrying for req. Requests
+// that aren't idempotent are only retried if we know for sure the server
+// never saw them.
+func retryableError(req *http.Request, err error) bool {
+	if requestNotSent(err) {
+		return true
+	}
+	return IsIdempotent(req) && isTransientError(err)
+}
+
+// requestNotSent returns true if err happened before the request
+// could be written to the server: dialing or TLS handshake.
+func requestNotSent(err error) bool {
+	if strings.Contains(err.Error(), "TLS handshake timeout") {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return false
+}
+
+// isTransientError returns true for network errors that may
+// go away if the request is attempted again.
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || isConnectionReset(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isRateLimitedStatus returns true for the status codes the itch.io
+// API (and the proxies in front of it) use to ask us to slow down.
+func isRateLimitedStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which
+// is either a number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		d := date.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+// sleepContext waits for d to elapse, or for ctx to be done,
+// whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
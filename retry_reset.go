@@ -0,0 +1,14 @@
+//go:build !plan9
+// +build !plan9
+
+package itchio
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isConnectionReset returns true if err is the peer resetting the connection
+func isConnectionReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET)
+}
@@ -0,0 +1,10 @@
+//go:build plan9
+// +build plan9
+
+package itchio
+
+// isConnectionReset returns false: plan9 has no ECONNRESET errno,
+// its network errors are plain strings.
+func isConnectionReset(err error) bool {
+	return false
+}
@@ -0,0 +1,235 @@
+package itchio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func newTestKeyClient(server *httptest.Server) *Client {
+	client := ClientWithKey("APIKEY")
+	client.HTTPClient = server.Client()
+	client.BaseURL = server.URL
+	client.Limiter = rate.NewLimiter(rate.Inf, 1)
+	return client
+}
+
+func TestBackoffRetryPolicyHonoursRetryAfter(t *testing.T) {
+	p := &BackoffRetryPolicy{
+		Delays:        []time.Duration{time.Second, time.Second},
+		MaxRetryAfter: 10 * time.Second,
+	}
+	req := httptest.NewRequest("GET", "/profile", nil)
+
+	res := &http.Response{StatusCode: 429, Header: http.Header{}}
+	res.Header.Set("Retry-After", "3")
+	wait, retry := p.Retry(1, req, res, nil)
+	assert.True(t, retry)
+	assert.Equal(t, 3*time.Second, wait)
+
+	res.Header.Set("Retry-After", "30")
+	_, retry = p.Retry(1, req, res, nil)
+	assert.False(t, retry, "should give up when Retry-After exceeds MaxRetryAfter")
+
+	res = &http.Response{StatusCode: 503, Header: http.Header{}}
+	wait, retry = p.Retry(2, req, res, nil)
+	assert.True(t, retry)
+	assert.Equal(t, time.Second, wait)
+
+	_, retry = p.Retry(3, req, res, nil)
+	assert.False(t, retry, "should give up after running out of delays")
+
+	_, retry = p.Retry(1, req, &http.Response{StatusCode: 500, Header: http.Header{}}, nil)
+	assert.False(t, retry)
+
+	_, retry = p.Retry(1, req, nil, errors.New("net/http: TLS handshake timeout"))
+	assert.True(t, retry)
+}
+
+func TestParseRetryAfterDate(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	d, ok := parseRetryAfter(now.Add(5*time.Second).Format(http.TimeFormat), now)
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, d)
+
+	_, ok = parseRetryAfter("soon", now)
+	assert.False(t, ok)
+}
+
+func TestRetryOn503(t *testing.T) {
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"user":{"id":1}}`))
+	}))
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+
+	var rateLimited int32
+	client.OnRateLimited(func(req *http.Request, res *http.Response) {
+		atomic.AddInt32(&rateLimited, 1)
+	})
+
+	res, err := client.GetProfile(context.Background())
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, res.User.ID)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&rateLimited))
+}
+
+func TestRetryWaitHonoursContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+	client.RetryPolicy = RetryPolicyFunc(func(attempt int, req *http.Request, res *http.Response, err error) (time.Duration, bool) {
+		return time.Hour, true
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetProfile(ctx)
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestRetryReplaysPOSTBody(t *testing.T) {
+	var (
+		calls  int32
+		bodies []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"file":{"id":12}}`))
+	}))
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+	res, err := client.CreateBuildFile(context.Background(), CreateBuildFileParams{
+		BuildID: 34,
+		Type:    BuildFileTypePatch,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 12, res.File.ID)
+
+	assert.Len(t, bodies, 2)
+	for _, body := range bodies {
+		values, err := url.ParseQuery(body)
+		assert.NoError(t, err)
+		assert.Equal(t, "patch", values.Get("type"))
+	}
+}
+
+func TestNonIdempotentNotRetriedOnPlain503(t *testing.T) {
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+	client.RetryPolicy = &BackoffRetryPolicy{Delays: []time.Duration{0, 0}}
+
+	// the application may have handled the request before answering 503
+	_, err := client.CreateBuildFile(context.Background(), CreateBuildFileParams{
+		BuildID: 34,
+		Type:    BuildFileTypePatch,
+	})
+	assert.Error(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls), "POST should not be retried")
+
+	atomic.StoreInt32(&calls, 0)
+	_, err = client.GetProfile(context.Background())
+	assert.Error(t, err)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&calls), "GET should be retried")
+}
+
+func TestRetryWithoutGetBodyFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+
+	req, err := http.NewRequest("POST", server.URL+"/wharf/builds", io.NopCloser(strings.NewReader("a=b")))
+	assert.NoError(t, err)
+
+	_, err = client.Do(req)
+	var bnre *BodyNotReplayableError
+	assert.True(t, errors.As(err, &bnre))
+	assert.Equal(t, "/wharf/builds", bnre.Path)
+}
+
+func TestIsIdempotent(t *testing.T) {
+	assert.True(t, IsIdempotent(httptest.NewRequest("GET", "/", nil)))
+	assert.True(t, IsIdempotent(httptest.NewRequest("DELETE", "/", nil)))
+	assert.False(t, IsIdempotent(httptest.NewRequest("POST", "/", nil)))
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("Idempotency-Key", "abc")
+	assert.True(t, IsIdempotent(req))
+}
+
+func TestNonIdempotentNotRetriedOnAmbiguousError(t *testing.T) {
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// The server saw the request, but the client never gets a response
+			conn, _, err := w.(http.Hijacker).Hijack()
+			assert.NoError(t, err)
+			conn.Close()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"user":{"id":1}}`))
+	}))
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+	client.RetryPolicy = &BackoffRetryPolicy{Delays: []time.Duration{0, 0}}
+
+	_, err := client.GetProfile(context.Background())
+	assert.NoError(t, err, "GET should be retried")
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	_, err = client.CreateBuild(context.Background(), CreateBuildParams{Target: "a/b", Channel: "c"})
+	assert.Error(t, err, "POST should not be retried")
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
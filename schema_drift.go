@@ -0,0 +1,224 @@
+package itchio
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// OnSchemaDrift is the callback type for schema drift reports
+type OnSchemaDrift func(report *SchemaDriftReport)
+
+// OnSchemaDrift allows registering a function that gets called every time
+// an API response doesn't exactly match the type it's decoded into: it has
+// keys no field decodes, values that had to be weakly converted, or lacks
+// fields that aren't tagged omitempty. Responses are still decoded as usual.
+//
+// Collecting findings makes decoding slower, so it's only done once a
+// callback is registered. Each call registers an additional callback.
+func (c *Client) OnSchemaDrift(cb OnSchemaDrift) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// copy-on-write, like Use
+	callbacks := make([]OnSchemaDrift, 0, len(c.onSchemaDrift)+1)
+	callbacks = append(callbacks, c.onSchemaDrift...)
+	callbacks = append(callbacks, cb)
+	c.onSchemaDrift = callbacks
+}
+
+func (c *Client) schemaDriftCallbacks() []OnSchemaDrift {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.onSchemaDrift
+}
+
+// SchemaDriftKind is the kind of difference between a response and a Go type
+type SchemaDriftKind int
+
+const (
+	// SchemaDriftUnusedKey means the response has a key no field decodes
+	SchemaDriftUnusedKey SchemaDriftKind = iota + 1
+	// SchemaDriftCoercedField means a value had the wrong JSON type, and was
+	// weakly converted (a number sent as a string, a single value instead of
+	// an array, legacy traits, etc.)
+	SchemaDriftCoercedField
+	// SchemaDriftMissingField means the response lacks a field which isn't tagged omitempty
+	SchemaDriftMissingField
+)
+
+func (k SchemaDriftKind) String() string {
+	switch k {
+	case SchemaDriftUnusedKey:
+		return "unused key"
+	case SchemaDriftCoercedField:
+		return "coerced field"
+	case SchemaDriftMissingField:
+		return "missing field"
+	}
+	return fmt.Sprintf("SchemaDriftKind(%d)", int(k))
+}
+
+// A SchemaDriftFinding is one difference between a response and
+// the Go type it was decoded into.
+type SchemaDriftFinding struct {
+	Kind SchemaDriftKind
+	// Type is the Go struct the finding is about, like "itchio.Game"
+	Type string
+	// Path locates the value in the response, using its keys as sent
+	// by the server, like "owned_keys[2].game.user_id". For missing fields,
+	// the last element is the field's json tag.
+	Path string
+	// Detail describes coercions, like "string to int64"
+	Detail string
+}
+
+func (f SchemaDriftFinding) String() string {
+	s := fmt.Sprintf("%s %s (%s)", f.Kind, f.Path, f.Type)
+	if f.Detail != "" {
+		s += ": " + f.Detail
+	}
+	return s
+}
+
+// A SchemaDriftReport lists the differences between an API
+// response and the Go type it was decoded into.
+type SchemaDriftReport struct {
+	// Method and Path of the request, if any
+	Method string
+	Path   string
+	// Type is the Go type the response was decoded into
+	Type     string
+	Findings []SchemaDriftFinding
+}
+
+// ByType groups findings by the Go struct they're about
+func (r *SchemaDriftReport) ByType() map[string][]SchemaDriftFinding {
+	res := make(map[string][]SchemaDriftFinding)
+	for _, f := range r.Findings {
+		res[f.Type] = append(res[f.Type], f)
+	}
+	return res
+}
+
+func (r *SchemaDriftReport) String() string {
+	lines := make([]string, 0, len(r.Findings)+1)
+	lines = append(lines, fmt.Sprintf("schema drift for %s %s (%s):", r.Method, r.Path, r.Type))
+	for _, f := range r.Findings {
+		lines = append(lines, "  "+f.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CheckSchemaDrift decodes body into dst the same way API calls decode
+// responses, and reports how it differs from dst's type. It's meant to
+// check recorded responses (fixtures) against the current types in CI.
+func CheckSchemaDrift(body []byte, dst interface{}) (*SchemaDriftReport, error) {
+	d := decoder{data: body, drift: &driftCollector{}}
+	if err := d.decode(dst); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return d.drift.report(dst), nil
+}
+
+// driftCollector tracks where the decoder is, and what it found
+type driftCollector struct {
+	frames   []driftFrame
+	findings []SchemaDriftFinding
+}
+
+type driftFrame struct {
+	// name is a key or an index ("[2]")
+	name string
+	// owner is the struct being decoded
+	owner reflect.Type
+}
+
+func (dc *driftCollector) push(name string, owner reflect.Type) {
+	if owner == nil && len(dc.frames) > 0 {
+		owner = dc.frames[len(dc.frames)-1].owner
+	}
+	dc.frames = append(dc.frames, driftFrame{name: name, owner: owner})
+}
+
+func (dc *driftCollector) pop() {
+	dc.frames = dc.frames[:len(dc.frames)-1]
+}
+
+func (dc *driftCollector) path(last string) string {
+	var sb strings.Builder
+	for _, f := range dc.frames {
+		writePathElement(&sb, f.name)
+	}
+	if last != "" {
+		writePathElement(&sb, last)
+	}
+	return sb.String()
+}
+
+func writePathElement(sb *strings.Builder, name string) {
+	if sb.Len() > 0 && !strings.HasPrefix(name, "[") {
+		sb.WriteByte('.')
+	}
+	sb.WriteString(name)
+}
+
+func (dc *driftCollector) add(kind SchemaDriftKind, owner reflect.Type, path string, detail string) {
+	f := SchemaDriftFinding{Kind: kind, Path: path, Detail: detail}
+	if owner != nil {
+		f.Type = owner.String()
+	}
+	dc.findings = append(dc.findings, f)
+}
+
+func (dc *driftCollector) unused(owner reflect.Type, key string) {
+	dc.add(SchemaDriftUnusedKey, owner, dc.path(key), "")
+}
+
+func (dc *driftCollector) missing(owner reflect.Type, name string) {
+	dc.add(SchemaDriftMissingField, owner, dc.path(name), "")
+}
+
+// coerced records that the value at the current path was
+// converted from a JSON value of a different kind into t
+func (dc *driftCollector) coerced(t reflect.Type, from string) {
+	var owner reflect.Type
+	if len(dc.frames) > 0 {
+		owner = dc.frames[len(dc.frames)-1].owner
+	}
+	dc.add(SchemaDriftCoercedField, owner, dc.path(""), fmt.Sprintf("%s to %s", from, t))
+}
+
+func (dc *driftCollector) report(dst interface{}) *SchemaDriftReport {
+	return &SchemaDriftReport{
+		Type:     reflect.TypeOf(dst).Elem().String(),
+		Findings: dc.findings,
+	}
+}
+
+func (d *decoder) coerced(t reflect.Type, from string) {
+	if d.drift != nil {
+		d.drift.coerced(t, from)
+	}
+}
+
+func (d *decoder) pushIndex(i int) {
+	if d.drift != nil {
+		d.drift.push("["+strconv.Itoa(i)+"]", nil)
+	}
+}
+
+func (d *decoder) pushKey(k string) {
+	if d.drift != nil {
+		d.drift.push("["+k+"]", nil)
+	}
+}
+
+func (d *decoder) popPath() {
+	if d.drift != nil {
+		d.drift.pop()
+	}
+}
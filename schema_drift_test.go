@@ -0,0 +1,138 @@
+package itchio
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSchemaDrift(t *testing.T) {
+	var res ListProfileGamesResponse
+	report, err := CheckSchemaDrift([]byte(`{
+		"games": [
+			{"id": "12", "title": "a", "brand_new_field": {"x": 1}, "platforms": {}},
+			{"id": 13, "traits": ["p_linux"], "user": {"id": 1, "username": "amos", "display_name": "Amos"}}
+		]
+	}`), &res)
+	assert.NoError(t, err)
+
+	// still decoded as usual
+	assert.Len(t, res.Games, 2)
+	assert.EqualValues(t, 12, res.Games[0].ID)
+	assert.EqualValues(t, ArchitecturesAll, res.Games[1].Platforms.Linux)
+
+	assert.Equal(t, "itchio.ListProfileGamesResponse", report.Type)
+	assert.Contains(t, report.Findings, SchemaDriftFinding{
+		Kind:   SchemaDriftCoercedField,
+		Type:   "itchio.Game",
+		Path:   "games[0].id",
+		Detail: "string to int64",
+	})
+	assert.Contains(t, report.Findings, SchemaDriftFinding{
+		Kind: SchemaDriftUnusedKey,
+		Type: "itchio.Game",
+		Path: "games[0].brand_new_field",
+	})
+	assert.Contains(t, report.Findings, SchemaDriftFinding{
+		Kind:   SchemaDriftCoercedField,
+		Type:   "itchio.Game",
+		Path:   "games[1].traits",
+		Detail: "legacy traits to itchio.Game",
+	})
+	assert.Contains(t, report.Findings, SchemaDriftFinding{
+		Kind: SchemaDriftMissingField,
+		Type: "itchio.User",
+		Path: "games[1].user.developer",
+	})
+
+	// omitempty fields aren't expected, and objects with traits
+	// are only reported once, even though they're decoded twice
+	assert.Len(t, report.ByType()["itchio.Game"], 3)
+	assert.Len(t, report.ByType()["itchio.User"], 5)
+}
+
+func TestCheckSchemaDriftCoercions(t *testing.T) {
+	var res struct {
+		Uploads  []*Upload         `json:"uploads"`
+		Channels map[string]string `json:"channels"`
+		Tags     []string          `json:"tags"`
+		Count    int64             `json:"count"`
+		Name     string            `json:"name"`
+		Enabled  bool              `json:"enabled"`
+	}
+	report, err := CheckSchemaDrift([]byte(`{
+		"uploads": {},
+		"channels": [],
+		"tags": "one",
+		"count": 1.5,
+		"name": 42,
+		"enabled": "true"
+	}`), &res)
+	assert.NoError(t, err)
+
+	var details []string
+	for _, f := range report.Findings {
+		if f.Kind == SchemaDriftCoercedField {
+			details = append(details, f.Path+": "+f.Detail)
+		}
+	}
+	assert.Equal(t, []string{
+		"uploads: empty object to []*itchio.Upload",
+		"channels: array to map[string]string",
+		"tags: string to []string",
+		"count: float to int64",
+		"name: number to string",
+		"enabled: string to bool",
+	}, details)
+}
+
+func TestCheckSchemaDriftExactMatch(t *testing.T) {
+	var res GetProfileResponse
+	report, err := CheckSchemaDrift([]byte(`{"user": {
+		"id": 1, "username": "amos", "display_name": "Amos", "developer": true, "press_user": false,
+		"url": "https://amos.itch.io", "cover_url": "", "still_cover_url": ""
+	}}`), &res)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Findings)
+}
+
+func TestClientOnSchemaDrift(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/games/3":
+			_, _ = w.Write([]byte(`{"game": {"id": 3, "platforms": {}, "new_thing": true}}`))
+		default:
+			_, _ = w.Write([]byte(`{"user": {"id": 1, "username": "a", "display_name": "A", "developer": false,
+				"press_user": false, "url": "", "cover_url": "", "still_cover_url": ""}}`))
+		}
+	}))
+	defer server.Close()
+
+	client := newTestKeyClient(server)
+
+	var reports []*SchemaDriftReport
+	client.OnSchemaDrift(func(report *SchemaDriftReport) {
+		reports = append(reports, report)
+	})
+
+	_, err := client.GetProfile(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, reports, "responses that match exactly aren't reported")
+
+	_, err = client.GetGame(context.Background(), GetGameParams{GameID: 3})
+	assert.NoError(t, err)
+	if assert.Len(t, reports, 1) {
+		report := reports[0]
+		assert.Equal(t, "GET", report.Method)
+		assert.Equal(t, "/games/3", report.Path)
+		assert.Equal(t, "itchio.GetGameResponse", report.Type)
+		assert.Equal(t, []SchemaDriftFinding{
+			{Kind: SchemaDriftUnusedKey, Type: "itchio.Game", Path: "game.new_thing"},
+		}, report.Findings)
+		assert.Equal(t, "unused key game.new_thing (itchio.Game)", report.Findings[0].String())
+	}
+}
@@ -0,0 +1,170 @@
+package itchio
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxRefresherSleep is how long the token refresher sleeps at most
+	// before checking the credentials again, since they may be replaced
+	// by requests refreshing them, or by SetOAuthCredentials.
+	maxRefresherSleep = 5 * time.Minute
+
+	// minRefresherInterval keeps the token refresher from refreshing in a
+	// loop when the API issues tokens that expire within RefreshBuffer
+	minRefresherInterval = 10 * time.Second
+
+	// refresherBackoff is how long the token refresher waits after its
+	// first failure, doubling with each subsequent one, up to maxRefresherSleep
+	refresherBackoff = time.Second
+)
+
+// tokenRefresher is a running token refresher, see StartTokenRefresher
+type tokenRefresher struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartTokenRefresher refreshes the client's OAuth token in the background,
+// shortly before it expires (see OAuthConfig.RefreshBuffer), rather than
+// when a request needs it. Requests made after an idle period then don't
+// wait for a refresh, and idle processes don't let their refresh token
+// lapse. Failed refreshes are retried with exponential backoff.
+//
+// The refresher runs until ctx is done, Close is called, or the refresh
+// token is rejected (see ErrReauthRequired): once users have logged in
+// again, and SetOAuthCredentials was called, it can be started again.
+// Starting it while it's running does nothing. It returns an error if
+// the client doesn't use OAuth.
+func (c *Client) StartTokenRefresher(ctx context.Context) error {
+	a := c.oauthAuthenticator()
+	if a == nil {
+		return errors.New("itchio: StartTokenRefresher called on a client that doesn't use OAuth")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.refresher != nil {
+		select {
+		case <-c.refresher.done:
+			// it stopped when its context was done
+		default:
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r := &tokenRefresher{cancel: cancel, done: make(chan struct{})}
+	c.refresher = r
+	go c.runTokenRefresher(ctx, a, r.done)
+	return nil
+}
+
+// Close stops the client's token refresher, if it was started, and waits
+// for it to exit. The client can still be used afterwards.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	r := c.refresher
+	c.refresher = nil
+	c.mu.Unlock()
+
+	if r != nil {
+		r.cancel()
+		<-r.done
+	}
+	return nil
+}
+
+func (c *Client) runTokenRefresher(ctx context.Context, a *OAuthAuthenticator, done chan struct{}) {
+	defer close(done)
+	logger := c.logger()
+	logger.Log(ctx, LogLevelDebug, "token refresher started")
+	defer logger.Log(ctx, LogLevelDebug, "token refresher stopped")
+
+	var expiresAt, due, lastRefresh, retryAt time.Time
+	var failures int
+	for {
+		creds := a.Credentials()
+		if !creds.ExpiresAt.Equal(expiresAt) {
+			// new credentials: refreshed by us, by a request, or replaced
+			expiresAt = creds.ExpiresAt
+			due = refreshDue(expiresAt, a.config.RefreshBuffer)
+			failures = 0
+		}
+
+		var wait time.Duration
+		switch {
+		case a.ReauthRequired():
+			logger.Log(ctx, LogLevelInfo, "oauth session is over, stopping token refresher")
+			return
+		case expiresAt.IsZero():
+			// nothing to refresh, until the credentials change
+			wait = maxRefresherSleep
+		case failures > 0:
+			wait = time.Until(retryAt)
+		default:
+			next := due
+			if earliest := lastRefresh.Add(minRefresherInterval); next.Before(earliest) {
+				next = earliest
+			}
+			wait = time.Until(next)
+		}
+		if wait > 0 {
+			if wait > maxRefresherSleep {
+				wait = maxRefresherSleep
+			}
+			if err := sleepContext(ctx, wait); err != nil {
+				return
+			}
+			continue
+		}
+
+		// skip the refresh if the credentials changed while we
+		// were waiting for another goroutine to finish refreshing
+		lastRefresh = time.Now()
+		err := a.lockedRefresh(ctx, c, func() bool {
+			return a.Credentials().ExpiresAt.Equal(expiresAt)
+		})
+		if err == nil || errors.Is(err, ErrReauthRequired) {
+			// new credentials are picked up, or the session
+			// being over is, at the top of the loop
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		failures++
+		backoff := backoffDelay(failures)
+		retryAt = time.Now().Add(backoff)
+		logger.Log(ctx, LogLevelWarn, "background token refresh failed", "error", err, "failures", failures, "retryIn", backoff)
+	}
+}
+
+// refreshDue returns when credentials expiring at expiresAt should be
+// refreshed: RefreshBuffer before they expire, a bit earlier still at
+// random, so processes started together don't all refresh at once.
+func refreshDue(expiresAt time.Time, buffer time.Duration) time.Time {
+	due := expiresAt.Add(-buffer)
+	if jitter := time.Until(due) / 10; jitter > 0 {
+		due = due.Add(-time.Duration(rand.Int63n(int64(jitter))))
+	}
+	return due
+}
+
+// backoffDelay returns how long to wait after a number of consecutive
+// failures: refresherBackoff, doubled each time, plus up to 20% of jitter
+func backoffDelay(failures int) time.Duration {
+	delay := refresherBackoff
+	for i := 1; i < failures && delay < maxRefresherSleep; i++ {
+		delay *= 2
+	}
+	if delay > maxRefresherSleep {
+		delay = maxRefresherSleep
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay/5)+1))
+}
@@ -0,0 +1,171 @@
+package itchio
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTokenServer issues a new access token on each refresh, after
+// failing the first failures ones with a 503
+func newTokenServer(refreshCalls *int32, failures int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth/token" {
+			_, _ = w.Write([]byte(`{"user":{"id":1}}`))
+			return
+		}
+		n := atomic.AddInt32(refreshCalls, 1)
+		if n <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"access_token":"access-%d","refresh_token":"refresh-%d","expires_in":3600}`, n, n)
+	}))
+}
+
+func TestTokenRefresher(t *testing.T) {
+	var refreshCalls int32
+	server := newTokenServer(&refreshCalls, 0)
+	defer server.Close()
+
+	// the token is already within RefreshBuffer of expiring
+	client := newTestOAuthClient(t, server, &OAuthCredentials{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(30 * time.Second),
+	}, OAuthConfig{ClientID: "client", RefreshBuffer: time.Minute})
+	client.Limiter = nil
+
+	assert.NoError(t, client.StartTokenRefresher(context.Background()))
+	assert.NoError(t, client.StartTokenRefresher(context.Background()), "starting it twice does nothing")
+
+	assert.Eventually(t, func() bool {
+		return client.oauthAuthenticator().Credentials().AccessToken == "access-1"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, client.Close())
+	assert.NoError(t, client.Close(), "closing twice is fine")
+	assert.Nil(t, client.refresher)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&refreshCalls))
+
+	assert.Error(t, ClientWithKey("key").StartTokenRefresher(context.Background()))
+}
+
+func TestRefreshDue(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		expiresIn time.Duration
+		buffer    time.Duration
+	}{
+		{"far from expiring", time.Hour, 10 * time.Minute},
+		{"no buffer", time.Hour, 0},
+		{"within buffer", 5 * time.Minute, 10 * time.Minute},
+		{"expired", -time.Minute, 10 * time.Minute},
+	} {
+		expiresAt := time.Now().Add(c.expiresIn)
+		latest := expiresAt.Add(-c.buffer)
+		// jitter is at most 10% of the time left until latest
+		earliest := latest
+		if left := time.Until(latest); left > 0 {
+			earliest = latest.Add(-left / 10)
+		}
+
+		for i := 0; i < 100; i++ {
+			due := refreshDue(expiresAt, c.buffer)
+			assert.False(t, due.After(latest), "%s: due after expiry minus buffer", c.name)
+			assert.False(t, due.Before(earliest), "%s: more than 10%% of jitter", c.name)
+		}
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for _, c := range []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{1, refresherBackoff},
+		{2, 2 * refresherBackoff},
+		{3, 4 * refresherBackoff},
+		{9, 256 * refresherBackoff},
+		{10, maxRefresherSleep},
+		{100, maxRefresherSleep},
+	} {
+		for i := 0; i < 100; i++ {
+			delay := backoffDelay(c.failures)
+			assert.True(t, delay >= c.delay, "%d failures: %s < %s", c.failures, delay, c.delay)
+			assert.True(t, delay <= c.delay+c.delay/5, "%d failures: %s is more than 20%% over %s", c.failures, delay, c.delay)
+		}
+	}
+}
+
+func TestTokenRefresherCoordinatesWithRequests(t *testing.T) {
+	var refreshCalls int32
+	server := newTokenServer(&refreshCalls, 0)
+	defer server.Close()
+
+	client := newTestOAuthClient(t, server, &OAuthCredentials{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	}, OAuthConfig{ClientID: "client"})
+	client.Limiter = nil
+
+	ctx, cancel := context.WithCancel(context.Background())
+	concurrently(4, func(i int) {
+		if i == 0 {
+			assert.NoError(t, client.StartTokenRefresher(ctx))
+			return
+		}
+		_, err := client.GetProfile(ctx)
+		assert.NoError(t, err)
+	})
+	assert.NoError(t, client.refreshTokenIfNeeded(ctx))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&refreshCalls), "tokens are refreshed once")
+
+	cancel()
+	assert.NoError(t, client.Close())
+}
+
+func TestTokenRefresherStopsWhenReauthRequired(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"errors":["invalid_grant"]}`))
+	}))
+	defer server.Close()
+
+	client := newTestOAuthClient(t, server, &OAuthCredentials{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	}, OAuthConfig{ClientID: "client"})
+	client.Limiter = nil
+
+	assert.NoError(t, client.StartTokenRefresher(context.Background()))
+	first := client.refresher
+	select {
+	case <-first.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the refresher should stop once the refresh token is rejected")
+	}
+	assert.True(t, client.oauthAuthenticator().ReauthRequired())
+
+	assert.NoError(t, client.SetOAuthCredentials(&OAuthCredentials{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}))
+	assert.NoError(t, client.StartTokenRefresher(context.Background()))
+	assert.NotEqual(t, first, client.refresher, "it can be started again")
+	select {
+	case <-client.refresher.done:
+		t.Fatal("the new refresher should be running")
+	default:
+	}
+	assert.NoError(t, client.Close())
+}